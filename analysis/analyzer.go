@@ -0,0 +1,166 @@
+// Package analysis turns text into the terms of an index.
+//
+// An Analyzer splits text into tokens with Tokenize and passes each token through a chain of filters,
+// which may rewrite or drop it. Analyzers are described by a spec naming the filters in order, separated
+// by commas, so the analysis used to build an index can be recorded and reproduced.
+package analysis
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Filter rewrites a token, returning false to drop it.
+type Filter func(token string) (string, bool)
+
+// FilterNames lists the filters accepted in an analyzer spec.
+//   - possessive: removes a trailing 's, as Lucene's EnglishPossessiveFilter.
+//   - lowercase: lower cases the token.
+//   - stop:<list>: drops the stopwords of one of StopwordListNames, or of a file of whitespace separated
+//     words.
+//   - stem:<stemmer>: stems the token with one of StemmerNames.
+var FilterNames = []string{"possessive", "lowercase", "stop:<list>", "stem:<stemmer>"}
+
+// StemmerNames lists the stemmers accepted by the stem filter.
+//   - porter: Porter's original algorithm, as Lucene's PorterStemFilter.
+//   - porter2: the Snowball English stemmer.
+//   - krovetz: the inflectional rules of Krovetz's stemmer, without its dictionary.
+var StemmerNames = []string{"porter", "porter2", "krovetz"}
+
+var stemmers = map[string]func(word string) string{
+	"porter":  PorterStem,
+	"porter2": Porter2Stem,
+	"krovetz": KrovetzStem,
+}
+
+// Presets name common analyzer specs. A preset may be used in place of its filters in any spec.
+//   - anserini: Anserini's default English analysis. Tokenize splits Katakana into single characters,
+//     whereas Lucene keeps runs of Katakana together, so Japanese text is not indexed as Anserini would.
+//   - indri: Indri's usual analysis. The krovetz stemmer lacks KStem's dictionary, so indexes differ from
+//     Indri's: "agreed" is kept whole and "news" becomes "new", for example.
+var Presets = map[string]string{
+	"anserini": "possessive,lowercase,stop:lucene,stem:porter",
+	"indri":    "lowercase,stop:indri,stem:krovetz",
+}
+
+func newFilter(name string) (Filter, error) {
+	kind, argument, _ := strings.Cut(name, ":")
+	switch kind {
+	case "possessive":
+		return possessive, nil
+	case "lowercase":
+		return lowercase, nil
+	case "stop":
+		stopwords, err := loadStopwords(argument)
+		if err != nil {
+			return nil, fmt.Errorf("stop filter: %w", err)
+		}
+		return func(token string) (string, bool) {
+			return token, !stopwords[token]
+		}, nil
+	case "stem":
+		stem, ok := stemmers[argument]
+		if !ok {
+			return nil, fmt.Errorf("unknown stemmer %q, expected one of %v", argument, StemmerNames)
+		}
+		return func(token string) (string, bool) {
+			return stem(token), true
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown filter %q, expected one of %v or a preset", name, FilterNames)
+	}
+}
+
+// Analyzer tokenizes text and filters the tokens into terms.
+type Analyzer struct {
+	spec    string
+	filters []Filter
+}
+
+// New returns the analyzer described by spec, a comma separated list of filters and presets applied in
+// order. An empty spec tokenizes only.
+func New(spec string) (*Analyzer, error) {
+	names := make([]string, 0)
+	for _, name := range strings.Split(spec, ",") {
+		name = strings.TrimSpace(name)
+		if preset, ok := Presets[name]; ok {
+			names = append(names, strings.Split(preset, ",")...)
+		} else if name != "" {
+			names = append(names, name)
+		}
+	}
+	analyzer := &Analyzer{spec: strings.Join(names, ",")}
+	for _, name := range names {
+		filter, err := newFilter(name)
+		if err != nil {
+			return nil, err
+		}
+		analyzer.filters = append(analyzer.filters, filter)
+	}
+	return analyzer, nil
+}
+
+// Spec returns the filters of the analyzer, with presets expanded, in the form accepted by New.
+func (analyzer *Analyzer) Spec() string {
+	return analyzer.spec
+}
+
+// Analyze returns the terms of text in order, including repeats.
+func (analyzer *Analyzer) Analyze(text string) []string {
+	terms := make([]string, 0)
+	for token := range Tokenize(text) {
+		term, ok := token, true
+		for _, filter := range analyzer.filters {
+			term, ok = filter(term)
+			if !ok {
+				break
+			}
+		}
+		if ok && term != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+func possessive(token string) (string, bool) {
+	for _, suffix := range []string{"'s", "'S", "’s", "’S"} {
+		if stem, found := strings.CutSuffix(token, suffix); found {
+			return stem, true
+		}
+	}
+	return token, true
+}
+
+func lowercase(token string) (string, bool) {
+	return strings.ToLower(token), true
+}
+
+// descriptionPrefix starts the line of a header description recording the analyzer an index was built
+// with.
+const descriptionPrefix = "ciffTools-analyzer: "
+
+// ErrNoAnalyzer is returned by FromDescription for a description without a recorded analyzer.
+var ErrNoAnalyzer = errors.New("no analyzer recorded in the description")
+
+// AppendTo returns description with a line recording the analyzer appended.
+func (analyzer *Analyzer) AppendTo(description string) string {
+	if description != "" {
+		description += "\n"
+	}
+	return description + descriptionPrefix + analyzer.spec
+}
+
+// FromDescription returns the last analyzer recorded in a header description by AppendTo, which is the
+// one the index was most recently analysed with, as quantize.ParseProvenance does for provenance.
+func FromDescription(description string) (*Analyzer, error) {
+	lines := strings.Split(description, "\n")
+	for lineIndex := len(lines) - 1; lineIndex >= 0; lineIndex-- {
+		spec, found := strings.CutPrefix(lines[lineIndex], descriptionPrefix)
+		if found {
+			return New(spec)
+		}
+	}
+	return nil, ErrNoAnalyzer
+}
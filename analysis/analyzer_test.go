@@ -0,0 +1,86 @@
+package analysis
+
+import (
+	"errors"
+	"slices"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text   string
+		tokens []string
+	}{
+		{"Hello, world!", []string{"Hello", "world"}},
+		{"don't stop the U.S.A. in 3.14 or 1,000", []string{"don't", "stop", "the", "U.S.A", "in", "3.14", "or", "1,000"}},
+		{"end. Start 'quoted' 3. 4", []string{"end", "Start", "quoted", "3", "4"}},
+		{"café naïve", []string{"café", "naïve"}},
+		{"東京タワー", []string{"東", "京", "タ", "ワ", "ー"}},
+		{"  \t\n", nil},
+	}
+	for _, test := range tests {
+		tokens := slices.Collect(Tokenize(test.text))
+		if !slices.Equal(tokens, test.tokens) {
+			t.Errorf("Tokenize(%q) = %q, want %q", test.text, tokens, test.tokens)
+		}
+	}
+}
+
+func TestAnalyzer(t *testing.T) {
+	tests := []struct {
+		spec, text string
+		terms      []string
+	}{
+		{"", "The Cat's hats", []string{"The", "Cat's", "hats"}},
+		{"lowercase", "The Cat's hats", []string{"the", "cat's", "hats"}},
+		{"anserini", "The Cat's hats are running", []string{"cat", "hat", "run"}},
+		{"lowercase,stem:porter2", "Generously consigned", []string{"generous", "consign"}},
+	}
+	for _, test := range tests {
+		analyzer, err := New(test.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		terms := analyzer.Analyze(test.text)
+		if !slices.Equal(terms, test.terms) {
+			t.Errorf("%q: Analyze(%q) = %q, want %q", test.spec, test.text, terms, test.terms)
+		}
+	}
+	for _, spec := range []string{"uppercase", "stem:lancaster", "stop:none"} {
+		_, err := New(spec)
+		if err == nil {
+			t.Errorf("New accepted %q", spec)
+		}
+	}
+}
+
+func TestAnalyzerDescription(t *testing.T) {
+	analyzer, err := New("anserini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	description := analyzer.AppendTo("a collection")
+	recorded, err := FromDescription(description)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Spec() != "possessive,lowercase,stop:lucene,stem:porter" {
+		t.Errorf("recorded spec %q", recorded.Spec())
+	}
+	// A description recording two analyzers, as after re-analysis, describes the index by the last.
+	porter2, err := New("lowercase,stem:porter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	recorded, err = FromDescription(porter2.AppendTo(description) + "\nciffTools-quantize: {}")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recorded.Spec() != "lowercase,stem:porter2" {
+		t.Errorf("recorded spec %q, want the last analyzer", recorded.Spec())
+	}
+	_, err = FromDescription("a collection")
+	if !errors.Is(err, ErrNoAnalyzer) {
+		t.Errorf("error %v, want ErrNoAnalyzer", err)
+	}
+}
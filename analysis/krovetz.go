@@ -0,0 +1,112 @@
+package analysis
+
+import "strings"
+
+// KrovetzStem returns the stem of word, which should be lower case, under the inflectional rules of
+// Krovetz's stemmer (KStem): plurals, -ed and -ing are removed. KStem checks each candidate stem against
+// a dictionary of about 30,000 English head words and falls back to a default when none is found. The
+// dictionary is not included here, so the defaults are always used, with the conventional English
+// spelling rules standing in for the dictionary where KStem's defaults rely on it (boxes → box,
+// hopped → hop, hoped → hope). Stems therefore do not always agree with Indri or Lucene's KStemFilter,
+// and no derivational suffixes are removed.
+func KrovetzStem(word string) string {
+	if len(word) <= 3 {
+		return word
+	}
+	word = krovetzPlural(word)
+	word = krovetzPastTense(word)
+	return word
+}
+
+func isKrovetzVowel(character byte) bool {
+	switch character {
+	case 'a', 'e', 'i', 'o', 'u':
+		return true
+	}
+	return false
+}
+
+func krovetzHasVowel(stem string) bool {
+	for i := range len(stem) {
+		if isKrovetzVowel(stem[i]) || stem[i] == 'y' && i > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+func krovetzPlural(word string) string {
+	switch {
+	case strings.HasSuffix(word, "ies"):
+		// ties → tie, but ponies → pony
+		if len(word) == 4 {
+			return word[:len(word)-1]
+		}
+		return word[:len(word)-3] + "y"
+	case strings.HasSuffix(word, "es"):
+		stem := word[:len(word)-2]
+		for _, sibilant := range []string{"ss", "x", "ch", "sh", "z"} {
+			if strings.HasSuffix(stem, sibilant) {
+				return stem
+			}
+		}
+		return word[:len(word)-1]
+	case strings.HasSuffix(word, "s"):
+		// Unless the word ends in a double s, -us or -is (glass, famous, analysis), remove the final s.
+		if !strings.HasSuffix(word, "ss") && !strings.HasSuffix(word, "us") && !strings.HasSuffix(word, "is") {
+			return word[:len(word)-1]
+		}
+	}
+	return word
+}
+
+func krovetzPastTense(word string) string {
+	var stem string
+	switch {
+	case strings.HasSuffix(word, "ied"):
+		if len(word) == 4 {
+			return word[:len(word)-1]
+		}
+		return word[:len(word)-3] + "y"
+	case len(word) == 5 && strings.HasSuffix(word, "ying"):
+		// dying → die
+		return word[:1] + "ie"
+	case strings.HasSuffix(word, "eed"):
+		return word
+	case strings.HasSuffix(word, "ed"):
+		stem = word[:len(word)-2]
+	case strings.HasSuffix(word, "ing"):
+		stem = word[:len(word)-3]
+	default:
+		return word
+	}
+	if len(stem) < 2 || !krovetzHasVowel(stem) {
+		return word
+	}
+	n := len(stem)
+	last := stem[n-1]
+	switch {
+	case n >= 2 && last == stem[n-2] && !isKrovetzVowel(last) && last != 'l' && last != 's' && last != 'z':
+		// hopped → hop
+		return stem[:n-1]
+	case n >= 3 && !isKrovetzVowel(stem[n-3]) && isKrovetzVowel(stem[n-2]) && !isKrovetzVowel(last) &&
+		last != 'w' && last != 'x' && last != 'y' && krovetzSyllables(stem) == 1:
+		// hoped → hope
+		return stem + "e"
+	case strings.HasSuffix(stem, "at") || strings.HasSuffix(stem, "iz") || strings.HasSuffix(stem, "bl"):
+		// related → relate
+		return stem + "e"
+	}
+	return stem
+}
+
+// krovetzSyllables counts the vowel groups of stem.
+func krovetzSyllables(stem string) int {
+	syllables := 0
+	for i := range len(stem) {
+		if isKrovetzVowel(stem[i]) && (i == 0 || !isKrovetzVowel(stem[i-1])) {
+			syllables++
+		}
+	}
+	return syllables
+}
@@ -0,0 +1,271 @@
+package analysis
+
+// porterStemmer is Martin Porter's reference implementation of his 1980 algorithm, including its
+// departures from the published paper, as used by Lucene's PorterStemFilter. The word is held in b[:k+1]
+// and j marks the end of the stem while a suffix is being tested.
+type porterStemmer struct {
+	b    []byte
+	k, j int
+}
+
+// PorterStem returns the Porter stem of word, which should be lower case. Words of one or two letters are
+// returned unchanged.
+func PorterStem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	stemmer := porterStemmer{b: []byte(word), k: len(word) - 1}
+	stemmer.step1ab()
+	if stemmer.k > 0 {
+		stemmer.step1c()
+		stemmer.step2()
+		stemmer.step3()
+		stemmer.step4()
+		stemmer.step5()
+	}
+	return string(stemmer.b[:stemmer.k+1])
+}
+
+// cons reports whether b[i] is a consonant.
+func (stemmer *porterStemmer) cons(i int) bool {
+	switch stemmer.b[i] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return false
+	case 'y':
+		return i == 0 || !stemmer.cons(i-1)
+	}
+	return true
+}
+
+// m measures the number of consonant sequences in b[:j+1]. With c a consonant sequence and v a vowel
+// sequence, and [] marking optional presence, <c><v> gives 0, <c>vc<v> gives 1, <c>vcvc<v> gives 2 and so
+// on.
+func (stemmer *porterStemmer) m() int {
+	n := 0
+	i := 0
+	for {
+		if i > stemmer.j {
+			return n
+		}
+		if !stemmer.cons(i) {
+			break
+		}
+		i++
+	}
+	i++
+	for {
+		for {
+			if i > stemmer.j {
+				return n
+			}
+			if stemmer.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+		n++
+		for {
+			if i > stemmer.j {
+				return n
+			}
+			if !stemmer.cons(i) {
+				break
+			}
+			i++
+		}
+		i++
+	}
+}
+
+// vowelInStem reports whether b[:j+1] contains a vowel.
+func (stemmer *porterStemmer) vowelInStem() bool {
+	for i := 0; i <= stemmer.j; i++ {
+		if !stemmer.cons(i) {
+			return true
+		}
+	}
+	return false
+}
+
+// doublec reports whether b[j-1:j+1] is a double consonant.
+func (stemmer *porterStemmer) doublec(j int) bool {
+	return j >= 1 && stemmer.b[j] == stemmer.b[j-1] && stemmer.cons(j)
+}
+
+// cvc reports whether b[i-2:i+1] is consonant-vowel-consonant and the second consonant is not w, x or y.
+// This restores an e at the end of short words like cav(e), lov(e) and hop(e) but not snow, box or tray.
+func (stemmer *porterStemmer) cvc(i int) bool {
+	if i < 2 || !stemmer.cons(i) || stemmer.cons(i-1) || !stemmer.cons(i-2) {
+		return false
+	}
+	switch stemmer.b[i] {
+	case 'w', 'x', 'y':
+		return false
+	}
+	return true
+}
+
+// ends reports whether b[:k+1] ends with suffix, setting j to the end of the stem if so.
+func (stemmer *porterStemmer) ends(suffix string) bool {
+	length := len(suffix)
+	if length > stemmer.k+1 || string(stemmer.b[stemmer.k-length+1:stemmer.k+1]) != suffix {
+		return false
+	}
+	stemmer.j = stemmer.k - length
+	return true
+}
+
+// setTo replaces the suffix after j with s.
+func (stemmer *porterStemmer) setTo(s string) {
+	stemmer.b = append(stemmer.b[:stemmer.j+1], s...)
+	stemmer.k = stemmer.j + len(s)
+}
+
+// r replaces the suffix after j with s if the stem has a measure greater than zero.
+func (stemmer *porterStemmer) r(s string) {
+	if stemmer.m() > 0 {
+		stemmer.setTo(s)
+	}
+}
+
+// step1ab removes plurals and -ed or -ing, e.g. caresses → caress, ponies → poni, meetings → meet,
+// agreed → agree, disabled → disable, matting → mat, mating → mate.
+func (stemmer *porterStemmer) step1ab() {
+	if stemmer.b[stemmer.k] == 's' {
+		if stemmer.ends("sses") {
+			stemmer.k -= 2
+		} else if stemmer.ends("ies") {
+			stemmer.setTo("i")
+		} else if stemmer.b[stemmer.k-1] != 's' {
+			stemmer.k--
+		}
+	}
+	if stemmer.ends("eed") {
+		if stemmer.m() > 0 {
+			stemmer.k--
+		}
+	} else if (stemmer.ends("ed") || stemmer.ends("ing")) && stemmer.vowelInStem() {
+		stemmer.k = stemmer.j
+		if stemmer.ends("at") {
+			stemmer.setTo("ate")
+		} else if stemmer.ends("bl") {
+			stemmer.setTo("ble")
+		} else if stemmer.ends("iz") {
+			stemmer.setTo("ize")
+		} else if stemmer.doublec(stemmer.k) {
+			stemmer.k--
+			switch stemmer.b[stemmer.k] {
+			case 'l', 's', 'z':
+				stemmer.k++
+			}
+		} else if stemmer.m() == 1 && stemmer.cvc(stemmer.k) {
+			stemmer.setTo("e")
+		}
+	}
+}
+
+// step1c turns a terminal y into i when there is another vowel in the stem.
+func (stemmer *porterStemmer) step1c() {
+	if stemmer.ends("y") && stemmer.vowelInStem() {
+		stemmer.b[stemmer.k] = 'i'
+	}
+}
+
+// porterRule replaces suffix with replacement.
+type porterRule struct {
+	suffix, replacement string
+}
+
+// applyFirst applies the first rule whose suffix matches, if the stem has a measure greater than zero.
+// Later rules are not tried once a suffix matches.
+func (stemmer *porterStemmer) applyFirst(rules []porterRule) {
+	for _, rule := range rules {
+		if stemmer.ends(rule.suffix) {
+			stemmer.r(rule.replacement)
+			return
+		}
+	}
+}
+
+// step2Rules map double suffixes to single ones, keyed by the penultimate letter, e.g. -ization (-ize
+// plus -ation) → -ize.
+var step2Rules = map[byte][]porterRule{
+	'a': {{"ational", "ate"}, {"tional", "tion"}},
+	'c': {{"enci", "ence"}, {"anci", "ance"}},
+	'e': {{"izer", "ize"}},
+	'l': {{"bli", "ble"}, {"alli", "al"}, {"entli", "ent"}, {"eli", "e"}, {"ousli", "ous"}},
+	'o': {{"ization", "ize"}, {"ation", "ate"}, {"ator", "ate"}},
+	's': {{"alism", "al"}, {"iveness", "ive"}, {"fulness", "ful"}, {"ousness", "ous"}},
+	't': {{"aliti", "al"}, {"iviti", "ive"}, {"biliti", "ble"}},
+	'g': {{"logi", "log"}},
+}
+
+func (stemmer *porterStemmer) step2() {
+	if stemmer.k == 0 {
+		return
+	}
+	stemmer.applyFirst(step2Rules[stemmer.b[stemmer.k-1]])
+}
+
+// step3Rules deal with -ic-, -full, -ness etc., keyed by the last letter.
+var step3Rules = map[byte][]porterRule{
+	'e': {{"icate", "ic"}, {"ative", ""}, {"alize", "al"}},
+	'i': {{"iciti", "ic"}},
+	'l': {{"ical", "ic"}, {"ful", ""}},
+	's': {{"ness", ""}},
+}
+
+func (stemmer *porterStemmer) step3() {
+	stemmer.applyFirst(step3Rules[stemmer.b[stemmer.k]])
+}
+
+// step4Suffixes are removed from stems with a measure greater than one, keyed by the penultimate letter.
+var step4Suffixes = map[byte][]string{
+	'a': {"al"},
+	'c': {"ance", "ence"},
+	'e': {"er"},
+	'i': {"ic"},
+	'l': {"able", "ible"},
+	'n': {"ant", "ement", "ment", "ent"},
+	'o': {"ion", "ou"},
+	's': {"ism"},
+	't': {"ate", "iti"},
+	'u': {"ous"},
+	'v': {"ive"},
+	'z': {"ize"},
+}
+
+// step4 takes off -ant, -ence etc. in context <c>vcvc<v>.
+func (stemmer *porterStemmer) step4() {
+	if stemmer.k == 0 {
+		return
+	}
+	for _, suffix := range step4Suffixes[stemmer.b[stemmer.k-1]] {
+		if !stemmer.ends(suffix) {
+			continue
+		}
+		if suffix == "ion" && (stemmer.j < 0 || (stemmer.b[stemmer.j] != 's' && stemmer.b[stemmer.j] != 't')) {
+			continue
+		}
+		if stemmer.m() > 1 {
+			stemmer.k = stemmer.j
+		}
+		return
+	}
+}
+
+// step5 removes a final -e if the measure is greater than one, and changes -ll to -l if the measure is
+// greater than one.
+func (stemmer *porterStemmer) step5() {
+	stemmer.j = stemmer.k
+	if stemmer.b[stemmer.k] == 'e' {
+		a := stemmer.m()
+		if a > 1 || a == 1 && !stemmer.cvc(stemmer.k-1) {
+			stemmer.k--
+		}
+	}
+	if stemmer.b[stemmer.k] == 'l' && stemmer.doublec(stemmer.k) && stemmer.m() > 1 {
+		stemmer.k--
+	}
+}
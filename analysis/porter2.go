@@ -0,0 +1,219 @@
+package analysis
+
+import "strings"
+
+var porter2Exceptions = map[string]string{
+	"skis": "ski", "skies": "sky", "dying": "die", "lying": "lie", "tying": "tie",
+	"idly": "idl", "gently": "gentl", "ugly": "ugli", "early": "earli", "only": "onli", "singly": "singl",
+	"sky": "sky", "news": "news", "howe": "howe", "atlas": "atlas", "cosmos": "cosmos", "bias": "bias",
+	"andes": "andes",
+}
+
+var porter2Step1aInvariants = map[string]bool{
+	"inning": true, "outing": true, "canning": true, "herring": true, "earring": true,
+	"proceed": true, "exceed": true, "succeed": true,
+}
+
+// porter2Step2 maps the double suffixes removed in step 2 to their replacements.
+var porter2Step2 = map[string]string{
+	"tional": "tion", "enci": "ence", "anci": "ance", "abli": "able", "entli": "ent", "izer": "ize",
+	"ization": "ize", "ational": "ate", "ation": "ate", "ator": "ate", "alism": "al", "aliti": "al",
+	"alli": "al", "fulness": "ful", "ousli": "ous", "ousness": "ous", "iveness": "ive", "iviti": "ive",
+	"biliti": "ble", "bli": "ble", "ogi": "og", "fulli": "ful", "lessli": "less", "li": "",
+}
+
+var porter2Step2Suffixes = mapKeys(porter2Step2)
+
+// porter2Step3 maps the suffixes removed in step 3 to their replacements.
+var porter2Step3 = map[string]string{
+	"tional": "tion", "ational": "ate", "alize": "al", "icate": "ic", "iciti": "ic", "ical": "ic",
+	"ful": "", "ness": "", "ative": "",
+}
+
+var porter2Step3Suffixes = mapKeys(porter2Step3)
+
+func isPorter2Vowel(character byte) bool {
+	switch character {
+	case 'a', 'e', 'i', 'o', 'u', 'y':
+		return true
+	}
+	return false
+}
+
+// porter2Region returns the start of the region after the first non-vowel following a vowel at or after
+// start, or len(word) if there is none.
+func porter2Region(word string, start int) int {
+	for i := start + 1; i < len(word); i++ {
+		if !isPorter2Vowel(word[i]) && isPorter2Vowel(word[i-1]) {
+			return i + 1
+		}
+	}
+	return len(word)
+}
+
+// endsInShortSyllable reports whether word ends in a vowel followed by a non-vowel other than w, x or Y
+// and preceded by a non-vowel, or is a vowel followed by a non-vowel.
+func endsInShortSyllable(word string) bool {
+	n := len(word)
+	if n == 2 {
+		return isPorter2Vowel(word[0]) && !isPorter2Vowel(word[1])
+	}
+	if n < 3 {
+		return false
+	}
+	last := word[n-1]
+	return !isPorter2Vowel(word[n-3]) && isPorter2Vowel(word[n-2]) && !isPorter2Vowel(last) && last != 'w' && last != 'x' && last != 'Y'
+}
+
+// longestSuffix returns the longest of suffixes that word ends with, or "" if there is none.
+func longestSuffix(word string, suffixes ...string) string {
+	longest := ""
+	for _, suffix := range suffixes {
+		if len(suffix) > len(longest) && strings.HasSuffix(word, suffix) {
+			longest = suffix
+		}
+	}
+	return longest
+}
+
+// Porter2Stem returns the stem of word, which should be lower case, under the English stemmer of the
+// Snowball project (Porter2) described at https://snowballstem.org/algorithms/english/stemmer.html and
+// used by Lucene's SnowballFilter. Words of one or two letters are returned unchanged.
+func Porter2Stem(word string) string {
+	if len(word) <= 2 {
+		return word
+	}
+	if exception, ok := porter2Exceptions[word]; ok {
+		return exception
+	}
+	word = strings.ReplaceAll(word, "’", "'")
+	word = strings.TrimPrefix(word, "'")
+	if len(word) <= 2 {
+		return word
+	}
+
+	// Y marks a y that is a consonant until the end.
+	marked := []byte(word)
+	for i := range marked {
+		if marked[i] == 'y' && (i == 0 || isPorter2Vowel(marked[i-1])) {
+			marked[i] = 'Y'
+		}
+	}
+	word = string(marked)
+
+	r1 := porter2Region(word, 0)
+	for _, prefix := range []string{"gener", "commun", "arsen"} {
+		if strings.HasPrefix(word, prefix) {
+			r1 = len(prefix)
+			break
+		}
+	}
+	r2 := porter2Region(word, r1)
+	inR1 := func(suffix string) bool { return len(word)-len(suffix) >= r1 }
+	inR2 := func(suffix string) bool { return len(word)-len(suffix) >= r2 }
+	hasVowel := func(s string) bool { return strings.ContainsAny(s, "aeiouy") }
+
+	// Step 0: remove possessives.
+	if suffix := longestSuffix(word, "'", "'s", "'s'"); suffix != "" {
+		word = word[:len(word)-len(suffix)]
+	}
+
+	// Step 1a: plurals.
+	switch suffix := longestSuffix(word, "sses", "ied", "ies", "s", "us", "ss"); suffix {
+	case "sses":
+		word = word[:len(word)-2]
+	case "ied", "ies":
+		if len(word) > 4 {
+			word = word[:len(word)-2]
+		} else {
+			word = word[:len(word)-1]
+		}
+	case "s":
+		if hasVowel(word[:len(word)-2]) {
+			word = word[:len(word)-1]
+		}
+	}
+	if porter2Step1aInvariants[word] {
+		return word
+	}
+
+	// Step 1b: -eed, -ed and -ing.
+	switch suffix := longestSuffix(word, "eed", "eedly", "ed", "edly", "ing", "ingly"); suffix {
+	case "eed", "eedly":
+		if inR1(suffix) {
+			word = word[:len(word)-len(suffix)] + "ee"
+		}
+	case "ed", "edly", "ing", "ingly":
+		stem := word[:len(word)-len(suffix)]
+		if hasVowel(stem) {
+			word = stem
+			switch {
+			case strings.HasSuffix(word, "at"), strings.HasSuffix(word, "bl"), strings.HasSuffix(word, "iz"):
+				word += "e"
+			case longestSuffix(word, "bb", "dd", "ff", "gg", "mm", "nn", "pp", "rr", "tt") != "":
+				word = word[:len(word)-1]
+			case r1 >= len(word) && endsInShortSyllable(word):
+				word += "e"
+			}
+		}
+	}
+
+	// Step 1c: a final y or Y after a non-vowel that is not the first letter becomes i.
+	if n := len(word); n > 2 && (word[n-1] == 'y' || word[n-1] == 'Y') && !isPorter2Vowel(word[n-2]) {
+		word = word[:n-1] + "i"
+	}
+
+	// Step 2: double suffixes in R1.
+	if suffix := longestSuffix(word, porter2Step2Suffixes...); suffix != "" && inR1(suffix) {
+		stem := word[:len(word)-len(suffix)]
+		switch suffix {
+		case "ogi":
+			if strings.HasSuffix(stem, "l") {
+				word = stem + "og"
+			}
+		case "li":
+			if stem != "" && strings.IndexByte("cdeghkmnrt", stem[len(stem)-1]) >= 0 {
+				word = stem
+			}
+		default:
+			word = stem + porter2Step2[suffix]
+		}
+	}
+
+	// Step 3: -ic-, -full, -ness etc. in R1.
+	if suffix := longestSuffix(word, porter2Step3Suffixes...); suffix != "" && inR1(suffix) {
+		if suffix != "ative" || inR2(suffix) {
+			word = word[:len(word)-len(suffix)] + porter2Step3[suffix]
+		}
+	}
+
+	// Step 4: single suffixes in R2.
+	suffix := longestSuffix(word, "al", "ance", "ence", "er", "ic", "able", "ible", "ant", "ement", "ment",
+		"ent", "ism", "ate", "iti", "ous", "ive", "ize", "ion")
+	if suffix != "" && inR2(suffix) {
+		stem := word[:len(word)-len(suffix)]
+		if suffix != "ion" || strings.HasSuffix(stem, "s") || strings.HasSuffix(stem, "t") {
+			word = stem
+		}
+	}
+
+	// Step 5: a final e or l.
+	if strings.HasSuffix(word, "e") {
+		stem := word[:len(word)-1]
+		if inR2("e") || inR1("e") && !endsInShortSyllable(stem) {
+			word = stem
+		}
+	} else if strings.HasSuffix(word, "ll") && inR2("l") {
+		word = word[:len(word)-1]
+	}
+
+	return strings.ReplaceAll(word, "Y", "y")
+}
+
+func mapKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
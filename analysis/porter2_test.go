@@ -0,0 +1,37 @@
+package analysis
+
+import "testing"
+
+// TestPorter2Stem checks words from the Snowball English vocabulary and its exceptions against the
+// published output.
+func TestPorter2Stem(t *testing.T) {
+	tests := []struct {
+		word, stem string
+	}{
+		{"consign", "consign"}, {"consigned", "consign"}, {"consigning", "consign"}, {"consignment", "consign"},
+		{"consistency", "consist"}, {"consistently", "consist"}, {"consolation", "consol"},
+		{"consolatory", "consolatori"}, {"consolidate", "consolid"}, {"consolingly", "consol"},
+		{"consolers", "consol"}, {"conspicuous", "conspicu"}, {"conspiracy", "conspiraci"},
+		{"conspirators", "conspir"}, {"constable", "constabl"}, {"constancy", "constanc"},
+		{"knackeries", "knackeri"}, {"kneaded", "knead"}, {"knightly", "knight"}, {"knitted", "knit"},
+		{"knitting", "knit"}, {"knives", "knive"}, {"knocker", "knocker"},
+		{"generously", "generous"}, {"generate", "generat"}, {"generated", "generat"},
+		{"general", "general"}, {"generic", "generic"}, {"arsenal", "arsenal"},
+		{"cried", "cri"}, {"ties", "tie"}, {"gas", "gas"}, {"gaps", "gap"}, {"kiwis", "kiwi"},
+		{"hopped", "hop"}, {"hoped", "hope"}, {"luxuriating", "luxuri"}, {"abbey", "abbey"},
+		{"gently", "gentl"}, {"singly", "singl"}, {"early", "earli"}, {"only", "onli"}, {"ugly", "ugli"},
+		// exceptions
+		{"skies", "sky"}, {"sky", "sky"}, {"dying", "die"}, {"lying", "lie"}, {"tying", "tie"},
+		{"idly", "idl"}, {"news", "news"}, {"howe", "howe"}, {"atlas", "atlas"}, {"cosmos", "cosmos"},
+		{"bias", "bias"}, {"andes", "andes"}, {"innings", "inning"}, {"outing", "outing"},
+		{"canning", "canning"}, {"herring", "herring"}, {"earring", "earring"},
+		{"proceed", "proceed"}, {"exceed", "exceed"}, {"succeed", "succeed"}, {"succeeding", "succeed"},
+		// too short to stem
+		{"'s", "'s"},
+	}
+	for _, test := range tests {
+		if stem := Porter2Stem(test.word); stem != test.stem {
+			t.Errorf("Porter2Stem(%q) = %q, want %q", test.word, stem, test.stem)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package analysis
+
+import "testing"
+
+// TestPorterStem checks words from the examples of Porter's paper and the vocabulary of his reference
+// implementation against its output.
+func TestPorterStem(t *testing.T) {
+	tests := []struct {
+		word, stem string
+	}{
+		// step 1a
+		{"caresses", "caress"}, {"ponies", "poni"}, {"ties", "ti"}, {"caress", "caress"}, {"cats", "cat"},
+		// step 1b
+		{"feed", "feed"}, {"agreed", "agre"}, {"plastered", "plaster"}, {"bled", "bled"}, {"motoring", "motor"},
+		{"sing", "sing"}, {"conflated", "conflat"}, {"troubled", "troubl"}, {"sized", "size"},
+		{"hopping", "hop"}, {"tanned", "tan"}, {"falling", "fall"}, {"hissing", "hiss"}, {"fizzed", "fizz"},
+		{"failing", "fail"}, {"filing", "file"},
+		// step 1c
+		{"happy", "happi"}, {"sky", "sky"},
+		// step 2
+		{"relational", "relat"}, {"conditional", "condit"}, {"rational", "ration"}, {"valenci", "valenc"},
+		{"hesitanci", "hesit"}, {"digitizer", "digit"}, {"conformabli", "conform"}, {"radicalli", "radic"},
+		{"differentli", "differ"}, {"vileli", "vile"}, {"analogousli", "analog"}, {"vietnamization", "vietnam"},
+		{"predication", "predic"}, {"operator", "oper"}, {"feudalism", "feudal"}, {"decisiveness", "decis"},
+		{"hopefulness", "hope"}, {"callousness", "callous"}, {"formaliti", "formal"}, {"sensitiviti", "sensit"},
+		{"sensibiliti", "sensibl"},
+		// step 3
+		{"triplicate", "triplic"}, {"formative", "form"}, {"formalize", "formal"}, {"electriciti", "electr"},
+		{"electrical", "electr"}, {"hopeful", "hope"}, {"goodness", "good"},
+		// step 4
+		{"revival", "reviv"}, {"allowance", "allow"}, {"inference", "infer"}, {"airliner", "airlin"},
+		{"gyroscopic", "gyroscop"}, {"adjustable", "adjust"}, {"defensible", "defens"}, {"irritant", "irrit"},
+		{"replacement", "replac"}, {"adjustment", "adjust"}, {"dependent", "depend"}, {"adoption", "adopt"},
+		{"homologou", "homolog"}, {"communism", "commun"}, {"activate", "activ"}, {"angulariti", "angular"},
+		{"homologous", "homolog"}, {"effective", "effect"}, {"bowdlerize", "bowdler"},
+		// step 5
+		{"probate", "probat"}, {"rate", "rate"}, {"cease", "ceas"}, {"controll", "control"}, {"roll", "roll"},
+		// several steps
+		{"generalization", "gener"}, {"oscillators", "oscil"},
+		// too short to stem
+		{"is", "is"}, {"as", "as"},
+	}
+	for _, test := range tests {
+		if stem := PorterStem(test.word); stem != test.stem {
+			t.Errorf("PorterStem(%q) = %q, want %q", test.word, stem, test.stem)
+		}
+	}
+}
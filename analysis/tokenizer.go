@@ -0,0 +1,72 @@
+package analysis
+
+import (
+	"iter"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Tokenize yields the tokens of text, approximating the word boundaries of Unicode text segmentation
+// (UAX #29) used by Lucene's StandardTokenizer:
+//   - a token is a run of letters, digits and combining marks;
+//   - an apostrophe or full stop between two letters, or a full stop or comma between two digits, joins
+//     its neighbours, so "don't", "U.S.A" and "3.14" are single tokens;
+//   - each ideographic, Hiragana or Katakana character is a token of its own, although UAX #29 keeps a
+//     run of Katakana together as one word.
+func Tokenize(text string) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		start := -1
+		var previous rune
+		for offset, character := range text {
+			switch {
+			case isIdeographic(character):
+				if start >= 0 && !yield(text[start:offset]) {
+					return
+				}
+				start = -1
+				if !yield(text[offset : offset+utf8.RuneLen(character)]) {
+					return
+				}
+			case isWordCharacter(character):
+				if start < 0 {
+					start = offset
+				}
+			case start >= 0 && joinsWord(previous, character, text[offset+utf8.RuneLen(character):]):
+			default:
+				if start >= 0 && !yield(text[start:offset]) {
+					return
+				}
+				start = -1
+			}
+			previous = character
+		}
+		if start >= 0 {
+			yield(text[start:])
+		}
+	}
+}
+
+func isWordCharacter(character rune) bool {
+	return unicode.IsLetter(character) || unicode.IsDigit(character) || unicode.IsMark(character)
+}
+
+func isIdeographic(character rune) bool {
+	return unicode.Is(unicode.Han, character) || unicode.Is(unicode.Hiragana, character) || unicode.Is(unicode.Katakana, character)
+}
+
+// joinsWord reports whether the punctuation character, following previous and followed by rest, is
+// inside a word rather than between two.
+func joinsWord(previous rune, character rune, rest string) bool {
+	next, _ := utf8.DecodeRuneInString(rest)
+	switch character {
+	case '\'', '’', '.':
+		if unicode.IsLetter(previous) && unicode.IsLetter(next) {
+			return true
+		}
+	}
+	switch character {
+	case '.', ',':
+		return unicode.IsDigit(previous) && unicode.IsDigit(next)
+	}
+	return false
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/Axiomatic314/ciffTools/analysis"
+	"github.com/Axiomatic314/ciffTools/index"
+)
+
+// collectionFiles returns collectionPath if it is a file, or every file below it in lexical order if it
+// is a directory.
+func collectionFiles(collectionPath string) ([]string, error) {
+	info, err := os.Stat(collectionPath)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{collectionPath}, nil
+	}
+	files := make([]string, 0)
+	err = filepath.WalkDir(collectionPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if entry.Type().IsRegular() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// addCollectionFile adds the documents of one collection file to builder, decompressing it if it ends
+// in .gz.
+func addCollectionFile(builder *index.Builder, path string, format string) error {
+	fileHandle, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer fileHandle.Close()
+	var reader io.Reader = fileHandle
+	if strings.HasSuffix(path, ".gz") {
+		gzipReader, err := gzip.NewReader(fileHandle)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		defer gzipReader.Close()
+		reader = gzipReader
+	}
+	documents, err := index.ReadCollection(reader, format)
+	if err != nil {
+		return err
+	}
+	err = builder.AddDocuments(documents)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
+
+func buildCommand(arguments []string) int {
+	flags := flag.NewFlagSet("build", flag.ExitOnError)
+	collectionPath := flags.String("collectionPath", "", "filepath of the collection to index, or a directory of collection files. Files ending in .gz are decompressed.")
+	collectionFormat := flags.String("collectionFormat", "trec", fmt.Sprintf("Format of the collection, one of %v.", index.CollectionFormats))
+	analyzerSpec := flags.String("analyzer", "lowercase", fmt.Sprintf("Comma separated filters applied to each token, from %v, or a preset from %v. Recorded in the header description.", analysis.FilterNames, slices.Sorted(maps.Keys(analysis.Presets))))
+	outputCiffFilePath := flags.String("outputCiffFilePath", "", "filepath of the CIFF file to write. Any existing file is overwritten!")
+	description := flags.String("description", fmt.Sprintf("ciffTools %s", toolVersion()), "Description written to the header.")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to analyse and encode with. The output does not depend on it.")
+	flags.Parse(arguments)
+
+	if *collectionPath == "" {
+		fmt.Println("Please provide a collection!")
+		return 1
+	}
+	if *outputCiffFilePath == "" {
+		fmt.Println("Please provide an output CIFF file!")
+		return 1
+	}
+	if !slices.Contains(index.CollectionFormats, *collectionFormat) {
+		fmt.Printf("Unknown collection format %q, expected one of %v!\n", *collectionFormat, index.CollectionFormats)
+		return 1
+	}
+	analyzer, err := analysis.New(*analyzerSpec)
+	if err != nil {
+		slog.Error("error creating analyzer", "error", err)
+		return 1
+	}
+	slog.Info("analyzer", "spec", analyzer.Spec())
+
+	files, err := collectionFiles(*collectionPath)
+	if err != nil {
+		slog.Error("error listing collection", "error", err)
+		return 1
+	}
+	builder := index.NewBuilder(analyzer, *workers)
+	for fileIndex, file := range files {
+		slog.Info(fmt.Sprintf("indexing file %d/%d", fileIndex+1, len(files)), "file", file, "docs", builder.NumDocs())
+		err = addCollectionFile(builder, file, *collectionFormat)
+		if err != nil {
+			slog.Error("error indexing collection", "error", err)
+			return 1
+		}
+	}
+
+	header := builder.Header(analyzer.AppendTo(*description))
+	slog.Info("indexed collection", "docs", header.NumDocs, "terms", header.NumPostingsLists, "totalTerms", header.TotalTermsInCollection)
+	ciffWriter := CiffWriter{writeCiff: true, ciffFilePath: *outputCiffFilePath, workers: *workers}
+	err = ciffWriter.WriteCiff(header, builder.PostingsLists(), builder.DocRecords())
+	if err != nil {
+		return 1
+	}
+	slog.Info("complete")
+	return 0
+}
+
+// analyzeCommand prints the terms of each line of its input, to compare analyzers.
+func analyzeCommand(arguments []string) int {
+	flags := flag.NewFlagSet("analyze", flag.ExitOnError)
+	analyzerSpec := flags.String("analyzer", "lowercase", fmt.Sprintf("Comma separated filters applied to each token, from %v, or a preset from %v.", analysis.FilterNames, slices.Sorted(maps.Keys(analysis.Presets))))
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of a CIFF built by the build command. If given, the analyzer recorded in its header is used instead of -analyzer.")
+	flags.Parse(arguments)
+
+	var analyzer *analysis.Analyzer
+	var err error
+	if *ciffFilePath != "" {
+		var ciffReader ciffFile
+		ciffReader, err = openCiff(*ciffFilePath, 1)
+		if err != nil {
+			slog.Error("error opening ciff", "error", err)
+			return 1
+		}
+		analyzer, err = analysis.FromDescription(ciffReader.Header().Description)
+		ciffReader.Close()
+	} else {
+		analyzer, err = analysis.New(*analyzerSpec)
+	}
+	if err != nil {
+		slog.Error("error creating analyzer", "error", err)
+		return 1
+	}
+
+	var input io.Reader = os.Stdin
+	if flags.NArg() > 0 {
+		input = strings.NewReader(strings.Join(flags.Args(), " "))
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxDumpLineLength)
+	for scanner.Scan() {
+		fmt.Println(strings.Join(analyzer.Analyze(scanner.Text()), " "))
+	}
+	if scanner.Err() != nil {
+		slog.Error("error reading input", "error", scanner.Err())
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,69 @@
+package ciffio
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Section identifies one of the three parts of a CIFF stream.
+type Section int
+
+const (
+	SectionHeader Section = iota
+	SectionPostingsLists
+	SectionDocRecords
+)
+
+func (section Section) String() string {
+	switch section {
+	case SectionHeader:
+		return "header"
+	case SectionPostingsLists:
+		return "postings lists"
+	case SectionDocRecords:
+		return "doc records"
+	}
+	return fmt.Sprintf("Section(%d)", int(section))
+}
+
+var (
+	// ErrCorruptFrame is returned when a message length prefix cannot be decoded.
+	ErrCorruptFrame = errors.New("corrupt message length")
+	// ErrOutOfOrder is returned when a section is read or written before the previous one is complete.
+	ErrOutOfOrder = errors.New("message out of order")
+	// ErrTooManyMessages is returned when writing more messages than the header declares.
+	ErrTooManyMessages = errors.New("more messages than the header declares")
+	// ErrDfMismatch is returned when a postings list's df does not match its number of postings.
+	ErrDfMismatch = errors.New("df does not match the number of postings")
+	// ErrDocidOrder is returned when the docids of a postings list are not strictly increasing.
+	ErrDocidOrder = errors.New("docids are not strictly increasing")
+	// ErrDocidRange is returned when a posting or doc record has a docid outside [0, Header.NumDocs).
+	ErrDocidRange = errors.New("docid out of range")
+)
+
+// MessageError records which message of a CIFF stream could not be read or written.
+type MessageError struct {
+	Section Section
+	Index   int64 // index of the message within its section
+	Offset  int64 // byte offset of the message's length prefix
+	Err     error
+}
+
+func (err *MessageError) Error() string {
+	return fmt.Sprintf("ciffio: %s message %d at offset %d: %v", err.Section, err.Index, err.Offset, err.Err)
+}
+
+func (err *MessageError) Unwrap() error {
+	return err.Err
+}
+
+// CountError is returned when a section holds fewer messages than the header declares.
+type CountError struct {
+	Section  Section
+	Expected int64
+	Actual   int64
+}
+
+func (err *CountError) Error() string {
+	return fmt.Sprintf("ciffio: header declares %d %s, got %d", err.Expected, err.Section, err.Actual)
+}
@@ -0,0 +1,46 @@
+package ciffio
+
+import (
+	"io"
+	"iter"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+)
+
+// PostingsLists iterates over the remaining postings lists with absolute docids. Iteration stops after
+// the last postings list or the first error, which is yielded with a nil postings list.
+func (reader *Reader) PostingsLists() iter.Seq2[*ciff.PostingsList, error] {
+	return func(yield func(*ciff.PostingsList, error) bool) {
+		for {
+			postingsList, err := reader.ReadPostingsList()
+			if err == io.EOF {
+				return
+			}
+			if !yield(postingsList, err) || err != nil {
+				return
+			}
+		}
+	}
+}
+
+// DocRecords iterates over the remaining doc records, skipping any postings lists that have not been
+// read yet. Iteration stops after the last doc record or the first error, which is yielded with a nil
+// doc record.
+func (reader *Reader) DocRecords() iter.Seq2[*ciff.DocRecord, error] {
+	return func(yield func(*ciff.DocRecord, error) bool) {
+		err := reader.SkipPostingsLists()
+		if err != nil {
+			yield(nil, err)
+			return
+		}
+		for {
+			docRecord, err := reader.ReadDocRecord()
+			if err == io.EOF {
+				return
+			}
+			if !yield(docRecord, err) || err != nil {
+				return
+			}
+		}
+	}
+}
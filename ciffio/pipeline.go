@@ -0,0 +1,200 @@
+package ciffio
+
+import (
+	"io"
+	"sync"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"google.golang.org/protobuf/proto"
+)
+
+// pipelinedMessage is a message after the header travelling through a pipeline. done is closed once
+// the message has been decoded or encoded.
+type pipelinedMessage struct {
+	index        int64 // index among every message after the header
+	offset       int64
+	nextOffset   int64
+	frame        []byte
+	postingsList *ciff.PostingsList
+	docRecord    *ciff.DocRecord
+	err          error
+	done         chan struct{}
+}
+
+// readPipeline frames messages on one goroutine, unmarshals them on a pool of workers and hands them
+// back in their original order.
+type readPipeline struct {
+	ordered   chan *pipelinedMessage
+	stop      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewPipelinedReader is NewReader with the messages after the header decoded ahead of time on workers
+// goroutines. Close must be called if the stream is not read to the end.
+func NewPipelinedReader(r io.Reader, workers int) (*Reader, error) {
+	reader, err := NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	workers = max(workers, 1)
+	pipeline := &readPipeline{
+		ordered: make(chan *pipelinedMessage, 4*workers),
+		stop:    make(chan struct{}),
+	}
+	jobs := make(chan *pipelinedMessage, 4*workers)
+	numPostingsLists := int64(reader.header.NumPostingsLists)
+	numMessages := numPostingsLists + int64(reader.header.NumDocs)
+
+	//frame
+	go func() {
+		defer close(pipeline.ordered)
+		defer close(jobs)
+		for index := range numMessages {
+			message := &pipelinedMessage{index: index, offset: reader.frames.offset, done: make(chan struct{})}
+			frame, err := reader.frames.readFrame()
+			message.frame, message.err = frame, err
+			message.nextOffset = reader.frames.offset
+			if err != nil {
+				close(message.done)
+			} else {
+				select {
+				case jobs <- message:
+				case <-pipeline.stop:
+					return
+				}
+			}
+			select {
+			case pipeline.ordered <- message:
+			case <-pipeline.stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	//unmarshal
+	for range workers {
+		go func() {
+			for message := range jobs {
+				if message.index < numPostingsLists {
+					message.postingsList, message.err = decodePostingsList(message.frame, reader.header.NumDocs)
+				} else {
+					message.docRecord, message.err = decodeDocRecord(message.frame, reader.header.NumDocs)
+				}
+				message.frame = nil
+				close(message.done)
+			}
+		}()
+	}
+
+	reader.pipeline = pipeline
+	return reader, nil
+}
+
+func (pipeline *readPipeline) next() (*pipelinedMessage, error) {
+	message, ok := <-pipeline.ordered
+	if !ok {
+		return nil, io.ErrUnexpectedEOF
+	}
+	<-message.done
+	return message, message.err
+}
+
+func (pipeline *readPipeline) close() {
+	pipeline.closeOnce.Do(func() {
+		close(pipeline.stop)
+	})
+}
+
+// writePipeline marshals messages on a pool of workers and writes them in their original order from a
+// single goroutine.
+type writePipeline struct {
+	jobs     chan *pipelinedMessage
+	ordered  chan *pipelinedMessage
+	finished chan struct{}
+	mutex    sync.Mutex
+	err      error
+}
+
+// NewPipelinedWriter is NewWriter with the messages after the header marshalled on workers goroutines.
+// Messages passed to the Writer must not be modified until Close returns. Errors writing a message may
+// only be reported by a later call or by Close, and carry an Offset of -1.
+func NewPipelinedWriter(w io.Writer, header *ciff.Header, workers int) (*Writer, error) {
+	writer, err := NewWriter(w, header)
+	if err != nil {
+		return nil, err
+	}
+	workers = max(workers, 1)
+	pipeline := &writePipeline{
+		jobs:     make(chan *pipelinedMessage, 4*workers),
+		ordered:  make(chan *pipelinedMessage, 4*workers),
+		finished: make(chan struct{}),
+	}
+
+	//marshal
+	for range workers {
+		go func() {
+			for message := range pipeline.jobs {
+				if message.postingsList != nil {
+					message.frame = appendPostingsList(nil, message.postingsList)
+				} else {
+					message.frame, message.err = proto.Marshal(message.docRecord)
+				}
+				close(message.done)
+			}
+		}()
+	}
+
+	//write
+	go func() {
+		defer close(pipeline.finished)
+		for message := range pipeline.ordered {
+			<-message.done
+			if pipeline.failed() != nil {
+				continue
+			}
+			err := message.err
+			if err == nil {
+				err = writer.writeFrame(message.frame)
+			}
+			if err != nil {
+				section, index := SectionPostingsLists, message.index
+				if message.docRecord != nil {
+					section, index = SectionDocRecords, index-int64(header.NumPostingsLists)
+				}
+				pipeline.fail(&MessageError{Section: section, Index: index, Offset: -1, Err: err})
+			}
+		}
+	}()
+
+	writer.pipeline = pipeline
+	return writer, nil
+}
+
+func (pipeline *writePipeline) send(message *pipelinedMessage) {
+	message.done = make(chan struct{})
+	pipeline.jobs <- message
+	pipeline.ordered <- message
+}
+
+// finish waits for every message to be written.
+func (pipeline *writePipeline) finish() error {
+	close(pipeline.jobs)
+	close(pipeline.ordered)
+	<-pipeline.finished
+	return pipeline.failed()
+}
+
+func (pipeline *writePipeline) fail(err error) {
+	pipeline.mutex.Lock()
+	defer pipeline.mutex.Unlock()
+	pipeline.err = err
+}
+
+func (pipeline *writePipeline) failed() error {
+	pipeline.mutex.Lock()
+	defer pipeline.mutex.Unlock()
+	return pipeline.err
+}
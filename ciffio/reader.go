@@ -0,0 +1,309 @@
+// Package ciffio reads and writes Common Index File Format streams.
+//
+// A CIFF stream is a Header followed by exactly Header.NumPostingsLists postings lists and then exactly
+// Header.NumDocs doc records, each written as a varint length prefixed protobuf message. Docids in
+// postings lists are stored as d-gaps; Reader and Writer convert to and from absolute docids. Reader
+// rejects docids outside [0, Header.NumDocs) with ErrDocidRange, so they can safely index the doc records.
+package ciffio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Reader yields the header, then the postings lists one at a time, then the doc records of a CIFF stream.
+type Reader struct {
+	frames            *frameReader
+	header            *ciff.Header
+	offset            int64 // offset of the next message to be returned
+	postingsListsRead int64
+	docRecordsRead    int64
+	pipeline          *readPipeline // set by NewPipelinedReader
+}
+
+// NewReader reads the header from r and returns a Reader positioned at the first postings list.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{frames: newFrameReader(r)}
+	header := &ciff.Header{}
+	offset := reader.offset
+	err := reader.readMessage(header)
+	if err != nil {
+		return nil, &MessageError{Section: SectionHeader, Offset: offset, Err: err}
+	}
+	reader.header = header
+	return reader, nil
+}
+
+// frameReader splits a stream into length prefixed messages, tracking the offset of the next one.
+type frameReader struct {
+	reader *bufio.Reader
+	offset int64
+}
+
+func newFrameReader(r io.Reader) *frameReader {
+	return &frameReader{reader: bufio.NewReaderSize(r, 1<<16)}
+}
+
+func (reader *Reader) Header() *ciff.Header {
+	return reader.header
+}
+
+// Offset returns the byte offset of the next message.
+func (reader *Reader) Offset() int64 {
+	return reader.offset
+}
+
+// ReadPostingsList returns the next postings list with absolute docids, or io.EOF once every postings
+// list declared by the header has been read.
+func (reader *Reader) ReadPostingsList() (*ciff.PostingsList, error) {
+	if reader.postingsListsRead >= int64(reader.header.NumPostingsLists) {
+		return nil, io.EOF
+	}
+	index, offset := reader.postingsListsRead, reader.offset
+	var postingsList *ciff.PostingsList
+	var err error
+	if reader.pipeline != nil {
+		var message *pipelinedMessage
+		message, err = reader.pipeline.next()
+		if message != nil {
+			postingsList, reader.offset = message.postingsList, message.nextOffset
+		}
+	} else {
+		postingsList, err = reader.decodePostingsList()
+	}
+	if err != nil {
+		return nil, &MessageError{Section: SectionPostingsLists, Index: index, Offset: offset, Err: err}
+	}
+	reader.postingsListsRead++
+	return postingsList, nil
+}
+
+func (reader *Reader) decodePostingsList() (*ciff.PostingsList, error) {
+	byteBuffer, err := reader.readFrame()
+	if err != nil {
+		return nil, err
+	}
+	return decodePostingsList(byteBuffer, reader.header.NumDocs)
+}
+
+// decodePostingsList decodes a postings list to absolute docids, which must lie in [0, numDocs) so they
+// can index the doc records.
+func decodePostingsList(byteBuffer []byte, numDocs int32) (*ciff.PostingsList, error) {
+	postingsList := &ciff.PostingsList{}
+	err := proto.Unmarshal(byteBuffer, postingsList)
+	if err != nil {
+		return nil, err
+	}
+	if postingsList.Df != int64(len(postingsList.Postings)) {
+		return nil, ErrDfMismatch
+	}
+	// Sum the d-gaps in 64 bits, so a corrupt gap cannot wrap back into range
+	docid := int64(0)
+	for postingIndex, posting := range postingsList.Postings {
+		docid += int64(posting.Docid)
+		if docid < 0 || docid >= int64(numDocs) {
+			return nil, fmt.Errorf("%w: term %q posting %d has docid %d, outside [0, %d)", ErrDocidRange, postingsList.Term, postingIndex, docid, numDocs)
+		}
+		posting.Docid = int32(docid)
+	}
+	return postingsList, nil
+}
+
+// decodeDocRecord decodes a doc record, whose docid must lie in [0, numDocs).
+func decodeDocRecord(byteBuffer []byte, numDocs int32) (*ciff.DocRecord, error) {
+	docRecord := &ciff.DocRecord{}
+	err := proto.Unmarshal(byteBuffer, docRecord)
+	if err != nil {
+		return nil, err
+	}
+	if docRecord.Docid < 0 || docRecord.Docid >= numDocs {
+		return nil, fmt.Errorf("%w: doc record has docid %d, outside [0, %d)", ErrDocidRange, docRecord.Docid, numDocs)
+	}
+	return docRecord, nil
+}
+
+// SkipPostingsList discards the next postings list without decoding it.
+func (reader *Reader) SkipPostingsList() error {
+	if reader.postingsListsRead >= int64(reader.header.NumPostingsLists) {
+		return io.EOF
+	}
+	if reader.pipeline != nil {
+		_, err := reader.ReadPostingsList()
+		return err
+	}
+	index, offset := reader.postingsListsRead, reader.offset
+	_, err := reader.readFrame()
+	if err != nil {
+		return &MessageError{Section: SectionPostingsLists, Index: index, Offset: offset, Err: err}
+	}
+	reader.postingsListsRead++
+	return nil
+}
+
+// ReadTerm returns the term of the next postings list, discarding its postings without decoding them.
+func (reader *Reader) ReadTerm() (string, error) {
+	if reader.postingsListsRead >= int64(reader.header.NumPostingsLists) {
+		return "", io.EOF
+	}
+	if reader.pipeline != nil {
+		postingsList, err := reader.ReadPostingsList()
+		if err != nil {
+			return "", err
+		}
+		return postingsList.Term, nil
+	}
+	index, offset := reader.postingsListsRead, reader.offset
+	frame, err := reader.readFrame()
+	term := ""
+	if err == nil {
+		term, err = decodeTerm(frame)
+	}
+	if err != nil {
+		return "", &MessageError{Section: SectionPostingsLists, Index: index, Offset: offset, Err: err}
+	}
+	reader.postingsListsRead++
+	return term, nil
+}
+
+// decodeTerm returns the term field of an encoded postings list.
+func decodeTerm(byteBuffer []byte) (string, error) {
+	term := ""
+	for len(byteBuffer) > 0 {
+		number, wireType, length := protowire.ConsumeTag(byteBuffer)
+		if length < 0 {
+			return "", protowire.ParseError(length)
+		}
+		byteBuffer = byteBuffer[length:]
+		if number == 1 && wireType == protowire.BytesType {
+			var value []byte
+			value, length = protowire.ConsumeBytes(byteBuffer)
+			term = string(value)
+		} else {
+			length = protowire.ConsumeFieldValue(number, wireType, byteBuffer)
+		}
+		if length < 0 {
+			return "", protowire.ParseError(length)
+		}
+		byteBuffer = byteBuffer[length:]
+	}
+	return term, nil
+}
+
+// ReadDocRecord returns the next doc record, or io.EOF once every doc record declared by the header has
+// been read. All postings lists must have been read or skipped first.
+func (reader *Reader) ReadDocRecord() (*ciff.DocRecord, error) {
+	if reader.docRecordsRead >= int64(reader.header.NumDocs) {
+		return nil, io.EOF
+	}
+	index, offset := reader.docRecordsRead, reader.offset
+	if reader.postingsListsRead < int64(reader.header.NumPostingsLists) {
+		return nil, &MessageError{Section: SectionDocRecords, Index: index, Offset: offset, Err: ErrOutOfOrder}
+	}
+	var docRecord *ciff.DocRecord
+	var err error
+	if reader.pipeline != nil {
+		var message *pipelinedMessage
+		message, err = reader.pipeline.next()
+		if message != nil {
+			docRecord, reader.offset = message.docRecord, message.nextOffset
+		}
+	} else {
+		var byteBuffer []byte
+		byteBuffer, err = reader.readFrame()
+		if err == nil {
+			docRecord, err = decodeDocRecord(byteBuffer, reader.header.NumDocs)
+		}
+	}
+	if err != nil {
+		return nil, &MessageError{Section: SectionDocRecords, Index: index, Offset: offset, Err: err}
+	}
+	reader.docRecordsRead++
+	return docRecord, nil
+}
+
+// SkipPostingsLists discards every remaining postings list, leaving the reader at the first doc record.
+func (reader *Reader) SkipPostingsLists() error {
+	for {
+		err := reader.SkipPostingsList()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close stops the goroutines of a pipelined reader that has not been read to the end. It does not close
+// the underlying reader.
+func (reader *Reader) Close() error {
+	if reader.pipeline != nil {
+		reader.pipeline.close()
+	}
+	return nil
+}
+
+func (reader *Reader) readMessage(messageStruct proto.Message) error {
+	byteBuffer, err := reader.readFrame()
+	if err != nil {
+		return err
+	}
+	return proto.Unmarshal(byteBuffer, messageStruct)
+}
+
+func (reader *Reader) readFrame() ([]byte, error) {
+	byteBuffer, err := reader.frames.readFrame()
+	reader.offset = reader.frames.offset
+	return byteBuffer, err
+}
+
+func (frames *frameReader) readFrame() ([]byte, error) {
+	sizeBuffer, err := frames.reader.Peek(binary.MaxVarintLen64)
+	if len(sizeBuffer) == 0 {
+		if err == io.EOF {
+			return nil, io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	messageSize, bytesRead := binary.Uvarint(sizeBuffer)
+	if bytesRead == 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	if bytesRead < 0 || messageSize > math.MaxInt32 {
+		return nil, ErrCorruptFrame
+	}
+	frames.reader.Discard(bytesRead)
+	frames.offset += int64(bytesRead)
+
+	byteBuffer := make([]byte, messageSize)
+	bytesRead, err = io.ReadFull(frames.reader, byteBuffer)
+	frames.offset += int64(bytesRead)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+	return byteBuffer, nil
+}
+
+// DecodeDGaps converts the d-gap encoded docids of a postings list to absolute docids in place.
+func DecodeDGaps(postings []*ciff.Posting) {
+	for postingsIndex := 1; postingsIndex < len(postings); postingsIndex++ {
+		postings[postingsIndex].Docid += postings[postingsIndex-1].Docid
+	}
+}
+
+// EncodeDGaps converts the absolute docids of a postings list to d-gaps in place.
+func EncodeDGaps(postings []*ciff.Posting) {
+	for postingsIndex := len(postings) - 1; postingsIndex > 0; postingsIndex-- {
+		postings[postingsIndex].Docid -= postings[postingsIndex-1].Docid
+	}
+}
@@ -0,0 +1,352 @@
+package ciffio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"google.golang.org/protobuf/proto"
+)
+
+func marshal(t *testing.T, message proto.Message) []byte {
+	t.Helper()
+	byteBuffer, err := proto.Marshal(message)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return byteBuffer
+}
+
+// frames length prefixes each message and concatenates them into a stream.
+func frames(messages ...[]byte) []byte {
+	stream := make([]byte, 0)
+	for _, message := range messages {
+		stream = binary.AppendUvarint(stream, uint64(len(message)))
+		stream = append(stream, message...)
+	}
+	return stream
+}
+
+// writeTestCiff encodes an index with a Writer, pipelined on workers goroutines if workers is positive.
+func writeTestCiff(t *testing.T, header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord, workers int) []byte {
+	t.Helper()
+	var buffer bytes.Buffer
+	var writer *Writer
+	var err error
+	if workers > 0 {
+		writer, err = NewPipelinedWriter(&buffer, header, workers)
+	} else {
+		writer, err = NewWriter(&buffer, header)
+	}
+	if err != nil {
+		t.Fatalf("creating writer: %v", err)
+	}
+	for _, postingsList := range postingsLists {
+		err = writer.WritePostingsList(postingsList)
+		if err != nil {
+			t.Fatalf("writing postings list: %v", err)
+		}
+	}
+	for _, docRecord := range docRecords {
+		err = writer.WriteDocRecord(docRecord)
+		if err != nil {
+			t.Fatalf("writing doc record: %v", err)
+		}
+	}
+	err = writer.Close()
+	if err != nil {
+		t.Fatalf("closing writer: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+// readTestCiff decodes a whole CIFF stream with a Reader, pipelined on workers goroutines if workers is
+// positive.
+func readTestCiff(t *testing.T, encoded []byte, workers int) (*ciff.Header, []*ciff.PostingsList, []*ciff.DocRecord) {
+	t.Helper()
+	var reader *Reader
+	var err error
+	if workers > 0 {
+		reader, err = NewPipelinedReader(bytes.NewReader(encoded), workers)
+	} else {
+		reader, err = NewReader(bytes.NewReader(encoded))
+	}
+	if err != nil {
+		t.Fatalf("creating reader: %v", err)
+	}
+	defer reader.Close()
+	postingsLists := make([]*ciff.PostingsList, 0)
+	for postingsList, err := range reader.PostingsLists() {
+		if err != nil {
+			t.Fatalf("reading postings list: %v", err)
+		}
+		postingsLists = append(postingsLists, postingsList)
+	}
+	docRecords := make([]*ciff.DocRecord, 0)
+	for docRecord, err := range reader.DocRecords() {
+		if err != nil {
+			t.Fatalf("reading doc record: %v", err)
+		}
+		docRecords = append(docRecords, docRecord)
+	}
+	return reader.Header(), postingsLists, docRecords
+}
+
+func TestRoundTrip(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Small()
+	expected := writeTestCiff(t, header, postingsLists, docRecords, 0)
+	tests := []struct {
+		name          string
+		writerWorkers int
+		readerWorkers int
+	}{
+		{"sequential", 0, 0},
+		{"pipelined reader", 0, 4},
+		{"pipelined writer", 4, 0},
+		{"pipelined", 4, 4},
+		{"single worker pipelines", 1, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			encoded := writeTestCiff(t, header, postingsLists, docRecords, test.writerWorkers)
+			if !bytes.Equal(encoded, expected) {
+				t.Errorf("encoding differs from the sequential writer's")
+			}
+			readHeader, readPostingsLists, readDocRecords := readTestCiff(t, encoded, test.readerWorkers)
+			if !proto.Equal(readHeader, header) {
+				t.Errorf("header = %v, want %v", readHeader, header)
+			}
+			if !cifftest.EqualPostingsLists(readPostingsLists, postingsLists) {
+				t.Errorf("postings lists = %v, want %v", readPostingsLists, postingsLists)
+			}
+			if !cifftest.EqualDocRecords(readDocRecords, docRecords) {
+				t.Errorf("doc records = %v, want %v", readDocRecords, docRecords)
+			}
+		})
+	}
+}
+
+func TestWriterEncodesLikeProto(t *testing.T) {
+	_, postingsLists, _ := cifftest.Small()
+	for _, postingsList := range postingsLists {
+		gaps := proto.Clone(postingsList).(*ciff.PostingsList)
+		EncodeDGaps(gaps.Postings)
+		expected, err := proto.Marshal(gaps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		encoded := appendPostingsList(nil, postingsList)
+		if !bytes.Equal(encoded, expected) {
+			t.Errorf("%s: appendPostingsList = %x, proto.Marshal = %x", postingsList.Term, encoded, expected)
+		}
+	}
+}
+
+func TestPipelinesKeepOrder(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 1000, 300, 20)
+	expected := writeTestCiff(t, header, postingsLists, docRecords, 0)
+	for _, workers := range []int{1, 2, 3, 8, 32} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			encoded := writeTestCiff(t, header, postingsLists, docRecords, workers)
+			if !bytes.Equal(encoded, expected) {
+				t.Fatalf("pipelined writer output differs from the sequential writer's")
+			}
+			_, readPostingsLists, readDocRecords := readTestCiff(t, encoded, workers)
+			if !cifftest.EqualPostingsLists(readPostingsLists, postingsLists) {
+				t.Errorf("postings lists read out of order or altered")
+			}
+			if !cifftest.EqualDocRecords(readDocRecords, docRecords) {
+				t.Errorf("doc records read out of order or altered")
+			}
+		})
+	}
+}
+
+func TestPipelinedReaderStopsEarly(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 500, 100, 5)
+	encoded := writeTestCiff(t, header, postingsLists, docRecords, 0)
+	reader, err := NewPipelinedReader(bytes.NewReader(encoded), 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		_, err = reader.ReadPostingsList()
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = reader.Close()
+	if err != nil {
+		t.Errorf("Close = %v", err)
+	}
+}
+
+func TestDGaps(t *testing.T) {
+	tests := []struct {
+		name     string
+		absolute []int32
+		gaps     []int32
+	}{
+		{"empty", []int32{}, []int32{}},
+		{"single", []int32{7}, []int32{7}},
+		{"from zero", []int32{0, 1, 2, 3}, []int32{0, 1, 1, 1}},
+		{"sparse", []int32{3, 10, 11, 100}, []int32{3, 7, 1, 89}},
+	}
+	postingsOf := func(docids []int32) []*ciff.Posting {
+		postings := make([]*ciff.Posting, len(docids))
+		for postingIndex, docid := range docids {
+			postings[postingIndex] = &ciff.Posting{Docid: docid, Tf: 1}
+		}
+		return postings
+	}
+	docidsOf := func(postings []*ciff.Posting) []int32 {
+		docids := make([]int32, len(postings))
+		for postingIndex, posting := range postings {
+			docids[postingIndex] = posting.Docid
+		}
+		return docids
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			postings := postingsOf(test.absolute)
+			EncodeDGaps(postings)
+			if got := docidsOf(postings); fmt.Sprint(got) != fmt.Sprint(test.gaps) {
+				t.Errorf("EncodeDGaps(%v) = %v, want %v", test.absolute, got, test.gaps)
+			}
+			DecodeDGaps(postings)
+			if got := docidsOf(postings); fmt.Sprint(got) != fmt.Sprint(test.absolute) {
+				t.Errorf("DecodeDGaps(%v) = %v, want %v", test.gaps, got, test.absolute)
+			}
+		})
+	}
+}
+
+func TestReaderErrors(t *testing.T) {
+	header, _, docRecords := cifftest.Small()
+	header.NumPostingsLists, header.TotalPostingsLists = 1, 1
+	tests := []struct {
+		name          string
+		postingsList  []byte
+		docRecords    []*ciff.DocRecord
+		section       Section
+		expectedError error
+	}{
+		{
+			"posting docid beyond num docs",
+			appendPostingsList(nil, &ciff.PostingsList{Term: "a", Df: 1, Cf: 1, Postings: []*ciff.Posting{{Docid: 3, Tf: 1}}}),
+			docRecords, SectionPostingsLists, ErrDocidRange,
+		},
+		{
+			"negative posting docid",
+			appendPostingsList(nil, &ciff.PostingsList{Term: "a", Df: 1, Cf: 1, Postings: []*ciff.Posting{{Docid: -1, Tf: 1}}}),
+			docRecords, SectionPostingsLists, ErrDocidRange,
+		},
+		{
+			"df mismatch",
+			appendPostingsList(nil, &ciff.PostingsList{Term: "a", Df: 2, Cf: 1, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}}}),
+			docRecords, SectionPostingsLists, ErrDfMismatch,
+		},
+		{
+			"doc record docid beyond num docs",
+			appendPostingsList(nil, &ciff.PostingsList{Term: "a", Df: 1, Cf: 1, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}}}),
+			[]*ciff.DocRecord{docRecords[0], docRecords[1], {Docid: 3, CollectionDocid: "doc-d", Doclength: 3}},
+			SectionDocRecords, ErrDocidRange,
+		},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{0, 2} {
+			t.Run(fmt.Sprintf("%s/%d workers", test.name, workers), func(t *testing.T) {
+				messages := [][]byte{marshal(t, header), test.postingsList}
+				for _, docRecord := range test.docRecords {
+					messages = append(messages, marshal(t, docRecord))
+				}
+				encoded := frames(messages...)
+				var reader *Reader
+				var err error
+				if workers > 0 {
+					reader, err = NewPipelinedReader(bytes.NewReader(encoded), workers)
+				} else {
+					reader, err = NewReader(bytes.NewReader(encoded))
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer reader.Close()
+				for _, err = range reader.PostingsLists() {
+				}
+				if err == nil {
+					for _, err = range reader.DocRecords() {
+					}
+				}
+				var messageError *MessageError
+				if !errors.As(err, &messageError) || !errors.Is(err, test.expectedError) {
+					t.Fatalf("error = %v, want a MessageError wrapping %v", err, test.expectedError)
+				}
+				if messageError.Section != test.section {
+					t.Errorf("error section = %v, want %v", messageError.Section, test.section)
+				}
+			})
+		}
+	}
+}
+
+func TestWriterErrors(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Small()
+	tests := []struct {
+		name          string
+		write         func(writer *Writer) error
+		expectedError error
+	}{
+		{"df mismatch", func(writer *Writer) error {
+			return writer.WritePostingsList(&ciff.PostingsList{Term: "a", Df: 2, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}}})
+		}, ErrDfMismatch},
+		{"docids out of order", func(writer *Writer) error {
+			return writer.WritePostingsList(&ciff.PostingsList{Term: "a", Df: 2, Postings: []*ciff.Posting{{Docid: 1, Tf: 1}, {Docid: 1, Tf: 1}}})
+		}, ErrDocidOrder},
+		{"doc record before postings lists", func(writer *Writer) error {
+			return writer.WriteDocRecord(docRecords[0])
+		}, ErrOutOfOrder},
+		{"too many postings lists", func(writer *Writer) error {
+			for _, postingsList := range postingsLists {
+				err := writer.WritePostingsList(postingsList)
+				if err != nil {
+					return err
+				}
+			}
+			return writer.WritePostingsList(postingsLists[0])
+		}, ErrTooManyMessages},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			writer, err := NewWriter(io.Discard, header)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = test.write(writer)
+			if !errors.Is(err, test.expectedError) {
+				t.Errorf("error = %v, want %v", err, test.expectedError)
+			}
+		})
+	}
+
+	t.Run("too few messages", func(t *testing.T) {
+		writer, err := NewWriter(io.Discard, header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.WritePostingsList(postingsLists[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = writer.Close()
+		var countError *CountError
+		if !errors.As(err, &countError) || countError.Expected != int64(len(postingsLists)) || countError.Actual != 1 {
+			t.Errorf("Close = %v, want a CountError of %d expected and 1 actual", err, len(postingsLists))
+		}
+	})
+}
@@ -0,0 +1,252 @@
+package ciffio
+
+import (
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Violation is a single inconsistency found by Validate.
+type Violation struct {
+	Section Section
+	Index   int64 // index of the message within its section
+	Offset  int64 // byte offset of the message's length prefix
+	Message string
+}
+
+func (violation Violation) String() string {
+	return fmt.Sprintf("%s message %d at offset %d: %s", violation.Section, violation.Index, violation.Offset, violation.Message)
+}
+
+type ValidateOptions struct {
+	// Impacts skips the checks that assume postings hold term frequencies, such as cf being the sum of
+	// the tfs, for quantized indexes.
+	Impacts bool
+}
+
+// Validate reads an entire CIFF stream and returns every violation of the format it finds. Reading
+// continues past malformed messages wherever the framing allows. The error is only non-nil if r fails
+// for reasons other than the stream ending.
+func Validate(r io.Reader, options ValidateOptions) ([]Violation, error) {
+	var violations []Violation
+	report := func(section Section, index int64, offset int64, format string, args ...any) {
+		violations = append(violations, Violation{Section: section, Index: index, Offset: offset, Message: fmt.Sprintf(format, args...)})
+	}
+	reader := &Reader{frames: newFrameReader(r)}
+
+	//Header
+	header := &ciff.Header{}
+	byteBuffer, err := reader.readFrame()
+	if err != nil {
+		if err == io.ErrUnexpectedEOF || err == ErrCorruptFrame {
+			report(SectionHeader, 0, 0, "cannot read header: %v", err)
+			return violations, nil
+		}
+		return violations, err
+	}
+	err = proto.Unmarshal(byteBuffer, header)
+	if err != nil {
+		report(SectionHeader, 0, 0, "cannot decode header: %v", err)
+		return violations, nil
+	}
+	if header.NumPostingsLists < 0 {
+		report(SectionHeader, 0, 0, "negative num_postings_lists %d", header.NumPostingsLists)
+	}
+	if header.NumDocs < 0 {
+		report(SectionHeader, 0, 0, "negative num_docs %d", header.NumDocs)
+	}
+
+	//PostingsLists
+	previousTerm := ""
+	postingsListIndex := int64(0)
+	var firstDocRecord []byte // a doc record met while postings lists were still expected
+	firstDocRecordOffset := int64(0)
+	for ; postingsListIndex < int64(header.NumPostingsLists); postingsListIndex++ {
+		offset := reader.offset
+		byteBuffer, err = reader.readFrame()
+		if err != nil {
+			if err == io.ErrUnexpectedEOF || err == ErrCorruptFrame {
+				report(SectionPostingsLists, postingsListIndex, offset, "cannot read message: %v", err)
+				break
+			}
+			return violations, err
+		}
+		if section, ok := frameSection(byteBuffer); ok && section == SectionDocRecords {
+			firstDocRecord, firstDocRecordOffset = byteBuffer, offset
+			break
+		}
+		postingsList := &ciff.PostingsList{}
+		err = proto.Unmarshal(byteBuffer, postingsList)
+		if err != nil {
+			report(SectionPostingsLists, postingsListIndex, offset, "cannot decode postings list: %v", err)
+			continue
+		}
+
+		if postingsListIndex > 0 && postingsList.Term <= previousTerm {
+			if postingsList.Term == previousTerm {
+				report(SectionPostingsLists, postingsListIndex, offset, "duplicate term %q", postingsList.Term)
+			} else {
+				report(SectionPostingsLists, postingsListIndex, offset, "term %q sorts before previous term %q", postingsList.Term, previousTerm)
+			}
+		}
+		previousTerm = postingsList.Term
+
+		postings := postingsList.Postings
+		if postingsList.Df != int64(len(postings)) {
+			report(SectionPostingsLists, postingsListIndex, offset, "term %q has df %d but %d postings", postingsList.Term, postingsList.Df, len(postings))
+		}
+		cf := int64(0)
+		docid := int64(0)
+		for postingIndex, posting := range postings {
+			cf += int64(posting.Tf)
+			if postingIndex > 0 && posting.Docid <= 0 {
+				report(SectionPostingsLists, postingsListIndex, offset, "term %q posting %d has d-gap %d, docids must be strictly increasing", postingsList.Term, postingIndex, posting.Docid)
+			}
+			docid += int64(posting.Docid)
+			if docid < 0 || docid >= int64(header.NumDocs) {
+				report(SectionPostingsLists, postingsListIndex, offset, "term %q posting %d has docid %d outside [0, %d)", postingsList.Term, postingIndex, docid, header.NumDocs)
+			}
+		}
+		if !options.Impacts && postingsList.Cf != cf {
+			report(SectionPostingsLists, postingsListIndex, offset, "term %q has cf %d but its tfs sum to %d", postingsList.Term, postingsList.Cf, cf)
+		}
+	}
+	postingsListsComplete := postingsListIndex == int64(header.NumPostingsLists)
+	if !postingsListsComplete {
+		report(SectionHeader, 0, 0, "header declares %d postings lists, found %d", header.NumPostingsLists, postingsListIndex)
+		if firstDocRecord == nil {
+			return violations, nil
+		}
+	}
+
+	//DocRecords, after any postings lists beyond those the header declares
+	extraPostingsLists := int64(0)
+	totalTerms := int64(0)
+	docRecordIndex := int64(0)
+	for docRecordIndex < int64(header.NumDocs) {
+		offset := reader.offset
+		if firstDocRecord != nil {
+			byteBuffer, offset = firstDocRecord, firstDocRecordOffset
+			firstDocRecord = nil
+		} else {
+			byteBuffer, err = reader.readFrame()
+			if err != nil {
+				if err == io.ErrUnexpectedEOF || err == ErrCorruptFrame {
+					report(SectionDocRecords, docRecordIndex, offset, "cannot read message: %v", err)
+					break
+				}
+				return violations, err
+			}
+		}
+		if postingsListsComplete && docRecordIndex == 0 {
+			if section, ok := frameSection(byteBuffer); ok && section == SectionPostingsLists {
+				extraPostingsLists++
+				continue
+			}
+		}
+		index := docRecordIndex
+		docRecordIndex++
+		docRecord := &ciff.DocRecord{}
+		err = proto.Unmarshal(byteBuffer, docRecord)
+		if err != nil {
+			report(SectionDocRecords, index, offset, "cannot decode doc record: %v", err)
+			continue
+		}
+		if int64(docRecord.Docid) != index {
+			report(SectionDocRecords, index, offset, "docid %d, doc records must be dense and ordered", docRecord.Docid)
+		}
+		if docRecord.Doclength < 0 {
+			report(SectionDocRecords, index, offset, "negative doclength %d", docRecord.Doclength)
+		}
+		totalTerms += int64(docRecord.Doclength)
+	}
+	if docRecordIndex < int64(header.NumDocs) {
+		if extraPostingsLists > 0 {
+			report(SectionHeader, 0, 0, "header declares %d postings lists, found %d", header.NumPostingsLists, int64(header.NumPostingsLists)+extraPostingsLists)
+		}
+		report(SectionHeader, 0, 0, "header declares %d doc records, found %d", header.NumDocs, docRecordIndex)
+		return violations, nil
+	}
+
+	//Messages beyond those the header declares, then any trailing bytes that are not a whole message
+	extraDocRecords := int64(0)
+	for {
+		_, err = reader.frames.reader.Peek(1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return violations, err
+		}
+		offset := reader.offset
+		byteBuffer, err = reader.readFrame()
+		if err == io.ErrUnexpectedEOF || err == ErrCorruptFrame {
+			trailingBytes, err := io.Copy(io.Discard, reader.frames.reader)
+			if err != nil {
+				return violations, err
+			}
+			trailingBytes += reader.offset - offset
+			report(SectionDocRecords, docRecordIndex+extraDocRecords, offset, "%d trailing bytes after the last doc record", trailingBytes)
+			break
+		}
+		if err != nil {
+			return violations, err
+		}
+		if section, ok := frameSection(byteBuffer); ok && section == SectionPostingsLists && docRecordIndex == 0 {
+			extraPostingsLists++
+		} else {
+			extraDocRecords++
+		}
+	}
+	if extraPostingsLists > 0 {
+		report(SectionHeader, 0, 0, "header declares %d postings lists, found %d", header.NumPostingsLists, int64(header.NumPostingsLists)+extraPostingsLists)
+	}
+	if extraDocRecords > 0 {
+		report(SectionHeader, 0, 0, "header declares %d doc records, found %d", header.NumDocs, int64(header.NumDocs)+extraDocRecords)
+	}
+
+	//Collection statistics, which describe the whole collection and so can only be checked if every
+	//document is present
+	if header.TotalDocs != header.NumDocs {
+		return violations, nil
+	}
+	if totalTerms != header.TotalTermsInCollection {
+		report(SectionHeader, 0, 0, "total_terms_in_collection is %d but doc lengths sum to %d", header.TotalTermsInCollection, totalTerms)
+	}
+	if header.NumDocs > 0 {
+		averageDocLength := float64(totalTerms) / float64(header.NumDocs)
+		if math.Abs(header.AverageDoclength-averageDocLength) > 1e-6*max(averageDocLength, 1) {
+			report(SectionHeader, 0, 0, "average_doclength is %v but doc lengths average %v", header.AverageDoclength, averageDocLength)
+		}
+	}
+	return violations, nil
+}
+
+// frameSection tells from the wire types of its fields whether an encoded message is a postings list,
+// whose term is bytes and df a varint, or a doc record, whose docid is a varint and collection docid
+// bytes. It reports false for messages that could be either, such as empty ones.
+func frameSection(byteBuffer []byte) (Section, bool) {
+	for len(byteBuffer) > 0 {
+		number, wireType, length := protowire.ConsumeTag(byteBuffer)
+		if length < 0 {
+			return 0, false
+		}
+		byteBuffer = byteBuffer[length:]
+		switch {
+		case number == 1 && wireType == protowire.BytesType, number == 2 && wireType == protowire.VarintType, number == 4:
+			return SectionPostingsLists, true
+		case number == 1 && wireType == protowire.VarintType, number == 2 && wireType == protowire.BytesType:
+			return SectionDocRecords, true
+		}
+		length = protowire.ConsumeFieldValue(number, wireType, byteBuffer)
+		if length < 0 {
+			return 0, false
+		}
+		byteBuffer = byteBuffer[length:]
+	}
+	return 0, false
+}
@@ -0,0 +1,174 @@
+package ciffio
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestValidate(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Small()
+	// validStream returns the messages of the test index, with edit applied to copies of them first.
+	validStream := func(t *testing.T, edit func(header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord)) [][]byte {
+		editedHeader := proto.Clone(header).(*ciff.Header)
+		editedPostingsLists := make([]*ciff.PostingsList, len(postingsLists))
+		for listIndex, postingsList := range postingsLists {
+			editedPostingsLists[listIndex] = proto.Clone(postingsList).(*ciff.PostingsList)
+		}
+		editedDocRecords := make([]*ciff.DocRecord, len(docRecords))
+		for docRecordIndex, docRecord := range docRecords {
+			editedDocRecords[docRecordIndex] = proto.Clone(docRecord).(*ciff.DocRecord)
+		}
+		if edit != nil {
+			edit(editedHeader, editedPostingsLists, editedDocRecords)
+		}
+		messages := [][]byte{marshal(t, editedHeader)}
+		for _, postingsList := range editedPostingsLists {
+			messages = append(messages, appendPostingsList(nil, postingsList))
+		}
+		for _, docRecord := range editedDocRecords {
+			messages = append(messages, marshal(t, docRecord))
+		}
+		return messages
+	}
+	extraPostingsList := &ciff.PostingsList{Term: "elderberry", Df: 1, Cf: 1, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}}}
+	extraDocRecord := &ciff.DocRecord{Docid: 3, CollectionDocid: "doc-d", Doclength: 1}
+
+	tests := []struct {
+		name       string
+		stream     func(t *testing.T) []byte
+		options    ValidateOptions
+		violations []string // a substring of each violation expected, in order
+	}{
+		{"valid", func(t *testing.T) []byte {
+			return frames(validStream(t, nil)...)
+		}, ValidateOptions{}, nil},
+		{"empty stream", func(t *testing.T) []byte {
+			return nil
+		}, ValidateOptions{}, []string{"cannot read header"}},
+		{"undecodable header", func(t *testing.T) []byte {
+			return frames([]byte{0xff})
+		}, ValidateOptions{}, []string{"cannot decode header"}},
+		{"negative counts", func(t *testing.T) []byte {
+			return frames(marshal(t, &ciff.Header{NumPostingsLists: -1, NumDocs: -1}))
+		}, ValidateOptions{}, []string{"negative num_postings_lists -1", "negative num_docs -1", "header declares -1 postings lists, found 0"}},
+		{"duplicate term", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, postingsLists []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				postingsLists[1].Term = "apple"
+			})...)
+		}, ValidateOptions{}, []string{`duplicate term "apple"`}},
+		{"unsorted term", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, postingsLists []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				postingsLists[2].Term = "aardvark"
+			})...)
+		}, ValidateOptions{}, []string{`term "aardvark" sorts before previous term "banana"`}},
+		{"df mismatch", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, postingsLists []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				postingsLists[0].Df = 5
+			})...)
+		}, ValidateOptions{}, []string{`term "apple" has df 5 but 2 postings`}},
+		{"cf mismatch", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, postingsLists []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				postingsLists[0].Cf = 9
+			})...)
+		}, ValidateOptions{}, []string{`term "apple" has cf 9 but its tfs sum to 3`}},
+		{"cf mismatch of impacts", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, postingsLists []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				postingsLists[0].Cf = 9
+			})...)
+		}, ValidateOptions{Impacts: true}, nil},
+		{"repeated docid", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, postingsLists []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				postingsLists[1].Postings[1].Docid = 0
+			})...)
+		}, ValidateOptions{}, []string{`term "banana" posting 1 has d-gap 0`}},
+		{"docid out of range", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, postingsLists []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				postingsLists[3].Postings[0].Docid = 3
+			})...)
+		}, ValidateOptions{}, []string{`term "date" posting 0 has docid 3 outside [0, 3)`}},
+		{"undecodable postings list", func(t *testing.T) []byte {
+			messages := validStream(t, nil)
+			messages[1] = []byte{0xff}
+			return frames(messages...)
+		}, ValidateOptions{}, []string{"cannot decode postings list"}},
+		{"truncated postings list", func(t *testing.T) []byte {
+			messages := validStream(t, nil)
+			stream := frames(messages[:2]...)
+			return append(stream, frames(messages[2])[:3]...)
+		}, ValidateOptions{}, []string{"cannot read message", "header declares 4 postings lists, found 1"}},
+		{"too few postings lists", func(t *testing.T) []byte {
+			messages := validStream(t, nil)
+			return frames(append(messages[:4], messages[5:]...)...)
+		}, ValidateOptions{}, []string{"header declares 4 postings lists, found 3"}},
+		{"too many postings lists", func(t *testing.T) []byte {
+			messages := validStream(t, nil)
+			messages = append(messages[:5:5], append([][]byte{appendPostingsList(nil, extraPostingsList)}, messages[5:]...)...)
+			return frames(messages...)
+		}, ValidateOptions{}, []string{"header declares 4 postings lists, found 5"}},
+		{"too few doc records", func(t *testing.T) []byte {
+			messages := validStream(t, nil)
+			return frames(messages[:len(messages)-1]...)
+		}, ValidateOptions{}, []string{"cannot read message", "header declares 3 doc records, found 2"}},
+		{"too many doc records", func(t *testing.T) []byte {
+			return frames(append(validStream(t, nil), marshal(t, extraDocRecord))...)
+		}, ValidateOptions{}, []string{"header declares 3 doc records, found 4"}},
+		{"sparse doc records", func(t *testing.T) []byte {
+			return frames(validStream(t, func(_ *ciff.Header, _ []*ciff.PostingsList, docRecords []*ciff.DocRecord) {
+				docRecords[1].Docid = 2
+			})...)
+		}, ValidateOptions{}, []string{"docid 2, doc records must be dense and ordered"}},
+		{"negative doc length", func(t *testing.T) []byte {
+			return frames(validStream(t, func(header *ciff.Header, _ []*ciff.PostingsList, docRecords []*ciff.DocRecord) {
+				docRecords[1].Doclength = -5
+				header.TotalTermsInCollection, header.AverageDoclength = 0, 0
+			})...)
+		}, ValidateOptions{}, []string{"negative doclength -5"}},
+		{"trailing bytes", func(t *testing.T) []byte {
+			return append(frames(validStream(t, nil)...), 0x05, 0x01)
+		}, ValidateOptions{}, []string{"2 trailing bytes after the last doc record"}},
+		{"total terms mismatch", func(t *testing.T) []byte {
+			return frames(validStream(t, func(header *ciff.Header, _ []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				header.TotalTermsInCollection = 11
+			})...)
+		}, ValidateOptions{}, []string{"total_terms_in_collection is 11 but doc lengths sum to 10"}},
+		{"average doc length mismatch", func(t *testing.T) []byte {
+			return frames(validStream(t, func(header *ciff.Header, _ []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				header.AverageDoclength = 4
+			})...)
+		}, ValidateOptions{}, []string{"average_doclength is 4 but doc lengths average"}},
+		{"statistics of a larger collection", func(t *testing.T) []byte {
+			return frames(validStream(t, func(header *ciff.Header, _ []*ciff.PostingsList, _ []*ciff.DocRecord) {
+				header.TotalDocs, header.TotalTermsInCollection, header.AverageDoclength = 30, 100, 4
+			})...)
+		}, ValidateOptions{}, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			violations, err := Validate(bytes.NewReader(test.stream(t)), test.options)
+			if err != nil {
+				t.Fatalf("Validate returned error %v", err)
+			}
+			if len(violations) != len(test.violations) {
+				t.Fatalf("violations = %v, want %d matching %q", violations, len(test.violations), test.violations)
+			}
+			for violationIndex, violation := range violations {
+				if !strings.Contains(violation.Message, test.violations[violationIndex]) {
+					t.Errorf("violation %d = %q, want it to contain %q", violationIndex, violation.Message, test.violations[violationIndex])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateAcceptsWriterOutput(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 300, 200, 20)
+	violations, err := Validate(bytes.NewReader(writeTestCiff(t, header, postingsLists, docRecords, 4)), ValidateOptions{})
+	if err != nil || len(violations) > 0 {
+		t.Errorf("Validate = %v, %v, want no violations", violations, err)
+	}
+}
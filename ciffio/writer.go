@@ -0,0 +1,191 @@
+package ciffio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+)
+
+// Writer writes a CIFF stream, checking that the messages written match the counts in the header.
+type Writer struct {
+	writer               *bufio.Writer
+	header               *ciff.Header
+	offset               int64
+	postingsListsWritten int64
+	docRecordsWritten    int64
+	sizeBuffer           [binary.MaxVarintLen64]byte
+	pipeline             *writePipeline // set by NewPipelinedWriter
+}
+
+// NewWriter writes header to w and returns a Writer expecting the postings lists that follow it.
+func NewWriter(w io.Writer, header *ciff.Header) (*Writer, error) {
+	writer := &Writer{writer: bufio.NewWriterSize(w, 1<<16), header: header}
+	err := writer.writeMessage(header)
+	if err != nil {
+		return nil, &MessageError{Section: SectionHeader, Err: err}
+	}
+	return writer, nil
+}
+
+func (writer *Writer) Header() *ciff.Header {
+	return writer.header
+}
+
+// messageOffset is the offset reported in errors, unknown while a pipeline is writing.
+func (writer *Writer) messageOffset() int64 {
+	if writer.pipeline != nil {
+		return -1
+	}
+	return writer.offset
+}
+
+// WritePostingsList writes a postings list holding absolute docids, which are d-gap encoded on the way
+// out. The postings list itself is not modified.
+func (writer *Writer) WritePostingsList(postingsList *ciff.PostingsList) error {
+	index, offset := writer.postingsListsWritten, writer.messageOffset()
+	if writer.pipeline != nil {
+		err := writer.pipeline.failed()
+		if err != nil {
+			return err
+		}
+	}
+	if index >= int64(writer.header.NumPostingsLists) {
+		return &MessageError{Section: SectionPostingsLists, Index: index, Offset: offset, Err: ErrTooManyMessages}
+	}
+	if postingsList.Df != int64(len(postingsList.Postings)) {
+		return &MessageError{Section: SectionPostingsLists, Index: index, Offset: offset, Err: ErrDfMismatch}
+	}
+	postings := postingsList.Postings
+	for postingsIndex := 1; postingsIndex < len(postings); postingsIndex++ {
+		if postings[postingsIndex].Docid <= postings[postingsIndex-1].Docid {
+			return &MessageError{Section: SectionPostingsLists, Index: index, Offset: offset, Err: ErrDocidOrder}
+		}
+	}
+
+	if writer.pipeline != nil {
+		writer.pipeline.send(&pipelinedMessage{index: index, postingsList: postingsList})
+	} else {
+		err := writer.writeFrame(appendPostingsList(nil, postingsList))
+		if err != nil {
+			return &MessageError{Section: SectionPostingsLists, Index: index, Offset: offset, Err: err}
+		}
+	}
+	writer.postingsListsWritten++
+	return nil
+}
+
+// WriteDocRecord writes a doc record. Every postings list must have been written first.
+func (writer *Writer) WriteDocRecord(docRecord *ciff.DocRecord) error {
+	index, offset := writer.docRecordsWritten, writer.messageOffset()
+	if writer.pipeline != nil {
+		err := writer.pipeline.failed()
+		if err != nil {
+			return err
+		}
+	}
+	if writer.postingsListsWritten < int64(writer.header.NumPostingsLists) {
+		return &MessageError{Section: SectionDocRecords, Index: index, Offset: offset, Err: ErrOutOfOrder}
+	}
+	if index >= int64(writer.header.NumDocs) {
+		return &MessageError{Section: SectionDocRecords, Index: index, Offset: offset, Err: ErrTooManyMessages}
+	}
+	if writer.pipeline != nil {
+		writer.pipeline.send(&pipelinedMessage{index: int64(writer.header.NumPostingsLists) + index, docRecord: docRecord})
+	} else {
+		err := writer.writeMessage(docRecord)
+		if err != nil {
+			return &MessageError{Section: SectionDocRecords, Index: index, Offset: offset, Err: err}
+		}
+	}
+	writer.docRecordsWritten++
+	return nil
+}
+
+// Close flushes the stream and reports a CountError if fewer messages were written than the header
+// declares. It does not close the underlying writer.
+func (writer *Writer) Close() error {
+	if writer.pipeline != nil {
+		err := writer.pipeline.finish()
+		if err != nil {
+			return err
+		}
+	}
+	err := writer.writer.Flush()
+	if err != nil {
+		return err
+	}
+	if writer.postingsListsWritten != int64(writer.header.NumPostingsLists) {
+		return &CountError{Section: SectionPostingsLists, Expected: int64(writer.header.NumPostingsLists), Actual: writer.postingsListsWritten}
+	}
+	if writer.docRecordsWritten != int64(writer.header.NumDocs) {
+		return &CountError{Section: SectionDocRecords, Expected: int64(writer.header.NumDocs), Actual: writer.docRecordsWritten}
+	}
+	return nil
+}
+
+func (writer *Writer) writeMessage(messageStruct proto.Message) error {
+	byteBuffer, err := proto.Marshal(messageStruct)
+	if err != nil {
+		return err
+	}
+	return writer.writeFrame(byteBuffer)
+}
+
+func (writer *Writer) writeFrame(byteBuffer []byte) error {
+	bytesWritten := binary.PutUvarint(writer.sizeBuffer[:], uint64(len(byteBuffer)))
+	_, err := writer.writer.Write(writer.sizeBuffer[:bytesWritten])
+	if err != nil {
+		return err
+	}
+	_, err = writer.writer.Write(byteBuffer)
+	if err != nil {
+		return err
+	}
+	writer.offset += int64(bytesWritten + len(byteBuffer))
+	return nil
+}
+
+// appendPostingsList appends the protobuf encoding of a postings list with its absolute docids d-gap
+// encoded, producing the same bytes as proto.Marshal without modifying the postings.
+func appendPostingsList(byteBuffer []byte, postingsList *ciff.PostingsList) []byte {
+	if postingsList.Term != "" {
+		byteBuffer = protowire.AppendTag(byteBuffer, 1, protowire.BytesType)
+		byteBuffer = protowire.AppendString(byteBuffer, postingsList.Term)
+	}
+	if postingsList.Df != 0 {
+		byteBuffer = protowire.AppendTag(byteBuffer, 2, protowire.VarintType)
+		byteBuffer = protowire.AppendVarint(byteBuffer, uint64(postingsList.Df))
+	}
+	if postingsList.Cf != 0 {
+		byteBuffer = protowire.AppendTag(byteBuffer, 3, protowire.VarintType)
+		byteBuffer = protowire.AppendVarint(byteBuffer, uint64(postingsList.Cf))
+	}
+	previousDocid := int32(0)
+	for _, posting := range postingsList.Postings {
+		dGap := uint64(int64(posting.Docid - previousDocid))
+		tf := uint64(int64(posting.Tf))
+		previousDocid = posting.Docid
+		postingSize := 0
+		if dGap != 0 {
+			postingSize += 1 + protowire.SizeVarint(dGap)
+		}
+		if tf != 0 {
+			postingSize += 1 + protowire.SizeVarint(tf)
+		}
+		byteBuffer = protowire.AppendTag(byteBuffer, 4, protowire.BytesType)
+		byteBuffer = protowire.AppendVarint(byteBuffer, uint64(postingSize))
+		if dGap != 0 {
+			byteBuffer = protowire.AppendTag(byteBuffer, 1, protowire.VarintType)
+			byteBuffer = protowire.AppendVarint(byteBuffer, dGap)
+		}
+		if tf != 0 {
+			byteBuffer = protowire.AppendTag(byteBuffer, 2, protowire.VarintType)
+			byteBuffer = protowire.AppendVarint(byteBuffer, tf)
+		}
+	}
+	return byteBuffer
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/Axiomatic314/ciffTools/ciffio"
+	"github.com/Axiomatic314/ciffTools/quantize"
+)
+
+// readDocLengths reads the doc lengths of a CIFF, skipping over its postings lists.
+func readDocLengths(ciffFilePath string) ([]int32, error) {
+	ciffReader, err := openCiff(ciffFilePath, 1)
+	if err != nil {
+		return nil, err
+	}
+	defer ciffReader.Close()
+	docLengths := make([]int32, 0, ciffReader.Header().NumDocs)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			return nil, err
+		}
+		docLengths = append(docLengths, docRecord.Doclength)
+	}
+	return docLengths, nil
+}
+
+func dequantizeCommand(arguments []string) int {
+	flags := flag.NewFlagSet("dequantize", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of quantized CIFF file to dequantize")
+	originalFilePath := flags.String("original", "", "filepath of the CIFF that was quantized. If given, the reconstructed scores are compared with the exact scores.")
+	outputDirectory := flags.String("outputDirectory", "output", "The target output directory. If not already present, it is created relative to the current working directory. Any existing files are overwritten!")
+	writeScores := flags.Bool("writeScores", false, "Bool to write the reconstructed scores to output.scores. Defaults to false.")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+	if *originalFilePath == "" && !*writeScores {
+		fmt.Println("Nothing to do, pass -writeScores and/or -original!")
+		return 1
+	}
+
+	ciffReader, err := openCiff(*ciffFilePath, 1)
+	if err != nil {
+		slog.Error("error opening ciff", "error", err)
+		return 1
+	}
+	defer ciffReader.Close()
+	provenance, err := quantize.ParseProvenance(ciffReader.Header().Description)
+	if err != nil {
+		slog.Error("error reading provenance", "error", err)
+		return 1
+	}
+	dequantizer, err := quantize.NewDequantizer(provenance)
+	if err != nil {
+		slog.Error("error creating dequantizer", "error", err)
+		return 1
+	}
+
+	err = os.Mkdir(*outputDirectory, 0777)
+	if err != nil && !os.IsExist(err) {
+		slog.Error("cannot create output directory", "error", err)
+		return 1
+	}
+
+	var scoresWriter *bufio.Writer
+	if *writeScores {
+		slog.Info("writing reconstructed scores")
+		scoresFileHandle, err := os.Create(filepath.Join(*outputDirectory, "output.scores"))
+		if err != nil {
+			slog.Error("error creating scores", "error", err)
+			return 1
+		}
+		defer scoresFileHandle.Close()
+		scoresWriter = bufio.NewWriter(scoresFileHandle)
+		defer scoresWriter.Flush()
+		scoresWriter.WriteString("term df (docid, score) ... (docid, score)\n")
+		scoresWriter.WriteString("--------------------------------------\n")
+	}
+
+	// --------------------------------------------------------------------------------
+	// The original index is read in lockstep to recompute the exact scores
+	var originalReader *ciffio.Reader
+	var scorer quantize.Scorer
+	var docLengths []int32
+	var reportWriter *bufio.Writer
+	if *originalFilePath != "" {
+		slog.Info("reading original doc lengths")
+		docLengths, err = readDocLengths(*originalFilePath)
+		if err != nil {
+			slog.Error("error reading original doc lengths", "error", err)
+			return 1
+		}
+		reader, err := openCiff(*originalFilePath, 1)
+		if err != nil {
+			slog.Error("error opening original ciff", "error", err)
+			return 1
+		}
+		defer reader.Close()
+		originalReader = reader.Reader
+		if originalReader.Header().NumPostingsLists != ciffReader.Header().NumPostingsLists {
+			slog.Error("the quantized and original ciffs hold different numbers of postings lists")
+			return 1
+		}
+		scorer, err = quantize.NewScorer(provenance.Scorer, provenance.Parameters, collectionStats(originalReader.Header()))
+		if err != nil {
+			slog.Error("error creating scorer", "error", err)
+			return 1
+		}
+
+		reportFileHandle, err := os.Create(filepath.Join(*outputDirectory, "output.dequantize"))
+		if err != nil {
+			slog.Error("error creating report", "error", err)
+			return 1
+		}
+		defer reportFileHandle.Close()
+		reportWriter = bufio.NewWriter(reportFileHandle)
+		defer reportWriter.Flush()
+		reportWriter.WriteString("term df meanAbsoluteError maxAbsoluteError spearman\n")
+		reportWriter.WriteString("---------------------------------------------------\n")
+	}
+
+	totalError, maxError := 0.0, 0.0
+	totalSpearman, numCorrelated := 0.0, 0
+	numPostings := int64(0)
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			slog.Error("error reading postings list", "error", err)
+			return 1
+		}
+		reconstructed := make([]float64, len(postingsList.Postings))
+		for postingIndex, posting := range postingsList.Postings {
+			reconstructed[postingIndex] = dequantizer.Score(posting.Tf)
+		}
+
+		if scoresWriter != nil {
+			scoresWriter.WriteString(fmt.Sprintf("%s %d ", postingsList.Term, postingsList.Df))
+			for postingIndex, posting := range postingsList.Postings {
+				scoresWriter.WriteString(fmt.Sprintf("(%d, %g) ", posting.Docid, reconstructed[postingIndex]))
+			}
+			scoresWriter.WriteString("\n")
+		}
+
+		if originalReader == nil {
+			continue
+		}
+		originalList, err := originalReader.ReadPostingsList()
+		if err != nil {
+			slog.Error("error reading original postings list", "error", err)
+			return 1
+		}
+		if originalList.Term != postingsList.Term || len(originalList.Postings) != len(postingsList.Postings) {
+			slog.Error("the quantized and original postings lists differ", "term", postingsList.Term, "originalTerm", originalList.Term)
+			return 1
+		}
+		termWeight := scorer.TermWeight(originalList.Df, originalList.Cf)
+		exact := make([]float64, len(originalList.Postings))
+		for postingIndex, posting := range originalList.Postings {
+			exact[postingIndex] = scorer.Score(posting.Tf, docLengths[posting.Docid], termWeight)
+		}
+		scoreError := quantize.CompareScores(exact, reconstructed)
+		reportWriter.WriteString(fmt.Sprintf("%s %d %g %g %g\n", postingsList.Term, postingsList.Df, scoreError.MeanAbsoluteError, scoreError.MaxAbsoluteError, scoreError.Spearman))
+
+		totalError += scoreError.MeanAbsoluteError * float64(len(exact))
+		numPostings += int64(len(exact))
+		maxError = max(maxError, scoreError.MaxAbsoluteError)
+		if !math.IsNaN(scoreError.Spearman) {
+			totalSpearman += scoreError.Spearman
+			numCorrelated++
+		}
+	}
+
+	if originalReader != nil {
+		fmt.Printf("postings: %d\n", numPostings)
+		fmt.Printf("mean absolute error: %g\n", totalError/float64(max(numPostings, 1)))
+		fmt.Printf("max absolute error: %g\n", maxError)
+		fmt.Printf("mean spearman over %d terms: %g\n", numCorrelated, totalSpearman/float64(max(numCorrelated, 1)))
+	}
+	slog.Info("complete")
+	return 0
+}
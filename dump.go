@@ -0,0 +1,277 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+)
+
+// FormatNames lists the formats human-readable output can be written in.
+var FormatNames = []string{"text", "jsonl", "csv", "tsv"}
+
+// formatExtensions maps each format to the suffix added to its output file names.
+var formatExtensions = map[string]string{
+	"text":  "",
+	"jsonl": ".jsonl",
+	"csv":   ".csv",
+	"tsv":   ".tsv",
+}
+
+// dumpFormat writes the sections of a CIFF to a file in one format. Each file holds a single section,
+// started with the matching begin method where there is one.
+type dumpFormat interface {
+	writeHeader(header *ciff.Header) error
+	beginDict() error
+	writeTerm(postingsList *ciff.PostingsList) error
+	beginPostings() error
+	writePostingsList(postingsList *ciff.PostingsList) error
+	beginDocRecords() error
+	writeDocRecord(docRecord *ciff.DocRecord) error
+	flush() error
+}
+
+func newDumpFormat(format string, writer *bufio.Writer) dumpFormat {
+	switch format {
+	case "jsonl":
+		return jsonlFormat{encoder: json.NewEncoder(writer)}
+	case "csv", "tsv":
+		return newDelimitedFormat(writer, delimitedCommas[format])
+	default:
+		return textFormat{writer: writer}
+	}
+}
+
+// --------------------------------------------------------------------------------
+// text
+
+// textFormat is the original space-separated output.
+type textFormat struct {
+	writer *bufio.Writer
+}
+
+func (format textFormat) writeHeader(header *ciff.Header) error {
+	fmt.Fprintf(format.writer, "Version: %v\n", header.Version)
+	fmt.Fprintf(format.writer, "NumPostingsLists: %v\n", header.NumPostingsLists)
+	fmt.Fprintf(format.writer, "NumDocs: %v\n", header.NumDocs)
+	fmt.Fprintf(format.writer, "TotalPostingsLists: %v\n", header.TotalPostingsLists)
+	fmt.Fprintf(format.writer, "TotalDocs: %v\n", header.TotalDocs)
+	fmt.Fprintf(format.writer, "TotalTermsInCollection: %v\n", header.TotalTermsInCollection)
+	fmt.Fprintf(format.writer, "AverageDocLength: %v\n", header.AverageDoclength)
+	_, err := fmt.Fprintf(format.writer, "Description: %v\n", header.Description)
+	return err
+}
+
+func (format textFormat) beginDict() error {
+	return nil
+}
+
+func (format textFormat) writeTerm(postingsList *ciff.PostingsList) error {
+	format.writer.WriteString(postingsList.Term)
+	return format.writer.WriteByte('\n')
+}
+
+func (format textFormat) beginPostings() error {
+	format.writer.WriteString("term df cf (docid, tf) ... (docid, tf)\n")
+	_, err := format.writer.WriteString("--------------------------------------\n")
+	return err
+}
+
+func (format textFormat) writePostingsList(postingsList *ciff.PostingsList) error {
+	fmt.Fprintf(format.writer, "%s %d %d ", postingsList.Term, postingsList.Df, postingsList.Cf)
+	for _, posting := range postingsList.GetPostings() {
+		fmt.Fprintf(format.writer, "(%d, %d) ", posting.Docid, posting.Tf)
+	}
+	return format.writer.WriteByte('\n')
+}
+
+func (format textFormat) beginDocRecords() error {
+	format.writer.WriteString("docid collection_docid doclength\n")
+	_, err := format.writer.WriteString("--------------------------------\n")
+	return err
+}
+
+func (format textFormat) writeDocRecord(docRecord *ciff.DocRecord) error {
+	_, err := fmt.Fprintf(format.writer, "%d %s %d\n", docRecord.Docid, docRecord.CollectionDocid, docRecord.Doclength)
+	return err
+}
+
+func (format textFormat) flush() error {
+	return nil
+}
+
+// --------------------------------------------------------------------------------
+// jsonl
+
+// jsonlFormat writes one JSON object per line, named after the fields of the CIFF protobuf messages.
+type jsonlFormat struct {
+	encoder *json.Encoder
+}
+
+type jsonHeader struct {
+	Version                int32   `json:"version"`
+	NumPostingsLists       int32   `json:"num_postings_lists"`
+	NumDocs                int32   `json:"num_docs"`
+	TotalPostingsLists     int32   `json:"total_postings_lists"`
+	TotalDocs              int32   `json:"total_docs"`
+	TotalTermsInCollection int64   `json:"total_terms_in_collection"`
+	AverageDoclength       float64 `json:"average_doclength"`
+	Description            string  `json:"description"`
+}
+
+type jsonTerm struct {
+	Term string `json:"term"`
+	Df   int64  `json:"df"`
+	Cf   int64  `json:"cf"`
+}
+
+type jsonPosting struct {
+	Docid int32 `json:"docid"`
+	Tf    int32 `json:"tf"`
+}
+
+type jsonPostingsList struct {
+	Term     string        `json:"term"`
+	Df       int64         `json:"df"`
+	Cf       int64         `json:"cf"`
+	Postings []jsonPosting `json:"postings"`
+}
+
+type jsonDocRecord struct {
+	Docid           int32  `json:"docid"`
+	CollectionDocid string `json:"collection_docid"`
+	Doclength       int32  `json:"doclength"`
+}
+
+func (format jsonlFormat) writeHeader(header *ciff.Header) error {
+	return format.encoder.Encode(jsonHeader{
+		Version:                header.Version,
+		NumPostingsLists:       header.NumPostingsLists,
+		NumDocs:                header.NumDocs,
+		TotalPostingsLists:     header.TotalPostingsLists,
+		TotalDocs:              header.TotalDocs,
+		TotalTermsInCollection: header.TotalTermsInCollection,
+		AverageDoclength:       header.AverageDoclength,
+		Description:            header.Description,
+	})
+}
+
+func (format jsonlFormat) beginDict() error {
+	return nil
+}
+
+func (format jsonlFormat) writeTerm(postingsList *ciff.PostingsList) error {
+	return format.encoder.Encode(jsonTerm{Term: postingsList.Term, Df: postingsList.Df, Cf: postingsList.Cf})
+}
+
+func (format jsonlFormat) beginPostings() error {
+	return nil
+}
+
+func (format jsonlFormat) writePostingsList(postingsList *ciff.PostingsList) error {
+	postings := make([]jsonPosting, len(postingsList.Postings))
+	for postingIndex, posting := range postingsList.Postings {
+		postings[postingIndex] = jsonPosting{Docid: posting.Docid, Tf: posting.Tf}
+	}
+	return format.encoder.Encode(jsonPostingsList{Term: postingsList.Term, Df: postingsList.Df, Cf: postingsList.Cf, Postings: postings})
+}
+
+func (format jsonlFormat) beginDocRecords() error {
+	return nil
+}
+
+func (format jsonlFormat) writeDocRecord(docRecord *ciff.DocRecord) error {
+	return format.encoder.Encode(jsonDocRecord{Docid: docRecord.Docid, CollectionDocid: docRecord.CollectionDocid, Doclength: docRecord.Doclength})
+}
+
+func (format jsonlFormat) flush() error {
+	return nil
+}
+
+// --------------------------------------------------------------------------------
+// csv and tsv
+
+// delimitedCommas are the field separators of the delimited formats.
+var delimitedCommas = map[string]rune{"csv": ',', "tsv": '\t'}
+
+// The header rows of the delimited header, postings and doc records tables, which import expects.
+var (
+	delimitedHeaderColumns     = []string{"version", "num_postings_lists", "num_docs", "total_postings_lists", "total_docs", "total_terms_in_collection", "average_doclength", "description"}
+	delimitedPostingsColumns   = []string{"term", "df", "cf", "docid", "tf"}
+	delimitedDocRecordsColumns = []string{"docid", "collection_docid", "doclength"}
+)
+
+// delimitedFormat writes a table with a header row. Postings are written one per row, so the postings
+// table has a row for every (term, docid) pair, repeating the df and cf of the term. A postings list
+// without postings is written as a single row with an empty docid and tf, so that it is not lost.
+type delimitedFormat struct {
+	writer *csv.Writer
+	record []string
+}
+
+func newDelimitedFormat(writer *bufio.Writer, comma rune) *delimitedFormat {
+	csvWriter := csv.NewWriter(writer)
+	csvWriter.Comma = comma
+	return &delimitedFormat{writer: csvWriter}
+}
+
+func (format *delimitedFormat) write(fields ...string) error {
+	format.record = append(format.record[:0], fields...)
+	return format.writer.Write(format.record)
+}
+
+func (format *delimitedFormat) writeHeader(header *ciff.Header) error {
+	format.write(delimitedHeaderColumns...)
+	return format.write(
+		strconv.FormatInt(int64(header.Version), 10),
+		strconv.FormatInt(int64(header.NumPostingsLists), 10),
+		strconv.FormatInt(int64(header.NumDocs), 10),
+		strconv.FormatInt(int64(header.TotalPostingsLists), 10),
+		strconv.FormatInt(int64(header.TotalDocs), 10),
+		strconv.FormatInt(header.TotalTermsInCollection, 10),
+		strconv.FormatFloat(header.AverageDoclength, 'g', -1, 64),
+		header.Description,
+	)
+}
+
+func (format *delimitedFormat) beginDict() error {
+	return format.write("term", "df", "cf")
+}
+
+func (format *delimitedFormat) writeTerm(postingsList *ciff.PostingsList) error {
+	return format.write(postingsList.Term, strconv.FormatInt(postingsList.Df, 10), strconv.FormatInt(postingsList.Cf, 10))
+}
+
+func (format *delimitedFormat) beginPostings() error {
+	return format.write(delimitedPostingsColumns...)
+}
+
+func (format *delimitedFormat) writePostingsList(postingsList *ciff.PostingsList) error {
+	df, cf := strconv.FormatInt(postingsList.Df, 10), strconv.FormatInt(postingsList.Cf, 10)
+	if len(postingsList.Postings) == 0 {
+		return format.write(postingsList.Term, df, cf, "", "")
+	}
+	for _, posting := range postingsList.Postings {
+		err := format.write(postingsList.Term, df, cf, strconv.FormatInt(int64(posting.Docid), 10), strconv.FormatInt(int64(posting.Tf), 10))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (format *delimitedFormat) beginDocRecords() error {
+	return format.write(delimitedDocRecordsColumns...)
+}
+
+func (format *delimitedFormat) writeDocRecord(docRecord *ciff.DocRecord) error {
+	return format.write(strconv.FormatInt(int64(docRecord.Docid), 10), docRecord.CollectionDocid, strconv.FormatInt(int64(docRecord.Doclength), 10))
+}
+
+func (format *delimitedFormat) flush() error {
+	format.writer.Flush()
+	return format.writer.Error()
+}
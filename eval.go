@@ -0,0 +1,221 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Axiomatic314/ciffTools/analysis"
+	"github.com/Axiomatic314/ciffTools/search"
+	"github.com/Axiomatic314/ciffTools/trec"
+)
+
+// runSource describes how a run is produced in-process, by searching a CIFF for each topic.
+type runSource struct {
+	topics       []trec.Topic
+	fields       []string
+	analyzerSpec string
+	indexOptions searchIndexOptions
+	options      search.Options
+}
+
+// readRun reads the TREC run of runFilePath, or else searches the CIFF of ciffFilePath.
+func (source runSource) readRun(runFilePath string, ciffFilePath string) (trec.Run, error) {
+	if runFilePath != "" {
+		fileHandle, err := os.Open(runFilePath)
+		if err != nil {
+			return nil, err
+		}
+		defer fileHandle.Close()
+		return trec.ReadRun(fileHandle)
+	}
+	index, err := loadSearchIndex(ciffFilePath, source.indexOptions)
+	if err != nil {
+		return nil, err
+	}
+	analyzer, err := queryAnalyzer(source.analyzerSpec, index.Header)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("searching", "ciff", ciffFilePath, "topics", len(source.topics))
+	return searchRun(index, analyzer, source.topics, source.fields, source.options)
+}
+
+// parseCutoffs parses a comma separated list of positive ranks.
+func parseCutoffs(list string) ([]int, error) {
+	cutoffs := make([]int, 0)
+	for _, field := range strings.Split(list, ",") {
+		cutoff, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || cutoff <= 0 {
+			return nil, fmt.Errorf("invalid cutoff %q", field)
+		}
+		cutoffs = append(cutoffs, cutoff)
+	}
+	return cutoffs, nil
+}
+
+// pairedValues returns the values of measure for the queries of both evaluations.
+func pairedValues(evaluation trec.Evaluation, compareEvaluation trec.Evaluation, queries []string, measure string) ([]float64, []float64) {
+	values := make([]float64, len(queries))
+	compareValues := make([]float64, len(queries))
+	for i, query := range queries {
+		values[i] = evaluation.Values[query][measure]
+		compareValues[i] = compareEvaluation.Values[query][measure]
+	}
+	return values, compareValues
+}
+
+func evalCommand(arguments []string) int {
+	flags := flag.NewFlagSet("eval", flag.ExitOnError)
+	qrelsFilePath := flags.String("qrels", "", "filepath of the TREC qrels to evaluate against.")
+	runFilePath := flags.String("run", "", "filepath of the TREC run to evaluate.")
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of CIFF file to search for the topics, evaluating its results instead of -run.")
+	compareRunFilePath := flags.String("compareRun", "", "filepath of a TREC run to compare against, with paired significance tests.")
+	compareCiffFilePath := flags.String("compareCiffFilePath", "", "filepath of a CIFF file to search for the topics and compare against, instead of -compareRun.")
+	topicsFilePath := flags.String("topics", "", "filepath of the topics to search the CIFF files for.")
+	topicFormat := flags.String("topicFormat", "trec", fmt.Sprintf("Format of the topics, one of %v.", trec.TopicFormats))
+	topicFields := flags.String("topicFields", "title", fmt.Sprintf("Comma separated fields of each topic that make its query, from %v.", trec.TopicFields))
+	algorithm := flags.String("algorithm", "daat", fmt.Sprintf("Query evaluation algorithm, one of %v.", search.Algorithms))
+	k := flags.Int("k", 1000, "Number of results per query when searching.")
+	rho := flags.Int64("rho", 0, "Number of postings score-at-a-time evaluation processes before stopping early. Defaults to 0, processing every posting.")
+	analyzerSpec := flags.String("analyzer", "", fmt.Sprintf("Comma separated filters applied to each query token, from %v, or a preset from %v. Defaults to the analyzer recorded in the ciff.", analysis.FilterNames, slices.Sorted(maps.Keys(analysis.Presets))))
+	impacts := flags.Bool("impacts", false, "Bool to score postings by their impacts. Implied for CIFFs with a quantization provenance. Defaults to false.")
+	scorer := scorerFlags(flags)
+	blockSize := flags.Int("blockSize", search.DefaultBlockSize, "Number of postings per block of the block-max scores.")
+	cutoffList := flags.String("cutoffs", "10,100,1000", "Comma separated ranks to compute nDCG, precision, recall and judged at.")
+	perQuery := flags.Bool("perQuery", false, "Bool to print the measures of each query as well as their means. Defaults to false.")
+	complete := flags.Bool("complete", false, "Bool to score queries of the qrels without results as zero, rather than skip them. Defaults to false.")
+	permutations := flags.Int("permutations", 10000, "Number of permutations of the randomization test.")
+	seed := flags.Uint64("seed", 1, "Seed of the randomization test.")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to decode with.")
+	flags.Parse(arguments)
+
+	if *qrelsFilePath == "" {
+		fmt.Println("Please provide a qrels file!")
+		return 1
+	}
+	if (*runFilePath == "") == (*ciffFilePath == "") {
+		fmt.Println("Please provide either a run or a CIFF file!")
+		return 1
+	}
+	if *compareRunFilePath != "" && *compareCiffFilePath != "" {
+		fmt.Println("Please provide at most one of a run or a CIFF file to compare against!")
+		return 1
+	}
+	if (*ciffFilePath != "" || *compareCiffFilePath != "") && *topicsFilePath == "" {
+		fmt.Println("Please provide topics to search the CIFF for!")
+		return 1
+	}
+	if !slices.Contains(search.Algorithms, *algorithm) {
+		fmt.Printf("Unknown algorithm %q, expected one of %v!\n", *algorithm, search.Algorithms)
+		return 1
+	}
+	cutoffs, err := parseCutoffs(*cutoffList)
+	if err != nil {
+		slog.Error("error parsing cutoffs", "error", err)
+		return 1
+	}
+
+	qrelsFileHandle, err := os.Open(*qrelsFilePath)
+	if err != nil {
+		slog.Error("error opening qrels", "error", err)
+		return 1
+	}
+	qrels, err := trec.ReadQrels(qrelsFileHandle)
+	qrelsFileHandle.Close()
+	if err != nil {
+		slog.Error("error reading qrels", "error", err)
+		return 1
+	}
+
+	scorerName, parameters := scorer()
+	source := runSource{
+		fields:       strings.Split(*topicFields, ","),
+		analyzerSpec: *analyzerSpec,
+		indexOptions: searchIndexOptions{
+			impacts:    *impacts,
+			scorerName: scorerName,
+			parameters: parameters,
+			blockSize:  *blockSize,
+			workers:    *workers,
+		},
+		options: search.Options{Algorithm: *algorithm, K: *k, Rho: *rho},
+	}
+	if *topicsFilePath != "" {
+		source.topics, err = readSearchTopics("", *topicsFilePath, *topicFormat)
+		if err != nil {
+			slog.Error("error reading topics", "error", err)
+			return 1
+		}
+	}
+
+	run, err := source.readRun(*runFilePath, *ciffFilePath)
+	if err != nil {
+		slog.Error("error reading run", "error", err)
+		return 1
+	}
+	evaluation := trec.Evaluate(run, qrels, cutoffs, *complete)
+	if len(evaluation.Queries) == 0 {
+		slog.Warn("no query of the run has relevance judgments")
+	}
+
+	if *compareRunFilePath == "" && *compareCiffFilePath == "" {
+		if *perQuery {
+			for _, query := range evaluation.Queries {
+				for _, measure := range evaluation.Measures {
+					fmt.Printf("%-12s\t%s\t%.4f\n", measure, query, evaluation.Values[query][measure])
+				}
+			}
+		}
+		fmt.Printf("%-12s\tall\t%d\n", "queries", len(evaluation.Queries))
+		for _, measure := range evaluation.Measures {
+			fmt.Printf("%-12s\tall\t%.4f\n", measure, evaluation.Mean(measure))
+		}
+		return 0
+	}
+
+	compareRun, err := source.readRun(*compareRunFilePath, *compareCiffFilePath)
+	if err != nil {
+		slog.Error("error reading run to compare against", "error", err)
+		return 1
+	}
+	compareEvaluation := trec.Evaluate(compareRun, qrels, cutoffs, *complete)
+	// Significance tests pair the queries, so only those evaluated for both runs are compared
+	queries := make([]string, 0, len(evaluation.Queries))
+	for _, query := range evaluation.Queries {
+		if _, ok := compareEvaluation.Values[query]; ok {
+			queries = append(queries, query)
+		}
+	}
+	if len(queries) < max(len(evaluation.Queries), len(compareEvaluation.Queries)) {
+		slog.Warn("comparing only the queries both runs have results for, pass -complete to compare every query", "queries", len(queries))
+	}
+
+	if *perQuery {
+		for _, query := range queries {
+			for _, measure := range evaluation.Measures {
+				fmt.Printf("%-12s\t%s\t%.4f\t%.4f\n", measure, query, evaluation.Values[query][measure], compareEvaluation.Values[query][measure])
+			}
+		}
+	}
+	fmt.Printf("%-12s\tall\t%d\n", "queries", len(queries))
+	for _, measure := range evaluation.Measures {
+		values, compareValues := pairedValues(evaluation, compareEvaluation, queries, measure)
+		t, tTestP := trec.PairedTTest(values, compareValues)
+		randomizationP := trec.RandomizationTest(values, compareValues, *permutations, *seed)
+		sum, compareSum := 0.0, 0.0
+		for i := range values {
+			sum += values[i]
+			compareSum += compareValues[i]
+		}
+		mean, compareMean := sum/float64(max(len(values), 1)), compareSum/float64(max(len(values), 1))
+		fmt.Printf("%-12s\tall\t%.4f\t%.4f\tdiff=%+.4f\tt=%+.3f\tp=%.4f\trandomization p=%.4f\n", measure, mean, compareMean, compareMean-mean, t, tTestP, randomizationP)
+	}
+	return 0
+}
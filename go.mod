@@ -1,5 +1,5 @@
 module github.com/Axiomatic314/ciffTools
 
-go 1.22.4
+go 1.23
 
 require google.golang.org/protobuf v1.34.2
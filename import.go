@@ -0,0 +1,503 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+)
+
+// maxDumpLineLength bounds a single line of a dump, which for postings holds a whole postings list.
+const maxDumpLineLength = 1 << 30
+
+var importFormatNames = []string{"text", "jsonl", "csv", "tsv"}
+
+// dumpScanner reads a dump line by line, keeping track of the line number for errors.
+type dumpScanner struct {
+	scanner    *bufio.Scanner
+	path       string
+	lineNumber int
+}
+
+func openDump(path string) (*os.File, *dumpScanner, error) {
+	fileHandle, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	scanner := bufio.NewScanner(fileHandle)
+	scanner.Buffer(make([]byte, 64*1024), maxDumpLineLength)
+	return fileHandle, &dumpScanner{scanner: scanner, path: path}, nil
+}
+
+func (scanner *dumpScanner) scan() bool {
+	if !scanner.scanner.Scan() {
+		return false
+	}
+	scanner.lineNumber++
+	return true
+}
+
+func (scanner *dumpScanner) line() string {
+	return scanner.scanner.Text()
+}
+
+func (scanner *dumpScanner) errorf(format string, arguments ...any) error {
+	return fmt.Errorf("%s:%d: %s", scanner.path, scanner.lineNumber, fmt.Sprintf(format, arguments...))
+}
+
+// skipHeading skips the heading and line of dashes that start the text postings and doc records dumps.
+func (scanner *dumpScanner) skipHeading(heading string) bool {
+	if !scanner.scan() {
+		return false
+	}
+	if scanner.line() != heading {
+		return true
+	}
+	if !scanner.scan() {
+		return false
+	}
+	if strings.Trim(scanner.line(), "-") != "" {
+		return true
+	}
+	return scanner.scan()
+}
+
+// delimitedScanner reads the rows of a csv or tsv dump that follow its header row.
+type delimitedScanner struct {
+	reader *csv.Reader
+	path   string
+	record []string
+	err    error
+}
+
+// openDelimitedDump opens a csv or tsv dump, checking its header row is columns.
+func openDelimitedDump(path string, format string, columns []string) (*os.File, *delimitedScanner, error) {
+	fileHandle, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	reader := csv.NewReader(bufio.NewReader(fileHandle))
+	reader.Comma = delimitedCommas[format]
+	reader.FieldsPerRecord = len(columns)
+	reader.ReuseRecord = true
+	scanner := &delimitedScanner{reader: reader, path: path}
+	if !scanner.scan() {
+		fileHandle.Close()
+		return nil, nil, cmp.Or(scanner.error(), fmt.Errorf("%s: empty dump", path))
+	}
+	if !slices.Equal(scanner.record, columns) {
+		fileHandle.Close()
+		return nil, nil, scanner.errorf("expected header row %q, got %q", columns, scanner.record)
+	}
+	return fileHandle, scanner, nil
+}
+
+func (scanner *delimitedScanner) scan() bool {
+	scanner.record, scanner.err = scanner.reader.Read()
+	return scanner.err == nil
+}
+
+// error returns the error that stopped scan, or nil at the end of the dump.
+func (scanner *delimitedScanner) error() error {
+	if scanner.err == nil || errors.Is(scanner.err, io.EOF) {
+		return nil
+	}
+	return fmt.Errorf("%s: %w", scanner.path, scanner.err)
+}
+
+func (scanner *delimitedScanner) errorf(format string, arguments ...any) error {
+	lineNumber, _ := scanner.reader.FieldPos(0)
+	return fmt.Errorf("%s:%d: %s", scanner.path, lineNumber, fmt.Sprintf(format, arguments...))
+}
+
+// --------------------------------------------------------------------------------
+// Header
+
+func readHeaderDump(path string, format string) (*ciff.Header, error) {
+	if _, ok := delimitedCommas[format]; ok {
+		return readDelimitedHeaderDump(path, format)
+	}
+	fileHandle, scanner, err := openDump(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+	if format == "jsonl" {
+		var header jsonHeader
+		err = json.NewDecoder(fileHandle).Decode(&header)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		return &ciff.Header{
+			Version:                header.Version,
+			NumPostingsLists:       header.NumPostingsLists,
+			NumDocs:                header.NumDocs,
+			TotalPostingsLists:     header.TotalPostingsLists,
+			TotalDocs:              header.TotalDocs,
+			TotalTermsInCollection: header.TotalTermsInCollection,
+			AverageDoclength:       header.AverageDoclength,
+			Description:            header.Description,
+		}, nil
+	}
+
+	// The description is written last and may span several lines, so it runs to the end of the file.
+	header := &ciff.Header{}
+	for scanner.scan() {
+		key, value, found := strings.Cut(scanner.line(), ": ")
+		if !found {
+			return nil, scanner.errorf("expected \"Key: value\", got %q", scanner.line())
+		}
+		switch key {
+		case "Version":
+			header.Version, err = parseInt32(value)
+		case "NumPostingsLists":
+			header.NumPostingsLists, err = parseInt32(value)
+		case "NumDocs":
+			header.NumDocs, err = parseInt32(value)
+		case "TotalPostingsLists":
+			header.TotalPostingsLists, err = parseInt32(value)
+		case "TotalDocs":
+			header.TotalDocs, err = parseInt32(value)
+		case "TotalTermsInCollection":
+			header.TotalTermsInCollection, err = strconv.ParseInt(value, 10, 64)
+		case "AverageDocLength":
+			header.AverageDoclength, err = strconv.ParseFloat(value, 64)
+		case "Description":
+			lines := []string{value}
+			for scanner.scan() {
+				lines = append(lines, scanner.line())
+			}
+			header.Description = strings.Join(lines, "\n")
+		default:
+			return nil, scanner.errorf("unknown header field %q", key)
+		}
+		if err != nil {
+			return nil, scanner.errorf("%s: %v", key, err)
+		}
+	}
+	if scanner.scanner.Err() != nil {
+		return nil, scanner.errorf("%v", scanner.scanner.Err())
+	}
+	return header, nil
+}
+
+// readDelimitedHeaderDump reads the single row following the header row of a csv or tsv header dump.
+func readDelimitedHeaderDump(path string, format string) (*ciff.Header, error) {
+	fileHandle, scanner, err := openDelimitedDump(path, format, delimitedHeaderColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+	if !scanner.scan() {
+		return nil, cmp.Or(scanner.error(), fmt.Errorf("%s: no header row", path))
+	}
+	header := &ciff.Header{Description: scanner.record[7]}
+	for column, field := range []*int32{&header.Version, &header.NumPostingsLists, &header.NumDocs, &header.TotalPostingsLists, &header.TotalDocs} {
+		*field, err = parseInt32(scanner.record[column])
+		if err != nil {
+			return nil, scanner.errorf("%s: %v", delimitedHeaderColumns[column], err)
+		}
+	}
+	header.TotalTermsInCollection, err = strconv.ParseInt(scanner.record[5], 10, 64)
+	if err != nil {
+		return nil, scanner.errorf("%s: %v", delimitedHeaderColumns[5], err)
+	}
+	header.AverageDoclength, err = strconv.ParseFloat(scanner.record[6], 64)
+	if err != nil {
+		return nil, scanner.errorf("%s: %v", delimitedHeaderColumns[6], err)
+	}
+	if scanner.scan() {
+		return nil, scanner.errorf("expected a single header row")
+	}
+	return header, scanner.error()
+}
+
+func parseInt32(value string) (int32, error) {
+	parsed, err := strconv.ParseInt(value, 10, 32)
+	return int32(parsed), err
+}
+
+// --------------------------------------------------------------------------------
+// Postings
+
+func readPostingsDump(path string, format string) ([]*ciff.PostingsList, error) {
+	if _, ok := delimitedCommas[format]; ok {
+		return readDelimitedPostingsDump(path, format)
+	}
+	fileHandle, scanner, err := openDump(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+	postingsLists := make([]*ciff.PostingsList, 0)
+	if format == "jsonl" {
+		decoder := json.NewDecoder(bufio.NewReader(fileHandle))
+		for {
+			var postingsList jsonPostingsList
+			err = decoder.Decode(&postingsList)
+			if errors.Is(err, io.EOF) {
+				return postingsLists, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: postings list %d: %w", path, len(postingsLists), err)
+			}
+			postings := make([]*ciff.Posting, len(postingsList.Postings))
+			for postingIndex, posting := range postingsList.Postings {
+				postings[postingIndex] = &ciff.Posting{Docid: posting.Docid, Tf: posting.Tf}
+			}
+			postingsLists = append(postingsLists, &ciff.PostingsList{Term: postingsList.Term, Df: postingsList.Df, Cf: postingsList.Cf, Postings: postings})
+		}
+	}
+
+	// Each line is "term df cf (docid, tf) ... (docid, tf) ".
+	for ok := scanner.skipHeading("term df cf (docid, tf) ... (docid, tf)"); ok; ok = scanner.scan() {
+		fields := strings.Fields(scanner.line())
+		if len(fields) < 3 || len(fields)%2 == 0 {
+			return nil, scanner.errorf("expected \"term df cf (docid, tf) ...\", got %q", scanner.line())
+		}
+		postingsList := &ciff.PostingsList{Term: fields[0], Postings: make([]*ciff.Posting, 0, (len(fields)-3)/2)}
+		postingsList.Df, err = strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return nil, scanner.errorf("df: %v", err)
+		}
+		postingsList.Cf, err = strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, scanner.errorf("cf: %v", err)
+		}
+		for fieldIndex := 3; fieldIndex < len(fields); fieldIndex += 2 {
+			docid, docidFound := strings.CutPrefix(fields[fieldIndex], "(")
+			docid, commaFound := strings.CutSuffix(docid, ",")
+			tf, tfFound := strings.CutSuffix(fields[fieldIndex+1], ")")
+			if !docidFound || !commaFound || !tfFound {
+				return nil, scanner.errorf("expected \"(docid, tf)\", got %q", fields[fieldIndex]+" "+fields[fieldIndex+1])
+			}
+			posting := &ciff.Posting{}
+			posting.Docid, err = parseInt32(docid)
+			if err != nil {
+				return nil, scanner.errorf("docid: %v", err)
+			}
+			posting.Tf, err = parseInt32(tf)
+			if err != nil {
+				return nil, scanner.errorf("tf: %v", err)
+			}
+			postingsList.Postings = append(postingsList.Postings, posting)
+		}
+		postingsLists = append(postingsLists, postingsList)
+	}
+	if scanner.scanner.Err() != nil {
+		return nil, scanner.errorf("%v", scanner.scanner.Err())
+	}
+	return postingsLists, nil
+}
+
+// readDelimitedPostingsDump reads a csv or tsv postings dump. Consecutive rows of the same term make a
+// postings list, and a row with an empty docid and tf is a postings list without postings.
+func readDelimitedPostingsDump(path string, format string) ([]*ciff.PostingsList, error) {
+	fileHandle, scanner, err := openDelimitedDump(path, format, delimitedPostingsColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+	postingsLists := make([]*ciff.PostingsList, 0)
+	var postingsList *ciff.PostingsList
+	for scanner.scan() {
+		term, df, cf, docid, tf := scanner.record[0], scanner.record[1], scanner.record[2], scanner.record[3], scanner.record[4]
+		if postingsList == nil || term != postingsList.Term {
+			postingsList = &ciff.PostingsList{Term: term, Postings: make([]*ciff.Posting, 0)}
+			postingsList.Df, err = strconv.ParseInt(df, 10, 64)
+			if err != nil {
+				return nil, scanner.errorf("df: %v", err)
+			}
+			postingsList.Cf, err = strconv.ParseInt(cf, 10, 64)
+			if err != nil {
+				return nil, scanner.errorf("cf: %v", err)
+			}
+			postingsLists = append(postingsLists, postingsList)
+		}
+		if docid == "" && tf == "" {
+			continue
+		}
+		posting := &ciff.Posting{}
+		posting.Docid, err = parseInt32(docid)
+		if err != nil {
+			return nil, scanner.errorf("docid: %v", err)
+		}
+		posting.Tf, err = parseInt32(tf)
+		if err != nil {
+			return nil, scanner.errorf("tf: %v", err)
+		}
+		postingsList.Postings = append(postingsList.Postings, posting)
+	}
+	if scanner.error() != nil {
+		return nil, scanner.error()
+	}
+	return postingsLists, nil
+}
+
+// --------------------------------------------------------------------------------
+// DocRecords
+
+func readDocRecordsDump(path string, format string) ([]*ciff.DocRecord, error) {
+	if _, ok := delimitedCommas[format]; ok {
+		return readDelimitedDocRecordsDump(path, format)
+	}
+	fileHandle, scanner, err := openDump(path)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+	docRecords := make([]*ciff.DocRecord, 0)
+	if format == "jsonl" {
+		decoder := json.NewDecoder(bufio.NewReader(fileHandle))
+		for {
+			var docRecord jsonDocRecord
+			err = decoder.Decode(&docRecord)
+			if errors.Is(err, io.EOF) {
+				return docRecords, nil
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: doc record %d: %w", path, len(docRecords), err)
+			}
+			docRecords = append(docRecords, &ciff.DocRecord{Docid: docRecord.Docid, CollectionDocid: docRecord.CollectionDocid, Doclength: docRecord.Doclength})
+		}
+	}
+
+	// Each line is "docid collection_docid doclength". The collection docid is everything in between, so
+	// it may contain spaces.
+	for ok := scanner.skipHeading("docid collection_docid doclength"); ok; ok = scanner.scan() {
+		docid, rest, found := strings.Cut(scanner.line(), " ")
+		separator := strings.LastIndexByte(rest, ' ')
+		if !found || separator < 0 {
+			return nil, scanner.errorf("expected \"docid collection_docid doclength\", got %q", scanner.line())
+		}
+		docRecord := &ciff.DocRecord{CollectionDocid: rest[:separator]}
+		docRecord.Docid, err = parseInt32(docid)
+		if err != nil {
+			return nil, scanner.errorf("docid: %v", err)
+		}
+		docRecord.Doclength, err = parseInt32(rest[separator+1:])
+		if err != nil {
+			return nil, scanner.errorf("doclength: %v", err)
+		}
+		docRecords = append(docRecords, docRecord)
+	}
+	if scanner.scanner.Err() != nil {
+		return nil, scanner.errorf("%v", scanner.scanner.Err())
+	}
+	return docRecords, nil
+}
+
+// readDelimitedDocRecordsDump reads a csv or tsv doc records dump.
+func readDelimitedDocRecordsDump(path string, format string) ([]*ciff.DocRecord, error) {
+	fileHandle, scanner, err := openDelimitedDump(path, format, delimitedDocRecordsColumns)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+	docRecords := make([]*ciff.DocRecord, 0)
+	for scanner.scan() {
+		docRecord := &ciff.DocRecord{CollectionDocid: scanner.record[1]}
+		docRecord.Docid, err = parseInt32(scanner.record[0])
+		if err != nil {
+			return nil, scanner.errorf("docid: %v", err)
+		}
+		docRecord.Doclength, err = parseInt32(scanner.record[2])
+		if err != nil {
+			return nil, scanner.errorf("doclength: %v", err)
+		}
+		docRecords = append(docRecords, docRecord)
+	}
+	if scanner.error() != nil {
+		return nil, scanner.error()
+	}
+	return docRecords, nil
+}
+
+// recount recomputes the header counts and statistics and the df and cf of every postings list, so
+// hand-edited dumps need not be kept consistent. The header describes the imported collection only.
+func recount(header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord) {
+	for _, postingsList := range postingsLists {
+		postingsList.Df = int64(len(postingsList.Postings))
+		postingsList.Cf = 0
+		for _, posting := range postingsList.Postings {
+			postingsList.Cf += int64(posting.Tf)
+		}
+	}
+	header.NumPostingsLists = int32(len(postingsLists))
+	header.TotalPostingsLists = header.NumPostingsLists
+	header.NumDocs = int32(len(docRecords))
+	header.TotalDocs = header.NumDocs
+	header.TotalTermsInCollection = 0
+	for _, docRecord := range docRecords {
+		header.TotalTermsInCollection += int64(docRecord.Doclength)
+	}
+	header.AverageDoclength = 0
+	if header.NumDocs > 0 {
+		header.AverageDoclength = float64(header.TotalTermsInCollection) / float64(header.NumDocs)
+	}
+}
+
+func importCommand(arguments []string) int {
+	flags := flag.NewFlagSet("import", flag.ExitOnError)
+	inputDirectory := flags.String("inputDirectory", "output", "The directory holding the output.header, output.postings and output.docRecords dumps to import.")
+	format := flags.String("format", "text", fmt.Sprintf("Format of the dumps, one of %v.", importFormatNames))
+	outputCiffFilePath := flags.String("outputCiffFilePath", "", "filepath of the CIFF file to write. Any existing file is overwritten!")
+	recountFlag := flags.Bool("recount", false, "Bool to recompute the header counts and statistics and each postings list's df and cf instead of trusting the dumps. Defaults to false.")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to encode with.")
+	flags.Parse(arguments)
+
+	if *outputCiffFilePath == "" {
+		fmt.Println("Please provide an output CIFF file!")
+		return 1
+	}
+	if !slices.Contains(importFormatNames, *format) {
+		fmt.Printf("Unknown format %q, expected one of %v!\n", *format, importFormatNames)
+		return 1
+	}
+	dumpPath := func(name string) string {
+		return filepath.Join(*inputDirectory, name+formatExtensions[*format])
+	}
+
+	slog.Info("reading header")
+	header, err := readHeaderDump(dumpPath("output.header"), *format)
+	if err != nil {
+		slog.Error("error reading header", "error", err)
+		return 1
+	}
+	slog.Info("reading postings lists")
+	postingsLists, err := readPostingsDump(dumpPath("output.postings"), *format)
+	if err != nil {
+		slog.Error("error reading postings", "error", err)
+		return 1
+	}
+	slog.Info("reading doc records")
+	docRecords, err := readDocRecordsDump(dumpPath("output.docRecords"), *format)
+	if err != nil {
+		slog.Error("error reading docRecords", "error", err)
+		return 1
+	}
+	if *recountFlag {
+		recount(header, postingsLists, docRecords)
+	}
+
+	ciffWriter := CiffWriter{writeCiff: true, ciffFilePath: *outputCiffFilePath, workers: *workers}
+	err = ciffWriter.WriteCiff(header, postingsLists, docRecords)
+	if err != nil {
+		return 1
+	}
+	slog.Info("complete")
+	return 0
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+)
+
+// dumpTestIndex returns the small test index, with terms, docids and a description that need quoting in
+// every format but text, which cannot hold them.
+func dumpTestIndex(format string) (*ciff.Header, []*ciff.PostingsList, []*ciff.DocRecord) {
+	header, postingsLists, docRecords := cifftest.Small()
+	if format != "text" {
+		header.Description = "a test collection\nwith \"quotes\", commas,\tand tabs"
+		postingsLists[0].Term = "apple, \"pie\""
+		postingsLists[1].Term = "banana\tsplit"
+		postingsLists[3].Term = "dátè"
+		docRecords[2].CollectionDocid = "doc c, \"third\""
+	}
+	return header, postingsLists, docRecords
+}
+
+// importTestDumps imports the dumps in directory and returns the path of the CIFF written.
+func importTestDumps(t *testing.T, directory string, format string, arguments ...string) string {
+	t.Helper()
+	importedPath := filepath.Join(directory, "imported.ciff")
+	arguments = append([]string{"-inputDirectory", directory, "-format", format, "-outputCiffFilePath", importedPath}, arguments...)
+	status := importCommand(arguments)
+	if status != 0 {
+		t.Fatalf("import exited with status %d", status)
+	}
+	return importedPath
+}
+
+func TestDumpImportRoundTrip(t *testing.T) {
+	for _, format := range FormatNames {
+		t.Run(format, func(t *testing.T) {
+			header, postingsLists, docRecords := dumpTestIndex(format)
+			originalPath := writeTestCiff(t, "original.ciff", header, postingsLists, docRecords)
+
+			directory := t.TempDir()
+			fileWriter := FileWriter{
+				writeHeader:     true,
+				writeDict:       true,
+				writePostings:   true,
+				writeDocRecords: true,
+				outputDirectory: directory,
+				format:          format,
+			}
+			fileWriter.CiffToHuman(header, postingsLists, docRecords)
+			importedPath := importTestDumps(t, directory, format, "-workers", "2")
+			if !bytes.Equal(readTestFile(t, importedPath), readTestFile(t, originalPath)) {
+				t.Errorf("imported CIFF differs from the original")
+			}
+		})
+	}
+}
+
+func TestImportRecount(t *testing.T) {
+	header, postingsLists, docRecords := dumpTestIndex("jsonl")
+	originalPath := writeTestCiff(t, "original.ciff", header, postingsLists, docRecords)
+
+	// Dump counts and statistics that -recount has to correct.
+	directory := t.TempDir()
+	wrongHeader := &ciff.Header{Version: 1, NumPostingsLists: 9, NumDocs: 9, TotalPostingsLists: 9, TotalDocs: 9, TotalTermsInCollection: 99, AverageDoclength: 9, Description: header.Description}
+	postingsLists[0].Df, postingsLists[0].Cf = 7, 7
+	fileWriter := FileWriter{writeHeader: true, writePostings: true, writeDocRecords: true, outputDirectory: directory, format: "jsonl"}
+	fileWriter.CiffToHuman(wrongHeader, postingsLists, docRecords)
+	importedPath := importTestDumps(t, directory, "jsonl", "-recount")
+	if !bytes.Equal(readTestFile(t, importedPath), readTestFile(t, originalPath)) {
+		t.Errorf("recounted CIFF differs from the original")
+	}
+}
+
+func TestImportRejectsMalformedDumps(t *testing.T) {
+	tests := []struct {
+		name, format, file, content string
+	}{
+		{"text postings without tf", "text", "output.postings", "apple\t1\t1\t0\n"},
+		{"jsonl postings not json", "jsonl", "output.postings.jsonl", "{\"term\": \"apple\"\n"},
+		{"csv wrong columns", "csv", "output.postings.csv", "term,df,docid,tf\napple,1,0,1\n"},
+		{"tsv tf not a number", "tsv", "output.postings.tsv", "term\tdf\tcf\tdocid\ttf\napple\t1\t1\t0\tone\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			directory := t.TempDir()
+			header, postingsLists, docRecords := dumpTestIndex(test.format)
+			fileWriter := FileWriter{writeHeader: true, writePostings: true, writeDocRecords: true, outputDirectory: directory, format: test.format}
+			fileWriter.CiffToHuman(header, postingsLists, docRecords)
+			err := os.WriteFile(filepath.Join(directory, test.file), []byte(test.content), 0666)
+			if err != nil {
+				t.Fatal(err)
+			}
+			status := importCommand([]string{"-inputDirectory", directory, "-format", test.format, "-outputCiffFilePath", filepath.Join(directory, "imported.ciff")})
+			if status == 0 {
+				t.Errorf("import accepted %q", strings.TrimSpace(test.content))
+			}
+		})
+	}
+}
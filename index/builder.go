@@ -0,0 +1,147 @@
+package index
+
+import (
+	"iter"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/Axiomatic314/ciffTools/analysis"
+	"github.com/Axiomatic314/ciffTools/ciff"
+)
+
+// analysisBatchSize is the number of documents analysed per worker before they are added in order.
+const analysisBatchSize = 256
+
+type termPostings struct {
+	docids []int32
+	tfs    []int32
+	cf     int64
+}
+
+// Builder accumulates the postings of a collection in memory. Documents are assigned docids in the order
+// they are added, starting from zero.
+type Builder struct {
+	analyzer   *analysis.Analyzer
+	workers    int
+	terms      map[string]*termPostings
+	docRecords []*ciff.DocRecord
+	totalTerms int64
+	counts     map[string]int32
+}
+
+// NewBuilder returns a Builder that analyses documents with analyzer on workers goroutines.
+func NewBuilder(analyzer *analysis.Analyzer, workers int) *Builder {
+	return &Builder{
+		analyzer: analyzer,
+		workers:  max(workers, 1),
+		terms:    make(map[string]*termPostings),
+		counts:   make(map[string]int32),
+	}
+}
+
+// AddDocuments analyses and adds every document, stopping at the first error. The index does not depend
+// on the number of workers.
+func (builder *Builder) AddDocuments(documents iter.Seq2[Document, error]) error {
+	batch := make([]Document, 0, analysisBatchSize*builder.workers)
+	terms := make([][]string, cap(batch))
+	flush := func() {
+		var wg sync.WaitGroup
+		for worker := range builder.workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for documentIndex := worker; documentIndex < len(batch); documentIndex += builder.workers {
+					terms[documentIndex] = builder.analyzer.Analyze(batch[documentIndex].Contents)
+				}
+			}()
+		}
+		wg.Wait()
+		for documentIndex, document := range batch {
+			builder.Add(document.ID, terms[documentIndex])
+		}
+		batch = batch[:0]
+	}
+	for document, err := range documents {
+		if err != nil {
+			return err
+		}
+		batch = append(batch, document)
+		if len(batch) == cap(batch) {
+			flush()
+		}
+	}
+	flush()
+	return nil
+}
+
+// Add adds a document holding the analysed terms, returning its docid.
+func (builder *Builder) Add(collectionDocid string, terms []string) int32 {
+	docid := int32(len(builder.docRecords))
+	clear(builder.counts)
+	for _, term := range terms {
+		builder.counts[term]++
+	}
+	for term, tf := range builder.counts {
+		postings, ok := builder.terms[term]
+		if !ok {
+			// Terms may be slices of the document, which must not be kept alive by the dictionary.
+			postings = &termPostings{}
+			builder.terms[strings.Clone(term)] = postings
+		}
+		postings.docids = append(postings.docids, docid)
+		postings.tfs = append(postings.tfs, tf)
+		postings.cf += int64(tf)
+	}
+	builder.docRecords = append(builder.docRecords, &ciff.DocRecord{Docid: docid, CollectionDocid: collectionDocid, Doclength: int32(len(terms))})
+	builder.totalTerms += int64(len(terms))
+	return docid
+}
+
+// NumDocs returns the number of documents added so far.
+func (builder *Builder) NumDocs() int32 {
+	return int32(len(builder.docRecords))
+}
+
+// Header returns the header of the index built so far.
+func (builder *Builder) Header(description string) *ciff.Header {
+	numDocs := int32(len(builder.docRecords))
+	averageDocLength := 0.0
+	if numDocs > 0 {
+		averageDocLength = float64(builder.totalTerms) / float64(numDocs)
+	}
+	return &ciff.Header{
+		Version:                1,
+		NumPostingsLists:       int32(len(builder.terms)),
+		NumDocs:                numDocs,
+		TotalPostingsLists:     int32(len(builder.terms)),
+		TotalDocs:              numDocs,
+		TotalTermsInCollection: builder.totalTerms,
+		AverageDoclength:       averageDocLength,
+		Description:            description,
+	}
+}
+
+// PostingsLists returns the postings lists of the index built so far, sorted by term.
+func (builder *Builder) PostingsLists() []*ciff.PostingsList {
+	terms := make([]string, 0, len(builder.terms))
+	for term := range builder.terms {
+		terms = append(terms, term)
+	}
+	slices.Sort(terms)
+	postingsLists := make([]*ciff.PostingsList, len(terms))
+	for termIndex, term := range terms {
+		postings := builder.terms[term]
+		postingsList := &ciff.PostingsList{Term: term, Df: int64(len(postings.docids)), Cf: postings.cf, Postings: make([]*ciff.Posting, len(postings.docids))}
+		for postingIndex, docid := range postings.docids {
+			postingsList.Postings[postingIndex] = &ciff.Posting{Docid: docid, Tf: postings.tfs[postingIndex]}
+		}
+		postingsLists[termIndex] = postingsList
+	}
+	return postingsLists
+}
+
+// DocRecords returns the doc records of the index built so far.
+func (builder *Builder) DocRecords() []*ciff.DocRecord {
+	return builder.docRecords
+}
@@ -0,0 +1,96 @@
+package index
+
+import (
+	"fmt"
+	"iter"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/analysis"
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"google.golang.org/protobuf/proto"
+)
+
+func documents(contents ...string) iter.Seq2[Document, error] {
+	return func(yield func(Document, error) bool) {
+		for documentIndex, text := range contents {
+			if !yield(Document{ID: fmt.Sprintf("doc-%d", documentIndex), Contents: text}, nil) {
+				return
+			}
+		}
+	}
+}
+
+func TestBuilder(t *testing.T) {
+	analyzer, err := analysis.New("lowercase")
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := NewBuilder(analyzer, 2)
+	err = builder.AddDocuments(documents("The cat sat", "the Dog", "cat CAT cat dog"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := builder.Header("test")
+	expectedHeader := &ciff.Header{Version: 1, NumPostingsLists: 4, NumDocs: 3, TotalPostingsLists: 4, TotalDocs: 3, TotalTermsInCollection: 9, AverageDoclength: 3, Description: "test"}
+	if !proto.Equal(header, expectedHeader) {
+		t.Errorf("header = %v, want %v", header, expectedHeader)
+	}
+	expectedPostingsLists := []*ciff.PostingsList{
+		{Term: "cat", Df: 2, Cf: 4, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}, {Docid: 2, Tf: 3}}},
+		{Term: "dog", Df: 2, Cf: 2, Postings: []*ciff.Posting{{Docid: 1, Tf: 1}, {Docid: 2, Tf: 1}}},
+		{Term: "sat", Df: 1, Cf: 1, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}}},
+		{Term: "the", Df: 2, Cf: 2, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}, {Docid: 1, Tf: 1}}},
+	}
+	postingsLists := builder.PostingsLists()
+	if len(postingsLists) != len(expectedPostingsLists) {
+		t.Fatalf("%d postings lists, want %d", len(postingsLists), len(expectedPostingsLists))
+	}
+	for listIndex, postingsList := range postingsLists {
+		if !proto.Equal(postingsList, expectedPostingsLists[listIndex]) {
+			t.Errorf("postings list %d = %v, want %v", listIndex, postingsList, expectedPostingsLists[listIndex])
+		}
+	}
+	expectedDocRecords := []*ciff.DocRecord{
+		{Docid: 0, CollectionDocid: "doc-0", Doclength: 3},
+		{Docid: 1, CollectionDocid: "doc-1", Doclength: 2},
+		{Docid: 2, CollectionDocid: "doc-2", Doclength: 4},
+	}
+	for docRecordIndex, docRecord := range builder.DocRecords() {
+		if !proto.Equal(docRecord, expectedDocRecords[docRecordIndex]) {
+			t.Errorf("doc record %d = %v, want %v", docRecordIndex, docRecord, expectedDocRecords[docRecordIndex])
+		}
+	}
+}
+
+func TestBuilderWorkers(t *testing.T) {
+	analyzer, err := analysis.New("anserini")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Enough documents to fill several batches of every worker.
+	contents := make([]string, 3000)
+	for documentIndex := range contents {
+		contents[documentIndex] = fmt.Sprintf("document %d mentions term%d and term%d's neighbours", documentIndex, documentIndex%97, documentIndex%13)
+	}
+	var want []*ciff.PostingsList
+	for _, workers := range []int{1, 2, 3, 8} {
+		builder := NewBuilder(analyzer, workers)
+		err = builder.AddDocuments(documents(contents...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		postingsLists := builder.PostingsLists()
+		if want == nil {
+			want = postingsLists
+			continue
+		}
+		if len(postingsLists) != len(want) {
+			t.Fatalf("%d workers: %d postings lists, want %d", workers, len(postingsLists), len(want))
+		}
+		for listIndex := range want {
+			if !proto.Equal(postingsLists[listIndex], want[listIndex]) {
+				t.Fatalf("%d workers: postings list %q differs", workers, want[listIndex].Term)
+			}
+		}
+	}
+}
@@ -0,0 +1,193 @@
+// Package index builds CIFF indexes from document collections.
+package index
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"iter"
+	"strings"
+)
+
+// Document is a document of a collection, identified by its collection docid.
+type Document struct {
+	ID       string
+	Contents string
+}
+
+// CollectionFormats lists the collection formats accepted by ReadCollection.
+//   - trec: TREC SGML, <DOC> elements holding a <DOCNO> and the text in trecContentElements.
+//   - jsonl: one JSON object per line with "id" and "contents" fields, as read by Anserini's
+//     JsonCollection.
+var CollectionFormats = []string{"trec", "jsonl"}
+
+// trecContentElements are the elements of a TREC document whose text is indexed. A document with none of
+// them is indexed in full, apart from its DOCNO.
+var trecContentElements = map[string]bool{
+	"TEXT": true, "HEADLINE": true, "TITLE": true, "HL": true, "HEAD": true,
+	"TTL": true, "DD": true, "DATE": true, "LP": true, "LEADPARA": true,
+}
+
+// maxLineLength bounds a single line of a collection.
+const maxLineLength = 1 << 30
+
+// ReadCollection yields the documents of reader, which holds a collection in format.
+func ReadCollection(reader io.Reader, format string) (iter.Seq2[Document, error], error) {
+	switch format {
+	case "trec":
+		return ReadTrec(reader), nil
+	case "jsonl":
+		return ReadJSONL(reader), nil
+	default:
+		return nil, fmt.Errorf("unknown collection format %q, expected one of %v", format, CollectionFormats)
+	}
+}
+
+// ReadTrec yields the documents of a TREC SGML collection.
+func ReadTrec(reader io.Reader) iter.Seq2[Document, error] {
+	return func(yield func(Document, error) bool) {
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+		var text strings.Builder
+		inside := false
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			rest := scanner.Text()
+			for {
+				if !inside {
+					start := strings.Index(rest, "<DOC>")
+					if start < 0 {
+						break
+					}
+					inside = true
+					text.Reset()
+					rest = rest[start+len("<DOC>"):]
+					continue
+				}
+				end := strings.Index(rest, "</DOC>")
+				if end < 0 {
+					text.WriteString(rest)
+					text.WriteByte('\n')
+					break
+				}
+				text.WriteString(rest[:end])
+				inside = false
+				rest = rest[end+len("</DOC>"):]
+				document, err := parseTrecDocument(text.String())
+				if err != nil {
+					err = fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				if !yield(document, err) || err != nil {
+					return
+				}
+			}
+		}
+		if scanner.Err() != nil {
+			yield(Document{}, scanner.Err())
+			return
+		}
+		if inside {
+			yield(Document{}, errors.New("unterminated <DOC> at end of collection"))
+		}
+	}
+}
+
+func parseTrecDocument(text string) (Document, error) {
+	_, rest, found := strings.Cut(text, "<DOCNO>")
+	docno, _, closed := strings.Cut(rest, "</DOCNO>")
+	if !found || !closed {
+		return Document{}, errors.New("document without a <DOCNO>")
+	}
+	document := Document{ID: strings.TrimSpace(docno)}
+
+	var contents strings.Builder
+	rest = text
+	for {
+		open := strings.IndexByte(rest, '<')
+		if open < 0 {
+			break
+		}
+		length := strings.IndexByte(rest[open:], '>')
+		if length < 0 {
+			break
+		}
+		name, _, _ := strings.Cut(rest[open+1:open+length], " ")
+		rest = rest[open+length+1:]
+		if !trecContentElements[name] {
+			continue
+		}
+		end := strings.Index(rest, "</"+name+">")
+		if end < 0 {
+			end = len(rest)
+		}
+		contents.WriteString(stripTags(rest[:end]))
+		contents.WriteByte('\n')
+		rest = rest[end:]
+	}
+	if contents.Len() == 0 {
+		before, _, _ := strings.Cut(text, "<DOCNO>")
+		_, after, _ := strings.Cut(text, "</DOCNO>")
+		contents.WriteString(stripTags(before + "\n" + after))
+	}
+	document.Contents = contents.String()
+	return document, nil
+}
+
+// stripTags replaces the SGML tags of text with spaces and unescapes its character references.
+func stripTags(text string) string {
+	var stripped strings.Builder
+	for {
+		open := strings.IndexByte(text, '<')
+		if open < 0 {
+			break
+		}
+		length := strings.IndexByte(text[open:], '>')
+		if length < 0 {
+			break
+		}
+		stripped.WriteString(text[:open])
+		stripped.WriteByte(' ')
+		text = text[open+length+1:]
+	}
+	stripped.WriteString(text)
+	return html.UnescapeString(stripped.String())
+}
+
+type jsonDocument struct {
+	ID       *string `json:"id"`
+	Contents string  `json:"contents"`
+}
+
+// ReadJSONL yields the documents of a collection with one JSON object per line.
+func ReadJSONL(reader io.Reader) iter.Seq2[Document, error] {
+	return func(yield func(Document, error) bool) {
+		scanner := bufio.NewScanner(reader)
+		scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+		lineNumber := 0
+		for scanner.Scan() {
+			lineNumber++
+			if strings.TrimSpace(scanner.Text()) == "" {
+				continue
+			}
+			var document jsonDocument
+			err := json.Unmarshal(scanner.Bytes(), &document)
+			if err == nil && document.ID == nil {
+				err = errors.New("document without an \"id\"")
+			}
+			if err != nil {
+				yield(Document{}, fmt.Errorf("line %d: %w", lineNumber, err))
+				return
+			}
+			if !yield(Document{ID: *document.ID, Contents: document.Contents}, nil) {
+				return
+			}
+		}
+		if scanner.Err() != nil {
+			yield(Document{}, scanner.Err())
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package index
+
+import (
+	"strings"
+	"testing"
+)
+
+func readAll(t *testing.T, collection string, format string) ([]Document, error) {
+	t.Helper()
+	documents, err := ReadCollection(strings.NewReader(collection), format)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read := make([]Document, 0)
+	for document, err := range documents {
+		if err != nil {
+			return read, err
+		}
+		read = append(read, document)
+	}
+	return read, nil
+}
+
+func TestReadTrec(t *testing.T) {
+	collection := `<DOC>
+<DOCNO> FT911-1 </DOCNO>
+<PROFILE>_AN-BEOA7AAIFT</PROFILE>
+<HEADLINE>Markets &amp; money</HEADLINE>
+<TEXT>
+Shares <i>rose</i> sharply.
+</TEXT>
+</DOC>
+<DOC><DOCNO>WSJ-2</DOCNO>untagged text</DOC><DOC><DOCNO>WSJ-3</DOCNO><TEXT>same line</TEXT></DOC>
+`
+	documents, err := readAll(t, collection, "trec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Document{
+		{ID: "FT911-1", Contents: "Markets & money\n\nShares  rose  sharply.\n\n"},
+		{ID: "WSJ-2", Contents: "\nuntagged text"},
+		{ID: "WSJ-3", Contents: "same line\n"},
+	}
+	if len(documents) != len(expected) {
+		t.Fatalf("read %d documents, want %d", len(documents), len(expected))
+	}
+	for documentIndex, document := range documents {
+		if document != expected[documentIndex] {
+			t.Errorf("document %d = %q, want %q", documentIndex, document, expected[documentIndex])
+		}
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	collection := "{\"id\": \"a\", \"contents\": \"first\"}\n\n{\"id\": \"b\", \"contents\": \"second\", \"title\": \"ignored\"}\n"
+	documents, err := readAll(t, collection, "jsonl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []Document{{ID: "a", Contents: "first"}, {ID: "b", Contents: "second"}}
+	if len(documents) != len(expected) || documents[0] != expected[0] || documents[1] != expected[1] {
+		t.Errorf("documents = %q, want %q", documents, expected)
+	}
+}
+
+func TestReadCollectionErrors(t *testing.T) {
+	tests := []struct {
+		name, format, collection, err string
+		read                          int
+	}{
+		{"trec without docno", "trec", "<DOC><DOCNO>a</DOCNO></DOC>\n<DOC>text</DOC>\n", "line 2: document without a <DOCNO>", 1},
+		{"trec unterminated", "trec", "<DOC><DOCNO>a</DOCNO>\ntext\n", "unterminated <DOC>", 0},
+		{"jsonl without id", "jsonl", "{\"id\": \"a\"}\n{\"contents\": \"text\"}\n", "line 2: document without an \"id\"", 1},
+		{"jsonl not json", "jsonl", "{\"id\": \"a\"\n", "line 1:", 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			documents, err := readAll(t, test.collection, test.format)
+			if err == nil || !strings.Contains(err.Error(), test.err) {
+				t.Errorf("error %v, want it to contain %q", err, test.err)
+			}
+			if len(documents) != test.read {
+				t.Errorf("read %d documents before the error, want %d", len(documents), test.read)
+			}
+		})
+	}
+	_, err := ReadCollection(strings.NewReader(""), "warc")
+	if err == nil {
+		t.Error("accepted an unknown collection format")
+	}
+}
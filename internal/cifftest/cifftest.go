@@ -0,0 +1,115 @@
+// Package cifftest builds small in-memory indexes for the tests of the other packages. Postings hold
+// absolute docids, as they do once read by ciffio.
+package cifftest
+
+import (
+	"fmt"
+	"math/rand"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"google.golang.org/protobuf/proto"
+)
+
+// Small returns a hand-written index of four terms, one of them without postings, over three documents.
+func Small() (*ciff.Header, []*ciff.PostingsList, []*ciff.DocRecord) {
+	postingsLists := []*ciff.PostingsList{
+		{Term: "apple", Df: 2, Cf: 3, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}, {Docid: 2, Tf: 2}}},
+		{Term: "banana", Df: 3, Cf: 3, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}, {Docid: 1, Tf: 1}, {Docid: 2, Tf: 1}}},
+		{Term: "cherry", Df: 0, Cf: 0, Postings: []*ciff.Posting{}},
+		{Term: "date", Df: 1, Cf: 4, Postings: []*ciff.Posting{{Docid: 1, Tf: 4}}},
+	}
+	docRecords := []*ciff.DocRecord{
+		{Docid: 0, CollectionDocid: "doc-a", Doclength: 2},
+		{Docid: 1, CollectionDocid: "doc-b", Doclength: 5},
+		{Docid: 2, CollectionDocid: "doc-c", Doclength: 3},
+	}
+	header := &ciff.Header{
+		Version:                1,
+		NumPostingsLists:       int32(len(postingsLists)),
+		NumDocs:                int32(len(docRecords)),
+		TotalPostingsLists:     int32(len(postingsLists)),
+		TotalDocs:              int32(len(docRecords)),
+		TotalTermsInCollection: 10,
+		AverageDoclength:       10.0 / 3,
+		Description:            "test index",
+	}
+	return header, postingsLists, docRecords
+}
+
+// Random returns an index of numTerms terms named term000, term001 and so on over numDocs documents,
+// drawn from seed. Term i occurs in a document with probability 0.9/(1 + i%20), so the lists range from
+// dense to sparse, with tfs from 1 to maxTf. Each doc length is the sum of its tfs plus up to 50 terms
+// outside the index, and the header statistics match the documents.
+func Random(seed int64, numTerms int, numDocs int32, maxTf int32) (*ciff.Header, []*ciff.PostingsList, []*ciff.DocRecord) {
+	random := rand.New(rand.NewSource(seed))
+	docLengths := make([]int32, numDocs)
+	postingsLists := make([]*ciff.PostingsList, numTerms)
+	for termIndex := range postingsLists {
+		postingsList := &ciff.PostingsList{Term: fmt.Sprintf("term%03d", termIndex), Postings: []*ciff.Posting{}}
+		density := 0.9 / float64(1+termIndex%20)
+		for docid := range numDocs {
+			if random.Float64() >= density {
+				continue
+			}
+			tf := 1 + random.Int31n(maxTf)
+			postingsList.Postings = append(postingsList.Postings, &ciff.Posting{Docid: docid, Tf: tf})
+			postingsList.Df++
+			postingsList.Cf += int64(tf)
+			docLengths[docid] += tf
+		}
+		postingsLists[termIndex] = postingsList
+	}
+	docRecords := make([]*ciff.DocRecord, numDocs)
+	totalTerms := int64(0)
+	for docid := range numDocs {
+		docLengths[docid] += random.Int31n(51)
+		docRecords[docid] = &ciff.DocRecord{Docid: docid, CollectionDocid: fmt.Sprintf("doc-%d", docid), Doclength: docLengths[docid]}
+		totalTerms += int64(docLengths[docid])
+	}
+	header := &ciff.Header{
+		Version:                1,
+		NumPostingsLists:       int32(numTerms),
+		NumDocs:                numDocs,
+		TotalPostingsLists:     int32(numTerms),
+		TotalDocs:              numDocs,
+		TotalTermsInCollection: totalTerms,
+		AverageDoclength:       float64(totalTerms) / float64(max(numDocs, 1)),
+		Description:            "random test index",
+	}
+	return header, postingsLists, docRecords
+}
+
+// ClonePostingsLists returns deep copies of postingsLists, for code that rewrites postings in place.
+func ClonePostingsLists(postingsLists []*ciff.PostingsList) []*ciff.PostingsList {
+	clones := make([]*ciff.PostingsList, len(postingsLists))
+	for listIndex, postingsList := range postingsLists {
+		clones[listIndex] = proto.Clone(postingsList).(*ciff.PostingsList)
+	}
+	return clones
+}
+
+// EqualPostingsLists reports whether a and b hold the same postings lists in the same order.
+func EqualPostingsLists(a []*ciff.PostingsList, b []*ciff.PostingsList) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for listIndex := range a {
+		if !proto.Equal(a[listIndex], b[listIndex]) {
+			return false
+		}
+	}
+	return true
+}
+
+// EqualDocRecords reports whether a and b hold the same doc records in the same order.
+func EqualDocRecords(a []*ciff.DocRecord, b []*ciff.DocRecord) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for docRecordIndex := range a {
+		if !proto.Equal(a[docRecordIndex], b[docRecordIndex]) {
+			return false
+		}
+	}
+	return true
+}
@@ -2,13 +2,13 @@ package main
 
 import (
 	"bufio"
-	"encoding/binary"
 	"flag"
 	"fmt"
-	"io"
 	"log/slog"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
 
 	"github.com/Axiomatic314/ciffTools/ciff"
 	"github.com/Axiomatic314/ciffTools/quantize"
@@ -28,143 +28,101 @@ func isFlagPassed(name string) bool {
 type FileWriter struct {
 	writeHeader, writeDict, writePostings, writeDocRecords bool
 	outputDirectory                                        string
+	format                                                 string // one of FormatNames
+}
+
+// dump creates the output file name, suffixed for the format, and fills it with write.
+func (writer FileWriter) dump(name string, section string, write func(format dumpFormat) error) {
+	fileHandle, err := os.Create(filepath.Join(writer.outputDirectory, name+formatExtensions[writer.format]))
+	if err != nil {
+		slog.Error(fmt.Sprintf("error creating %s", section), "error", err)
+		os.Exit(1)
+	}
+	defer fileHandle.Close()
+	bufferedWriter := bufio.NewWriter(fileHandle)
+	format := newDumpFormat(writer.format, bufferedWriter)
+	err = write(format)
+	if err == nil {
+		err = format.flush()
+	}
+	if err == nil {
+		err = bufferedWriter.Flush()
+	}
+	if err != nil {
+		slog.Error(fmt.Sprintf("error writing %s", section), "error", err)
+		os.Exit(1)
+	}
 }
 
 func (writer FileWriter) CiffToHuman(header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord) {
 	//Header
 	if writer.writeHeader {
 		slog.Info("writing human-readable header")
-		headerFileHandle, err := os.Create(filepath.Join(writer.outputDirectory, "output.header"))
-		if err != nil {
-			slog.Error("error creating header", "error", err)
-			os.Exit(1)
-		}
-		defer headerFileHandle.Close()
-		headerWriter := bufio.NewWriter(headerFileHandle)
-		headerWriter.WriteString(fmt.Sprintf("Version: %v\n", header.Version))
-		headerWriter.WriteString(fmt.Sprintf("NumPostingsLists: %v\n", header.NumPostingsLists))
-		headerWriter.WriteString(fmt.Sprintf("NumDocs: %v\n", header.NumDocs))
-		headerWriter.WriteString(fmt.Sprintf("TotalPostingsLists: %v\n", header.TotalPostingsLists))
-		headerWriter.WriteString(fmt.Sprintf("TotalDocs: %v\n", header.TotalDocs))
-		headerWriter.WriteString(fmt.Sprintf("TotalTermsInCollection: %v\n", header.TotalTermsInCollection))
-		headerWriter.WriteString(fmt.Sprintf("AverageDocLength: %v\n", header.AverageDoclength))
-		headerWriter.WriteString(fmt.Sprintf("Description: %v\n", header.Description))
-		headerWriter.Flush()
+		writer.dump("output.header", "header", func(format dumpFormat) error {
+			return format.writeHeader(header)
+		})
 	}
 
 	//Dictionary
 	if writer.writeDict {
 		slog.Info("writing human-readable dictionary")
-		dictFileHandle, err := os.Create(filepath.Join(writer.outputDirectory, "output.dict"))
-		if err != nil {
-			slog.Error("error creating dictionary", "error", err)
-			os.Exit(1)
-		}
-		defer dictFileHandle.Close()
-		dictWriter := bufio.NewWriter(dictFileHandle)
-		for postingsListIndex := range postingsLists {
-			dictWriter.WriteString(postingsLists[postingsListIndex].Term)
-			dictWriter.WriteString("\n")
-		}
-		dictWriter.Flush()
+		writer.dump("output.dict", "dictionary", func(format dumpFormat) error {
+			err := format.beginDict()
+			if err != nil {
+				return err
+			}
+			for _, postingsList := range postingsLists {
+				err = format.writeTerm(postingsList)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	}
 
 	//PostingsLists
 	if writer.writePostings {
 		slog.Info("writing human-readable postings")
-		postingsFileHandle, err := os.Create(filepath.Join(writer.outputDirectory, "output.postings"))
-		if err != nil {
-			slog.Error("error opening postingsList", "error", err)
-			os.Exit(1)
-		}
-		defer postingsFileHandle.Close()
-		postingsWriter := bufio.NewWriter(postingsFileHandle)
-		postingsWriter.WriteString("term df cf (docid, tf) ... (docid, tf)\n")
-		postingsWriter.WriteString("--------------------------------------\n")
-		for _, postingsList := range postingsLists {
-			postingsWriter.WriteString(fmt.Sprintf("%s %d %d ", postingsList.Term, postingsList.Df, postingsList.Cf))
-			for _, posting := range postingsList.GetPostings() {
-				postingsWriter.WriteString(fmt.Sprintf("(%d, %d) ", posting.Docid, posting.Tf))
+		writer.dump("output.postings", "postingsList", func(format dumpFormat) error {
+			err := format.beginPostings()
+			if err != nil {
+				return err
 			}
-			postingsWriter.WriteString("\n")
-		}
-		postingsWriter.Flush()
+			for _, postingsList := range postingsLists {
+				err = format.writePostingsList(postingsList)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	}
 
 	//DocRecords
 	if writer.writeDocRecords {
 		slog.Info("writing human-readable docRecords")
-		docRecordsFileHandle, err := os.Create(filepath.Join(writer.outputDirectory, "output.docRecords"))
-		if err != nil {
-			slog.Error("error opening docRecords", "error", err)
-			os.Exit(1)
-		}
-		defer docRecordsFileHandle.Close()
-		docRecordsWriter := bufio.NewWriter(docRecordsFileHandle)
-		docRecordsWriter.WriteString("docid collection_docid doclength\n")
-		docRecordsWriter.WriteString("--------------------------------\n")
-		for _, docRecord := range docRecords {
-			docRecordsWriter.WriteString(fmt.Sprintf("%d %s %d\n", docRecord.Docid, docRecord.CollectionDocid, docRecord.Doclength))
-		}
-		docRecordsWriter.Flush()
-	}
-}
-
-func ReadNextMessage(bufferedReader *bufio.Reader, messageStruct proto.Message) error {
-	sizeBuffer, err := bufferedReader.Peek(binary.MaxVarintLen64)
-	if err != nil {
-		slog.Debug("error trying to peek at message length", "error", err)
-	}
-	messageSize, bytesRead := binary.Uvarint(sizeBuffer)
-	bufferedReader.Discard(bytesRead)
-
-	byteBuffer := make([]byte, messageSize)
-	bytesRead, err = io.ReadFull(bufferedReader, byteBuffer)
-	slog.Debug("reading message", "messageSize", messageSize, "bufferSize", binary.Size(byteBuffer), "bytesRead", bytesRead)
-	if err != nil {
-		slog.Debug("error reading message bytes", "error", err)
-		return err
-	}
-
-	err = proto.Unmarshal(byteBuffer, messageStruct)
-	if err != nil {
-		slog.Debug("error during unmarshal", "error", err)
-		return err
-	}
-
-	return nil
-}
-
-func WriteNextMessage(bufferedWriter *bufio.Writer, messageStruct proto.Message) error {
-	byteBuffer, err := proto.Marshal(messageStruct)
-	if err != nil {
-		slog.Debug("error during marshal", "error", err)
-		return err
-	}
-
-	sizeBuffer := make([]byte, binary.MaxVarintLen64)
-	bytesWritten := binary.PutUvarint(sizeBuffer, uint64(len(byteBuffer)))
-
-	_, err = bufferedWriter.Write(sizeBuffer[:bytesWritten])
-	if err != nil {
-		slog.Debug("error writing message size", "error", err)
-		return err
-	}
-
-	_, err = bufferedWriter.Write(byteBuffer)
-	if err != nil {
-		slog.Debug("error writing message", "error", err)
-		return err
+		writer.dump("output.docRecords", "docRecords", func(format dumpFormat) error {
+			err := format.beginDocRecords()
+			if err != nil {
+				return err
+			}
+			for _, docRecord := range docRecords {
+				err = format.writeDocRecord(docRecord)
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
 	}
-
-	bufferedWriter.Flush()
-
-	return nil
 }
 
 type CiffWriter struct {
 	writeCiff    bool
 	ciffFilePath string
+	workers      int
+	provenance   *quantize.Provenance // appended to the header description when set
 }
 
 func (writer CiffWriter) WriteCiff(header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord) error {
@@ -172,54 +130,138 @@ func (writer CiffWriter) WriteCiff(header *ciff.Header, postingsLists []*ciff.Po
 		return nil
 	}
 	slog.Info("writing ciff")
-	ciffFileHandle, err := os.Create(writer.ciffFilePath)
-	if err != nil {
-		slog.Error("error writing ciff", "error", err)
-		return err
-	}
-	defer ciffFileHandle.Close()
-	ciffWriter := bufio.NewWriter(ciffFileHandle)
 
 	//Header
 	slog.Info("writing ciff header")
-	err = WriteNextMessage(ciffWriter, header)
+	if writer.provenance != nil {
+		description, err := writer.provenance.AppendTo(header.Description)
+		if err != nil {
+			slog.Error("error encoding provenance", "error", err)
+			return err
+		}
+		header = proto.Clone(header).(*ciff.Header)
+		header.Description = description
+	}
+	ciffFileHandle, ciffWriter, err := createCiff(writer.ciffFilePath, header, writer.workers)
 	if err != nil {
-		slog.Error("error writing header message", "error", err)
+		slog.Error("error writing ciff", "error", err)
 		return err
 	}
+	defer ciffFileHandle.Close()
 
 	//Postings
 	slog.Info("writing ciff postings lists")
-	for postingsListIndex := range header.NumPostingsLists {
-		postingsList := postingsLists[postingsListIndex]
-		//update docids to be d-gaps
-		postings := postingsLists[postingsListIndex].GetPostings()
-		prev := postings[0].GetDocid()
-		for postingsIndex := range postingsLists[postingsListIndex].GetDf() {
-			if postingsIndex > 0 {
-				abs_docid := postings[postingsIndex].GetDocid()
-				postings[postingsIndex].Docid = abs_docid - prev
-				prev = abs_docid
-			}
+	for postingsListIndex, postingsList := range postingsLists {
+		err = ciffWriter.WritePostingsList(postingsList)
+		if err != nil {
+			slog.Error("error writing postings list", "error", err)
+			return err
 		}
-		WriteNextMessage(ciffWriter, postingsList)
 		slog.Debug("postingsList written", "index", postingsListIndex)
 	}
 
 	//DocRecords
 	slog.Info("writing ciff doc records")
-	for docRecordIndex := range docRecords {
-		docRecord := docRecords[docRecordIndex]
-		WriteNextMessage(ciffWriter, docRecord)
+	for docRecordIndex, docRecord := range docRecords {
+		err = ciffWriter.WriteDocRecord(docRecord)
+		if err != nil {
+			slog.Error("error writing doc record", "error", err)
+			return err
+		}
 		slog.Debug("doc record written", "index", docRecordIndex)
 	}
 
+	err = ciffWriter.Close()
+	if err != nil {
+		slog.Error("error closing ciff", "error", err)
+		return err
+	}
 	return nil
 }
 
+// collectionStats returns the statistics the scorers of an index use. The document count is TotalDocs
+// when it is set, which a shard written with -globalStats takes from its whole collection along with
+// the average doc length and total terms. Df and cf are always those of the index itself.
+func collectionStats(header *ciff.Header) quantize.CollectionStats {
+	numDocs := header.NumDocs
+	if header.TotalDocs > 0 {
+		numDocs = header.TotalDocs
+	}
+	return quantize.CollectionStats{
+		NumDocs:          numDocs,
+		AverageDocLength: header.AverageDoclength,
+		TotalTerms:       header.TotalTermsInCollection,
+	}
+}
+
+// quantizeIndex replaces the tfs of an index held in memory with impacts, and completes provenance with
+// the score range and reconstruction points they were quantized with.
+func quantizeIndex(header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord, scorerName string, parameters quantize.Parameters, options quantize.Options, provenance *quantize.Provenance) error {
+	scorer, err := quantize.NewScorer(scorerName, parameters, collectionStats(header))
+	if err != nil {
+		return err
+	}
+	quantizer, err := quantize.NewQuantizer(scorer, options)
+	if err != nil {
+		return err
+	}
+	scoreRange := quantizer.QuantizeIndex(postingsLists, quantize.DocLengths(docRecords))
+	slog.Info("score range", "min", scoreRange.Min, "max", scoreRange.Max)
+	provenance.ScoreRange = scoreRange
+	provenance.Points = quantizer.Points()
+	return nil
+}
+
+// scorerFlags defines the -scorer flag and the parameter flags of the ranking functions on flags, with
+// the same defaults as quantizing. The returned function reads them once flags has been parsed.
+func scorerFlags(flags *flag.FlagSet) func() (string, quantize.Parameters) {
+	scorerName := flags.String("scorer", "atire-bm25", fmt.Sprintf("Ranking function, one of %v.", quantize.ScorerNames))
+	k1 := flags.Float64("k1", 0.9, "k1 value for BM25.")
+	b := flags.Float64("b", 0.4, "b value for BM25.")
+	delta := flags.Float64("delta", 0, "delta value for BM25+ and BM25L. Defaults to 1 for BM25+ and 0.5 for BM25L.")
+	mu := flags.Float64("mu", 1000, "mu value for query likelihood with Dirichlet smoothing.")
+	lambda := flags.Float64("lambda", 0.1, "lambda value for query likelihood with Jelinek-Mercer smoothing.")
+	c := flags.Float64("c", 1, "c value for PL2.")
+	return func() (string, quantize.Parameters) {
+		parameters := quantize.DefaultParameters(*scorerName)
+		parameters.K1, parameters.B = *k1, *b
+		parameters.Mu, parameters.Lambda, parameters.C = *mu, *lambda, *c
+		flags.Visit(func(f *flag.Flag) {
+			if f.Name == "delta" {
+				parameters.Delta = *delta
+			}
+		})
+		return *scorerName, parameters
+	}
+}
+
+// commands maps subcommand names to their entry points. Without a subcommand, the top-level flags
+// quantize and/or dump the given CIFF.
+var commands = map[string]func(arguments []string) int{
+	"validate":   validateCommand,
+	"provenance": provenanceCommand,
+	"dequantize": dequantizeCommand,
+	"import":     importCommand,
+	"build":      buildCommand,
+	"analyze":    analyzeCommand,
+	"merge":      mergeCommand,
+	"shard":      shardCommand,
+	"prune":      pruneCommand,
+	"reorder":    reorderCommand,
+	"search":     searchCommand,
+	"eval":       evalCommand,
+	"sweep":      sweepCommand,
+}
+
 func main() {
 	// slog.SetLogLoggerLevel(slog.LevelDebug)
 
+	if len(os.Args) > 1 {
+		if command, ok := commands[os.Args[1]]; ok {
+			os.Exit(command(os.Args[2:]))
+		}
+	}
+
 	ciffFilePath := flag.String("ciffFilePath", "", "filepath of CIFF file to read in")
 	writeHeader := flag.Bool("writeHeader", false, "Bool to write header file. Defaults to false.")
 	writeDict := flag.Bool("writeDict", false, "Bool to write dictionary file. Defaults to false.")
@@ -227,17 +269,46 @@ func main() {
 	writeDocRecords := flag.Bool("writeDocRecords", false, "Bool to write docRecords file. Defaults to false.")
 	outputDirectory := flag.String("outputDirectory", "output", "The target output directory. If not already present, it is created relative to the current working directory. Any existing files are overwritten!")
 	writeCiff := flag.Bool("writeCiff", false, "Bool to write quantized ciff. Defaults to false.")
-	k1 := flag.Float64("k1", 0.9, "k1 value for BM25.")
-	b := flag.Float64("b", 0.4, "b value for BM25.")
+	scorer := scorerFlags(flag.CommandLine)
+	bits := flag.Int("bits", 8, fmt.Sprintf("Width of the quantized impacts, from 1 to %d bits so they fit the int32 Posting.Tf field.", quantize.MaxBits))
+	scheme := flag.String("scheme", "uniform", fmt.Sprintf("Quantization scheme, one of %v.", quantize.SchemeNames))
+	zeroImpact := flag.Bool("zeroImpact", false, "Bool to allow an impact of zero, so the lowest score maps to 0 instead of 1. Defaults to false.")
+	workers := flag.Int("workers", runtime.NumCPU(), "Number of goroutines to decode, quantize and encode with. The output does not depend on it.")
+	format := flag.String("format", "text", fmt.Sprintf("Format of the human-readable output, one of %v.", FormatNames))
+	streaming := flag.Bool("streaming", false, "Bool to quantize by streaming over the ciff instead of loading it into memory, reading the ciff three times. Only the quantized ciff is written. Defaults to false.")
 	flag.Parse()
 
 	if !isFlagPassed("ciffFilePath") {
 		fmt.Println("Please provide a CIFF file!")
 		os.Exit(1)
 	}
+	if !slices.Contains(FormatNames, *format) {
+		fmt.Printf("Unknown format %q, expected one of %v!\n", *format, FormatNames)
+		os.Exit(1)
+	}
 	_, ciffFile := filepath.Split(*ciffFilePath)
 
-	fmt.Printf("%f %f\n", *k1, *b)
+	scorerName, parameters := scorer()
+	fmt.Printf("%f %f\n", parameters.K1, parameters.B)
+
+	quantizeOptions := quantize.Options{Bits: int32(*bits), ZeroImpact: *zeroImpact, Scheme: *scheme, Workers: *workers}
+	provenance := &quantize.Provenance{
+		Scorer:      scorerName,
+		Parameters:  parameters,
+		Bits:        quantizeOptions.Bits,
+		ZeroImpact:  quantizeOptions.ZeroImpact,
+		Scheme:      quantizeOptions.Scheme,
+		ToolVersion: toolVersion(),
+		Source:      ciffFile,
+	}
+	if *writeCiff {
+		sourceSHA256, err := hashFile(*ciffFilePath)
+		if err != nil {
+			slog.Error("error hashing ciff", "error", err)
+			os.Exit(1)
+		}
+		provenance.SourceSHA256 = sourceSHA256
+	}
 
 	outputFileWriter := FileWriter{
 		writeHeader:     *writeHeader,
@@ -245,78 +316,98 @@ func main() {
 		writePostings:   *writePostings,
 		writeDocRecords: *writeDocRecords,
 		outputDirectory: *outputDirectory,
+		format:          *format,
 	}
 
 	outputCiffWriter := CiffWriter{
 		writeCiff:    *writeCiff,
 		ciffFilePath: filepath.Join(*outputDirectory, fmt.Sprintf("q-%s", ciffFile)),
+		workers:      *workers,
+		provenance:   provenance,
 	}
 
-	ciffFileHandle, err := os.Open(*ciffFilePath)
+	if *streaming {
+		if !*writeCiff {
+			fmt.Println("-streaming requires -writeCiff!")
+			os.Exit(1)
+		}
+		if *writeHeader || *writeDict || *writePostings || *writeDocRecords {
+			fmt.Println("Human-readable output is not supported with -streaming!")
+			os.Exit(1)
+		}
+		err := os.Mkdir(*outputDirectory, 0777)
+		if err != nil && !os.IsExist(err) {
+			slog.Error("cannot create output directory", "error", err)
+			os.Exit(1)
+		}
+		streamingQuantizer := StreamingQuantizer{
+			ciffFilePath:       *ciffFilePath,
+			outputCiffFilePath: outputCiffWriter.ciffFilePath,
+			scorerName:         scorerName,
+			parameters:         parameters,
+			options:            quantizeOptions,
+			provenance:         *provenance,
+		}
+		err = streamingQuantizer.Quantize()
+		if err != nil {
+			slog.Error("error quantizing ciff", "error", err)
+			os.Exit(1)
+		}
+		slog.Info("complete")
+		return
+	}
+
+	ciffReader, err := openCiff(*ciffFilePath, *workers)
 	if err != nil {
 		slog.Error("error opening ciff", "error", err)
 		os.Exit(1)
 	}
-	defer ciffFileHandle.Close()
-	ciffReader := bufio.NewReader(ciffFileHandle)
+	defer ciffReader.Close()
 
 	// --------------------------------------------------------------------------------
 	// Header
 	slog.Info("reading header")
-	header := &ciff.Header{}
-	err = ReadNextMessage(ciffReader, header)
-	if err != nil {
-		slog.Error("error reading header message", "error", err)
-		os.Exit(1)
-	}
+	header := ciffReader.Header()
 
 	// --------------------------------------------------------------------------------
 	// PostingsList
 	slog.Info("reading postings lists")
-	postingsListSlice := make([]*ciff.PostingsList, header.NumPostingsLists)
-	n := header.NumPostingsLists / 10
-	for postingsListIndex := range header.NumPostingsLists {
-		if postingsListIndex%n == 0 {
-			slog.Info(fmt.Sprintf("postings list %d/%d", postingsListIndex, header.NumPostingsLists))
-		}
-		postingsList := &ciff.PostingsList{}
-		ReadNextMessage(ciffReader, postingsList)
-		postingsListSlice[postingsListIndex] = postingsList
-		slog.Debug("postingsList", "term", postingsList.Term, "docFreq", postingsList.Df, "postingLen", len(postingsList.Postings))
-		postings := postingsListSlice[postingsListIndex].Postings
-		if len(postings) <= 0 {
-			continue
-		}
-		prev := postings[0].Docid
-		if postingsList.Df != int64(len(postings)) {
-			slog.Error("Unexpected number of postings.", "DocFreq", postingsList.Df, "NumPostings", len(postings))
+	postingsListSlice := make([]*ciff.PostingsList, 0, header.NumPostingsLists)
+	n := max(header.NumPostingsLists/10, 1)
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			slog.Error("error reading postings list", "error", err)
 			os.Exit(1)
 		}
-		for postingsIndex := range postingsListSlice[postingsListIndex].Df {
-			if postingsIndex > 0 {
-				postings[postingsIndex].Docid += prev
-				prev = postings[postingsIndex].Docid
-			}
+		if int32(len(postingsListSlice))%n == 0 {
+			slog.Info(fmt.Sprintf("postings list %d/%d", len(postingsListSlice), header.NumPostingsLists))
 		}
-		slog.Debug("postingsList docids converted from d-gaps", "index", postingsListIndex)
+		postingsListSlice = append(postingsListSlice, postingsList)
+		slog.Debug("postingsList", "term", postingsList.Term, "docFreq", postingsList.Df, "postingLen", len(postingsList.Postings))
 	}
 
 	// --------------------------------------------------------------------------------
 	// DocRecord
 	slog.Info("reading doc records")
-	docRecordSlice := make([]*ciff.DocRecord, header.NumDocs)
-	for docRecordIndex := range header.NumDocs {
-		r := &ciff.DocRecord{}
-		ReadNextMessage(ciffReader, r)
-		docRecordSlice[docRecordIndex] = r
-		slog.Debug("docRecord decoded", "index", docRecordIndex, "docRecord", docRecordSlice[docRecordIndex])
+	docRecordSlice := make([]*ciff.DocRecord, 0, header.NumDocs)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			slog.Error("error reading doc record", "error", err)
+			os.Exit(1)
+		}
+		docRecordSlice = append(docRecordSlice, docRecord)
+		slog.Debug("docRecord decoded", "index", len(docRecordSlice)-1, "docRecord", docRecord)
 	}
 
 	// --------------------------------------------------------------------------------
 	// Quantize Index
 	if *writeCiff {
 		slog.Info("quantizing index")
-		quantize.QuantizeIndex(postingsListSlice, docRecordSlice, header.AverageDoclength, header.NumDocs, 8, *k1, *b)
+		err = quantizeIndex(header, postingsListSlice, docRecordSlice, scorerName, parameters, quantizeOptions, provenance)
+		if err != nil {
+			slog.Error("error quantizing index", "error", err)
+			os.Exit(1)
+		}
 	}
 
 	// --------------------------------------------------------------------------------
@@ -327,6 +418,9 @@ func main() {
 		os.Exit(1)
 	}
 	outputFileWriter.CiffToHuman(header, postingsListSlice, docRecordSlice)
-	outputCiffWriter.WriteCiff(header, postingsListSlice, docRecordSlice)
+	err = outputCiffWriter.WriteCiff(header, postingsListSlice, docRecordSlice)
+	if err != nil {
+		os.Exit(1)
+	}
 	slog.Info("complete")
 }
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/ciffio"
+)
+
+// writeTestCiff writes an index with absolute docids to a CIFF in a temporary directory and returns its
+// path.
+func writeTestCiff(t *testing.T, name string, header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := CiffWriter{writeCiff: true, ciffFilePath: path, workers: 1}.WriteCiff(header, postingsLists, docRecords)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// readTestCiff reads a whole CIFF, with absolute docids.
+func readTestCiff(t *testing.T, path string) (*ciff.Header, []*ciff.PostingsList, []*ciff.DocRecord) {
+	t.Helper()
+	ciffReader, err := openCiff(path, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ciffReader.Close()
+	postingsLists := make([]*ciff.PostingsList, 0)
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		postingsLists = append(postingsLists, postingsList)
+	}
+	docRecords := make([]*ciff.DocRecord, 0)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			t.Fatal(err)
+		}
+		docRecords = append(docRecords, docRecord)
+	}
+	return ciffReader.Header(), postingsLists, docRecords
+}
+
+// readTestFile returns the contents of path.
+func readTestFile(t *testing.T, path string) []byte {
+	t.Helper()
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return contents
+}
+
+// validateTestCiff fails the test if the CIFF at path violates the format.
+func validateTestCiff(t *testing.T, path string, options ciffio.ValidateOptions) {
+	t.Helper()
+	ciffFileHandle, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ciffFileHandle.Close()
+	violations, err := ciffio.Validate(ciffFileHandle, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, violation := range violations {
+		t.Errorf("%s: %s", path, violation)
+	}
+}
@@ -0,0 +1,340 @@
+package main
+
+import (
+	"container/heap"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"runtime"
+	"slices"
+	"strings"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+)
+
+// termHeap orders the inputs of a merge by their current term, then by their position, so the postings
+// of a term are merged in docid order.
+type termHeap struct {
+	terms  []string // current term of each input
+	inputs []int
+}
+
+func (h *termHeap) Len() int {
+	return len(h.inputs)
+}
+
+func (h *termHeap) Less(i, j int) bool {
+	a, b := h.inputs[i], h.inputs[j]
+	return h.terms[a] < h.terms[b] || h.terms[a] == h.terms[b] && a < b
+}
+
+func (h *termHeap) Swap(i, j int) {
+	h.inputs[i], h.inputs[j] = h.inputs[j], h.inputs[i]
+}
+
+func (h *termHeap) Push(x any) {
+	h.inputs = append(h.inputs, x.(int))
+}
+
+func (h *termHeap) Pop() any {
+	input := h.inputs[len(h.inputs)-1]
+	h.inputs = h.inputs[:len(h.inputs)-1]
+	return input
+}
+
+// CiffMerger merges CIFFs, each with its own docid space, into one index. Docids are remapped by
+// concatenating the inputs in order, and postings lists of the same term are merged with a k-way merge
+// over the sorted terms of the inputs, so only one postings list per input is held in memory. The inputs
+// are read twice: once to count the distinct terms for the header, and once to write the merged index.
+type CiffMerger struct {
+	ciffFilePaths      []string
+	outputCiffFilePath string
+	description        string // defaults to the distinct lines of the input descriptions
+	workers            int
+}
+
+func (merger CiffMerger) openInputs(workers int) ([]ciffFile, error) {
+	inputs := make([]ciffFile, 0, len(merger.ciffFilePaths))
+	for _, ciffFilePath := range merger.ciffFilePaths {
+		input, err := openCiff(ciffFilePath, workers)
+		if err != nil {
+			closeInputs(inputs)
+			return nil, fmt.Errorf("opening %s: %w", ciffFilePath, err)
+		}
+		inputs = append(inputs, input)
+	}
+	return inputs, nil
+}
+
+func closeInputs(inputs []ciffFile) {
+	for _, input := range inputs {
+		input.Close()
+	}
+}
+
+// nextTerm advances the heap past the current term of its first input, reading that input's next term
+// with read. Inputs must be strictly sorted by term for the merge to be correct.
+func (merger CiffMerger) nextTerm(h *termHeap, read func(input int) (string, error)) error {
+	input := h.inputs[0]
+	term, err := read(input)
+	if errors.Is(err, io.EOF) {
+		heap.Pop(h)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", merger.ciffFilePaths[input], err)
+	}
+	if term <= h.terms[input] {
+		return fmt.Errorf("%s: terms are not sorted, %q follows %q", merger.ciffFilePaths[input], term, h.terms[input])
+	}
+	h.terms[input] = term
+	heap.Fix(h, 0)
+	return nil
+}
+
+// mergeHeap returns a heap over the first terms of the inputs, read with read.
+func (merger CiffMerger) mergeHeap(read func(input int) (string, error)) (*termHeap, error) {
+	h := &termHeap{terms: make([]string, len(merger.ciffFilePaths))}
+	for input := range merger.ciffFilePaths {
+		term, err := read(input)
+		if errors.Is(err, io.EOF) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", merger.ciffFilePaths[input], err)
+		}
+		h.terms[input] = term
+		h.inputs = append(h.inputs, input)
+	}
+	heap.Init(h)
+	return h, nil
+}
+
+// recordPrefix starts every line a ciffTools command records in a header description, such as how the
+// index was analysed, quantized, pruned or reordered.
+const recordPrefix = "ciffTools-"
+
+// recordLines returns the lines of description recorded by ciffTools commands.
+func recordLines(description string) []string {
+	lines := make([]string, 0)
+	for _, line := range strings.Split(description, "\n") {
+		if strings.HasPrefix(line, recordPrefix) {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// hasLocalStats reports whether a header's collection statistics describe its own documents, rather
+// than a whole collection it is a shard of, as for shards written with -globalStats.
+func hasLocalStats(header *ciff.Header) bool {
+	return header.TotalDocs == header.NumDocs
+}
+
+// mergeHeaders returns the header of the merged index with numPostingsLists distinct terms. The
+// collection statistics are summed if every input describes itself, and kept if every input carries the
+// same statistics of a whole collection.
+func (merger CiffMerger) mergeHeaders(headers []*ciff.Header, numPostingsLists int32) (*ciff.Header, error) {
+	numDocs, totalDocs := int64(0), int64(0)
+	header := &ciff.Header{Version: 1, NumPostingsLists: numPostingsLists, TotalPostingsLists: numPostingsLists}
+	descriptionLines := make([]string, 0)
+	for input, inputHeader := range headers {
+		if hasLocalStats(inputHeader) != hasLocalStats(headers[0]) {
+			return nil, fmt.Errorf("%s and %s cannot be merged, only one of them has the statistics of a whole collection", merger.ciffFilePaths[0], merger.ciffFilePaths[input])
+		}
+		if !hasLocalStats(inputHeader) && (inputHeader.TotalDocs != headers[0].TotalDocs ||
+			inputHeader.TotalPostingsLists != headers[0].TotalPostingsLists ||
+			inputHeader.TotalTermsInCollection != headers[0].TotalTermsInCollection ||
+			inputHeader.AverageDoclength != headers[0].AverageDoclength) {
+			return nil, fmt.Errorf("%s and %s cannot be merged, they have the statistics of different collections", merger.ciffFilePaths[0], merger.ciffFilePaths[input])
+		}
+		// Inputs analysed, quantized, pruned or reordered differently hold incompatible postings
+		if !slices.Equal(recordLines(inputHeader.Description), recordLines(headers[0].Description)) {
+			return nil, fmt.Errorf("%s and %s cannot be merged, the %s lines of their descriptions differ", merger.ciffFilePaths[0], merger.ciffFilePaths[input], recordPrefix)
+		}
+		numDocs += int64(inputHeader.NumDocs)
+		totalDocs += int64(inputHeader.TotalDocs)
+		header.TotalTermsInCollection += inputHeader.TotalTermsInCollection
+		for _, line := range strings.Split(inputHeader.Description, "\n") {
+			if line != "" && !slices.Contains(descriptionLines, line) {
+				descriptionLines = append(descriptionLines, line)
+			}
+		}
+	}
+	if numDocs > math.MaxInt32 || totalDocs > math.MaxInt32 {
+		return nil, fmt.Errorf("the merged index has %d documents, more than a CIFF can hold", max(numDocs, totalDocs))
+	}
+	header.NumDocs, header.TotalDocs = int32(numDocs), int32(totalDocs)
+	if numDocs > 0 {
+		header.AverageDoclength = float64(header.TotalTermsInCollection) / float64(numDocs)
+	}
+	if len(headers) > 0 && !hasLocalStats(headers[0]) {
+		if numDocs > int64(headers[0].TotalDocs) {
+			return nil, fmt.Errorf("the inputs hold %d documents, more than the %d of their collection", numDocs, headers[0].TotalDocs)
+		}
+		header.TotalDocs = headers[0].TotalDocs
+		header.TotalPostingsLists = headers[0].TotalPostingsLists
+		header.TotalTermsInCollection = headers[0].TotalTermsInCollection
+		header.AverageDoclength = headers[0].AverageDoclength
+	}
+	header.Description = merger.description
+	if header.Description == "" {
+		header.Description = strings.Join(descriptionLines, "\n")
+	}
+	return header, nil
+}
+
+func (merger CiffMerger) Merge() error {
+	// --------------------------------------------------------------------------------
+	// First pass: count the distinct terms
+	slog.Info("counting terms")
+	inputs, err := merger.openInputs(1)
+	if err != nil {
+		return err
+	}
+	headers := make([]*ciff.Header, len(inputs))
+	for input := range inputs {
+		headers[input] = inputs[input].Header()
+	}
+	readTerm := func(input int) (string, error) {
+		return inputs[input].ReadTerm()
+	}
+	h, err := merger.mergeHeap(readTerm)
+	numPostingsLists := int64(0)
+	for err == nil && h.Len() > 0 {
+		term := h.terms[h.inputs[0]]
+		err = merger.nextTerm(h, readTerm)
+		if err == nil && (h.Len() == 0 || h.terms[h.inputs[0]] != term) {
+			numPostingsLists++
+		}
+	}
+	closeInputs(inputs)
+	if err != nil {
+		return err
+	}
+	if numPostingsLists > math.MaxInt32 {
+		return fmt.Errorf("the merged index has %d terms, more than a CIFF can hold", numPostingsLists)
+	}
+	header, err := merger.mergeHeaders(headers, int32(numPostingsLists))
+	if err != nil {
+		return err
+	}
+	slog.Info("merged header", "terms", header.NumPostingsLists, "docs", header.NumDocs)
+
+	// --------------------------------------------------------------------------------
+	// Second pass: merge the postings lists, then concatenate the doc records
+	slog.Info("merging postings lists")
+	inputs, err = merger.openInputs(max(merger.workers/len(merger.ciffFilePaths), 1))
+	if err != nil {
+		return err
+	}
+	defer closeInputs(inputs)
+	docidOffsets := make([]int32, len(inputs))
+	for input := 1; input < len(inputs); input++ {
+		docidOffsets[input] = docidOffsets[input-1] + headers[input-1].NumDocs
+	}
+	outputFileHandle, ciffWriter, err := createCiff(merger.outputCiffFilePath, header, merger.workers)
+	if err != nil {
+		return fmt.Errorf("creating output ciff: %w", err)
+	}
+	defer outputFileHandle.Close()
+
+	postingsLists := make([]*ciff.PostingsList, len(inputs))
+	readPostingsList := func(input int) (string, error) {
+		postingsList, err := inputs[input].ReadPostingsList()
+		if err != nil {
+			return "", err
+		}
+		for _, posting := range postingsList.Postings {
+			posting.Docid += docidOffsets[input]
+		}
+		postingsLists[input] = postingsList
+		return postingsList.Term, nil
+	}
+	h, err = merger.mergeHeap(readPostingsList)
+	if err != nil {
+		return err
+	}
+	var merged *ciff.PostingsList
+	n := max(header.NumPostingsLists/10, 1)
+	postingsListIndex := int32(0)
+	for h.Len() > 0 {
+		postingsList := postingsLists[h.inputs[0]]
+		if merged == nil {
+			merged = postingsList
+		} else {
+			merged.Postings = append(merged.Postings, postingsList.Postings...)
+			merged.Df += postingsList.Df
+			merged.Cf += postingsList.Cf
+		}
+		err = merger.nextTerm(h, readPostingsList)
+		if err != nil {
+			return err
+		}
+		if h.Len() > 0 && postingsLists[h.inputs[0]].Term == merged.Term {
+			continue
+		}
+		if postingsListIndex%n == 0 {
+			slog.Info(fmt.Sprintf("postings list %d/%d", postingsListIndex, header.NumPostingsLists))
+		}
+		postingsListIndex++
+		err = ciffWriter.WritePostingsList(merged)
+		if err != nil {
+			return err
+		}
+		merged = nil
+	}
+
+	slog.Info("concatenating doc records")
+	for input := range inputs {
+		for docRecord, err := range inputs[input].DocRecords() {
+			if err != nil {
+				return fmt.Errorf("%s: %w", merger.ciffFilePaths[input], err)
+			}
+			docRecord.Docid += docidOffsets[input]
+			err = ciffWriter.WriteDocRecord(docRecord)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return ciffWriter.Close()
+}
+
+func mergeCommand(arguments []string) int {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	outputCiffFilePath := flags.String("outputCiffFilePath", "", "filepath of the merged CIFF file to write. Any existing file is overwritten!")
+	description := flags.String("description", "", "Description written to the header. Defaults to the distinct lines of the input descriptions.")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to decode and encode with. The output does not depend on it.")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: ciffTools merge -outputCiffFilePath <path> [flags] <ciff> <ciff> ...")
+		flags.PrintDefaults()
+	}
+	flags.Parse(arguments)
+
+	if *outputCiffFilePath == "" {
+		fmt.Println("Please provide an output CIFF file!")
+		return 1
+	}
+	if flags.NArg() == 0 {
+		fmt.Println("Please provide the CIFF files to merge!")
+		return 1
+	}
+
+	merger := CiffMerger{
+		ciffFilePaths:      flags.Args(),
+		outputCiffFilePath: *outputCiffFilePath,
+		description:        *description,
+		workers:            *workers,
+	}
+	err := merger.Merge()
+	if err != nil {
+		slog.Error("error merging ciffs", "error", err)
+		return 1
+	}
+	slog.Info("complete")
+	return 0
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/ciffio"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"google.golang.org/protobuf/proto"
+)
+
+// splitTestIndex writes the documents of an index to one CIFF per range of docids starting at each of
+// starts, with dense docids and their own statistics, and returns their paths. Every shard keeps every
+// term, with the postings of its documents.
+func splitTestIndex(t *testing.T, header *ciff.Header, postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord, starts ...int32) []string {
+	t.Helper()
+	paths := make([]string, len(starts))
+	for shard, start := range starts {
+		end := header.NumDocs
+		if shard+1 < len(starts) {
+			end = starts[shard+1]
+		}
+		shardPostingsLists := make([]*ciff.PostingsList, len(postingsLists))
+		for listIndex, postingsList := range postingsLists {
+			shardPostingsList := &ciff.PostingsList{Term: postingsList.Term, Postings: []*ciff.Posting{}}
+			for _, posting := range postingsList.Postings {
+				if posting.Docid >= start && posting.Docid < end {
+					shardPostingsList.Postings = append(shardPostingsList.Postings, &ciff.Posting{Docid: posting.Docid - start, Tf: posting.Tf})
+					shardPostingsList.Df++
+					shardPostingsList.Cf += int64(posting.Tf)
+				}
+			}
+			shardPostingsLists[listIndex] = shardPostingsList
+		}
+		shardDocRecords := make([]*ciff.DocRecord, 0, end-start)
+		totalTerms := int64(0)
+		for _, docRecord := range docRecords[start:end] {
+			shardDocRecords = append(shardDocRecords, &ciff.DocRecord{Docid: docRecord.Docid - start, CollectionDocid: docRecord.CollectionDocid, Doclength: docRecord.Doclength})
+			totalTerms += int64(docRecord.Doclength)
+		}
+		shardHeader := &ciff.Header{
+			Version:                1,
+			NumPostingsLists:       int32(len(shardPostingsLists)),
+			NumDocs:                end - start,
+			TotalPostingsLists:     int32(len(shardPostingsLists)),
+			TotalDocs:              end - start,
+			TotalTermsInCollection: totalTerms,
+			AverageDoclength:       float64(totalTerms) / float64(end-start),
+			Description:            header.Description,
+		}
+		paths[shard] = writeTestCiff(t, fmt.Sprintf("shard-%d.ciff", shard), shardHeader, shardPostingsLists, shardDocRecords)
+	}
+	return paths
+}
+
+func TestMergeRoundTrip(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 100, 200, 10)
+	originalPath := writeTestCiff(t, "original.ciff", header, postingsLists, docRecords)
+	shardPaths := splitTestIndex(t, header, postingsLists, docRecords, 0, 37, 150)
+	for _, workers := range []int{1, 4} {
+		t.Run(fmt.Sprintf("%d workers", workers), func(t *testing.T) {
+			mergedPath := filepath.Join(t.TempDir(), "merged.ciff")
+			err := CiffMerger{ciffFilePaths: shardPaths, outputCiffFilePath: mergedPath, workers: workers}.Merge()
+			if err != nil {
+				t.Fatal(err)
+			}
+			validateTestCiff(t, mergedPath, ciffio.ValidateOptions{})
+			if !bytes.Equal(readTestFile(t, mergedPath), readTestFile(t, originalPath)) {
+				t.Errorf("merged CIFF differs from the original")
+			}
+		})
+	}
+}
+
+func TestMergeSharedTerms(t *testing.T) {
+	// The small test index split after doc-b, with banana and date missing from the second shard and
+	// cherry, which no document holds, only in it.
+	firstPath := writeTestCiff(t, "first.ciff",
+		&ciff.Header{Version: 1, NumPostingsLists: 3, NumDocs: 2, TotalPostingsLists: 3, TotalDocs: 2, TotalTermsInCollection: 7, AverageDoclength: 3.5, Description: "test index"},
+		[]*ciff.PostingsList{
+			{Term: "apple", Df: 1, Cf: 1, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}}},
+			{Term: "banana", Df: 2, Cf: 2, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}, {Docid: 1, Tf: 1}}},
+			{Term: "date", Df: 1, Cf: 4, Postings: []*ciff.Posting{{Docid: 1, Tf: 4}}},
+		},
+		[]*ciff.DocRecord{{Docid: 0, CollectionDocid: "doc-a", Doclength: 2}, {Docid: 1, CollectionDocid: "doc-b", Doclength: 5}})
+	secondPath := writeTestCiff(t, "second.ciff",
+		&ciff.Header{Version: 1, NumPostingsLists: 3, NumDocs: 1, TotalPostingsLists: 3, TotalDocs: 1, TotalTermsInCollection: 3, AverageDoclength: 3, Description: "test index"},
+		[]*ciff.PostingsList{
+			{Term: "apple", Df: 1, Cf: 2, Postings: []*ciff.Posting{{Docid: 0, Tf: 2}}},
+			{Term: "banana", Df: 1, Cf: 1, Postings: []*ciff.Posting{{Docid: 0, Tf: 1}}},
+			{Term: "cherry", Df: 0, Cf: 0, Postings: []*ciff.Posting{}},
+		},
+		[]*ciff.DocRecord{{Docid: 0, CollectionDocid: "doc-c", Doclength: 3}})
+
+	mergedPath := filepath.Join(t.TempDir(), "merged.ciff")
+	err := CiffMerger{ciffFilePaths: []string{firstPath, secondPath}, outputCiffFilePath: mergedPath, workers: 1}.Merge()
+	if err != nil {
+		t.Fatal(err)
+	}
+	validateTestCiff(t, mergedPath, ciffio.ValidateOptions{})
+	header, postingsLists, docRecords := readTestCiff(t, mergedPath)
+	wantHeader, wantPostingsLists, wantDocRecords := cifftest.Small()
+	if !proto.Equal(header, wantHeader) {
+		t.Errorf("header %v, want %v", header, wantHeader)
+	}
+	if !cifftest.EqualPostingsLists(postingsLists, wantPostingsLists) {
+		t.Errorf("postings lists %v, want %v", postingsLists, wantPostingsLists)
+	}
+	if !cifftest.EqualDocRecords(docRecords, wantDocRecords) {
+		t.Errorf("doc records %v, want %v", docRecords, wantDocRecords)
+	}
+}
+
+func TestMergeDescriptions(t *testing.T) {
+	tests := []struct {
+		name                string
+		first, second       string
+		expectedDescription string // empty if the merge is refused
+	}{
+		{"distinct lines", "test index\nfirst half", "test index\nsecond half", "test index\nfirst half\nsecond half"},
+		{"same records", "first half\nciffTools-prune: {}", "second half\nciffTools-prune: {}", "first half\nciffTools-prune: {}\nsecond half"},
+		{"one recorded", "test index\nciffTools-prune: {}", "test index", ""},
+		{"different records", "ciffTools-prune: {\"method\":\"term\"}", "ciffTools-prune: {\"method\":\"global\"}", ""},
+		{"records in a different order", "ciffTools-analyzer: lowercase\nciffTools-prune: {}", "ciffTools-prune: {}\nciffTools-analyzer: lowercase", ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			header, postingsLists, docRecords := cifftest.Small()
+			header.Description = test.first
+			firstPath := writeTestCiff(t, "first.ciff", header, postingsLists, docRecords)
+			header.Description = test.second
+			secondPath := writeTestCiff(t, "second.ciff", header, postingsLists, docRecords)
+
+			mergedPath := filepath.Join(t.TempDir(), "merged.ciff")
+			err := CiffMerger{ciffFilePaths: []string{firstPath, secondPath}, outputCiffFilePath: mergedPath, workers: 1}.Merge()
+			if test.expectedDescription == "" {
+				if err == nil {
+					t.Errorf("merged %q with %q", test.first, test.second)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			mergedHeader, _, _ := readTestCiff(t, mergedPath)
+			if mergedHeader.Description != test.expectedDescription {
+				t.Errorf("description %q, want %q", mergedHeader.Description, test.expectedDescription)
+			}
+		})
+	}
+}
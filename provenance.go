@@ -0,0 +1,75 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"runtime/debug"
+
+	"github.com/Axiomatic314/ciffTools/quantize"
+)
+
+// toolVersion returns the module version and VCS revision this binary was built from.
+func toolVersion() string {
+	buildInfo, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	version := buildInfo.Main.Version
+	for _, setting := range buildInfo.Settings {
+		if setting.Key == "vcs.revision" {
+			version += " " + setting.Value
+		}
+	}
+	return version
+}
+
+func hashFile(filePath string) (string, error) {
+	fileHandle, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer fileHandle.Close()
+	hash := sha256.New()
+	_, err = io.Copy(hash, fileHandle)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+func provenanceCommand(arguments []string) int {
+	flags := flag.NewFlagSet("provenance", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of quantized CIFF file to read the provenance of")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+
+	ciffReader, err := openCiff(*ciffFilePath, 1)
+	if err != nil {
+		slog.Error("error opening ciff", "error", err)
+		return 1
+	}
+	defer ciffReader.Close()
+
+	provenance, err := quantize.ParseProvenance(ciffReader.Header().Description)
+	if err != nil {
+		slog.Error("error reading provenance", "error", err)
+		return 1
+	}
+	encoded, err := json.MarshalIndent(provenance, "", "  ")
+	if err != nil {
+		slog.Error("error encoding provenance", "error", err)
+		return 1
+	}
+	fmt.Println(string(encoded))
+	return 0
+}
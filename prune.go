@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/quantize"
+	"google.golang.org/protobuf/proto"
+)
+
+// PruneMethods lists the static pruning methods.
+//   - term: term-centric pruning (Carmel et al., 2001). Each postings list keeps the postings scoring at
+//     least epsilon times its k-th highest score, so at least k postings. Where a list has negative
+//     scores, epsilon instead scales the distance of the k-th highest score above the lowest.
+//   - document: document-centric pruning (Büttcher and Clarke, 2006). Each document keeps its highest
+//     scoring fraction of terms.
+//   - global: every posting scoring below a threshold is removed.
+var PruneMethods = []string{"term", "document", "global"}
+
+// prunePrefix starts the line of a header description recording how an index was pruned.
+const prunePrefix = "ciffTools-prune: "
+
+// CiffPruner removes low scoring postings from a CIFF without holding its postings in memory. Scores
+// come from a quantize.Scorer, or are the impacts of a quantized CIFF. Postings lists left empty are
+// dropped, and the df and cf of the others are recomputed from the postings that remain. The doc
+// records, and so the doc lengths and collection statistics, are unchanged. Document pruning holds the
+// scores each document keeps in memory, a fraction of the postings.
+type CiffPruner struct {
+	ciffFilePath       string
+	outputCiffFilePath string
+	reportFilePath     string // per-term report of the postings removed, if not empty
+	pruneRecord
+	workers int
+}
+
+// pruneRecord records how a pruned CIFF was produced, as a line of JSON appended to its header
+// description.
+type pruneRecord struct {
+	Method      string               `json:"method"`
+	K           int                  `json:"k,omitempty"`
+	Epsilon     float64              `json:"epsilon,omitempty"`
+	Fraction    float64              `json:"fraction,omitempty"`
+	Threshold   float64              `json:"threshold,omitempty"`
+	Impacts     bool                 `json:"impacts"` // postings are scored by their impact rather than with the scorer
+	Scorer      string               `json:"scorer,omitempty"`
+	Parameters  *quantize.Parameters `json:"parameters,omitempty"`
+	ToolVersion string               `json:"toolVersion"`
+	Source      string               `json:"source"`
+}
+
+// scorePostings returns the score of every posting of postingsList.
+func (pruner CiffPruner) scorePostings(scorer quantize.Scorer, postingsList *ciff.PostingsList, docLengths []int32) []float64 {
+	scores := make([]float64, len(postingsList.Postings))
+	if pruner.Impacts {
+		for postingIndex, posting := range postingsList.Postings {
+			scores[postingIndex] = float64(posting.Tf)
+		}
+		return scores
+	}
+	termWeight := scorer.TermWeight(postingsList.Df, postingsList.Cf)
+	for postingIndex, posting := range postingsList.Postings {
+		scores[postingIndex] = scorer.Score(posting.Tf, docLengths[posting.Docid], termWeight)
+	}
+	return scores
+}
+
+// prunePostingsList removes the postings of postingsList that the method prunes, leaving its df and cf
+// as they were. docThresholds holds the lowest score kept in each document, for document pruning.
+func (pruner CiffPruner) prunePostingsList(scorer quantize.Scorer, postingsList *ciff.PostingsList, docLengths []int32, docThresholds []float32) {
+	scores := pruner.scorePostings(scorer, postingsList, docLengths)
+	threshold := pruner.Threshold
+	if pruner.Method == "term" {
+		if len(scores) <= pruner.K {
+			return
+		}
+		sorted := slices.Clone(scores)
+		slices.Sort(sorted)
+		// Scaling a negative k-th score by epsilon would raise it, so the distance above the lowest score
+		// is scaled instead, which is the same for non-negative scores
+		lowest := min(sorted[0], 0)
+		threshold = lowest + pruner.Epsilon*(sorted[len(sorted)-pruner.K]-lowest)
+	}
+	kept := postingsList.Postings[:0]
+	for postingIndex, posting := range postingsList.Postings {
+		if pruner.Method == "document" {
+			if float32(scores[postingIndex]) >= docThresholds[posting.Docid] {
+				kept = append(kept, posting)
+			}
+		} else if scores[postingIndex] >= threshold {
+			kept = append(kept, posting)
+		}
+	}
+	postingsList.Postings = kept
+}
+
+// pushTopScore adds score to scores, a min-heap of the keep highest scores seen.
+func pushTopScore(scores []float32, keep int, score float32) []float32 {
+	if len(scores) < keep {
+		scores = append(scores, score)
+		for child := len(scores) - 1; child > 0; {
+			parent := (child - 1) / 2
+			if scores[parent] <= scores[child] {
+				break
+			}
+			scores[parent], scores[child] = scores[child], scores[parent]
+			child = parent
+		}
+		return scores
+	}
+	if score <= scores[0] {
+		return scores
+	}
+	scores[0] = score
+	for parent := 0; ; {
+		smallest := parent
+		for _, child := range []int{2*parent + 1, 2*parent + 2} {
+			if child < len(scores) && scores[child] < scores[smallest] {
+				smallest = child
+			}
+		}
+		if smallest == parent {
+			return scores
+		}
+		scores[parent], scores[smallest] = scores[smallest], scores[parent]
+		parent = smallest
+	}
+}
+
+// docThresholds returns the lowest score kept in each document by document pruning: the score of its
+// ceil(fraction * terms)-th highest scoring term. The terms of each document are counted first, so only
+// the scores a document keeps are held in memory, in a min-heap per document.
+func (pruner CiffPruner) docThresholds(scorer quantize.Scorer, docLengths []int32) ([]float32, error) {
+	ciffReader, err := openCiff(pruner.ciffFilePath, pruner.workers)
+	if err != nil {
+		return nil, fmt.Errorf("opening ciff: %w", err)
+	}
+	docTerms := make([]int32, len(docLengths))
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			ciffReader.Close()
+			return nil, err
+		}
+		for _, posting := range postingsList.Postings {
+			docTerms[posting.Docid]++
+		}
+	}
+	ciffReader.Close()
+
+	ciffReader, err = openCiff(pruner.ciffFilePath, pruner.workers)
+	if err != nil {
+		return nil, fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	docScores := make([][]float32, len(docLengths))
+	for docid, terms := range docTerms {
+		if terms > 0 {
+			docScores[docid] = make([]float32, 0, max(int(math.Ceil(pruner.Fraction*float64(terms))), 1))
+		}
+	}
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			return nil, err
+		}
+		for postingIndex, score := range pruner.scorePostings(scorer, postingsList, docLengths) {
+			docid := postingsList.Postings[postingIndex].Docid
+			docScores[docid] = pushTopScore(docScores[docid], cap(docScores[docid]), float32(score))
+		}
+	}
+	thresholds := make([]float32, len(docLengths))
+	for docid, scores := range docScores {
+		if len(scores) == 0 {
+			continue
+		}
+		thresholds[docid] = scores[0]
+		docScores[docid] = nil
+	}
+	return thresholds, nil
+}
+
+func (pruner CiffPruner) Prune() error {
+	// --------------------------------------------------------------------------------
+	// First pass: collect the doc lengths, and the thresholds of document pruning
+	slog.Info("collecting doc lengths")
+	docLengths, err := readDocLengths(pruner.ciffFilePath)
+	if err != nil {
+		return err
+	}
+	ciffReader, err := openCiff(pruner.ciffFilePath, 1)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	header := ciffReader.Header()
+	ciffReader.Close()
+	var scorer quantize.Scorer
+	if !pruner.Impacts {
+		scorer, err = quantize.NewScorer(pruner.Scorer, *pruner.Parameters, collectionStats(header))
+		if err != nil {
+			return err
+		}
+	}
+	var docThresholds []float32
+	if pruner.Method == "document" {
+		slog.Info("finding document thresholds")
+		docThresholds, err = pruner.docThresholds(scorer, docLengths)
+		if err != nil {
+			return err
+		}
+	}
+
+	// --------------------------------------------------------------------------------
+	// Second pass: count the postings lists that are not pruned away, for the header
+	slog.Info("counting pruned postings lists")
+	workers := max(pruner.workers, 1)
+	ciffReader, err = openCiff(pruner.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	workerCounts := make([]int32, workers)
+	err = scanPostingsLists(ciffReader, workers, func(worker int, postingsList *ciff.PostingsList) {
+		pruner.prunePostingsList(scorer, postingsList, docLengths, docThresholds)
+		if len(postingsList.Postings) > 0 {
+			workerCounts[worker]++
+		}
+	})
+	ciffReader.Close()
+	if err != nil {
+		return err
+	}
+	numPostingsLists := int32(0)
+	for _, count := range workerCounts {
+		numPostingsLists += count
+	}
+
+	// --------------------------------------------------------------------------------
+	// Third pass: prune each postings list and write it out
+	slog.Info("writing pruned ciff")
+	ciffReader, err = openCiff(pruner.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	record, err := json.Marshal(pruner.pruneRecord)
+	if err != nil {
+		return err
+	}
+	outputHeader := proto.Clone(header).(*ciff.Header)
+	outputHeader.NumPostingsLists = numPostingsLists
+	outputHeader.TotalPostingsLists -= header.NumPostingsLists - numPostingsLists
+	if outputHeader.Description != "" {
+		outputHeader.Description += "\n"
+	}
+	outputHeader.Description += prunePrefix + string(record)
+	outputFileHandle, ciffWriter, err := createCiff(pruner.outputCiffFilePath, outputHeader, workers)
+	if err != nil {
+		return fmt.Errorf("creating output ciff: %w", err)
+	}
+	defer outputFileHandle.Close()
+
+	var reportFileHandle *os.File
+	var reportWriter *bufio.Writer
+	if pruner.reportFilePath != "" {
+		reportFileHandle, err = os.Create(pruner.reportFilePath)
+		if err != nil {
+			return fmt.Errorf("creating report: %w", err)
+		}
+		defer reportFileHandle.Close()
+		reportWriter = bufio.NewWriter(reportFileHandle)
+		reportWriter.WriteString("term df prunedDf removed\n")
+		reportWriter.WriteString("-----------------------\n")
+	}
+
+	totalPostings, keptPostings := int64(0), int64(0)
+	err = mapPostingsLists(ciffReader, workers, func(postingsList *ciff.PostingsList) {
+		pruner.prunePostingsList(scorer, postingsList, docLengths, docThresholds)
+	}, func(postingsList *ciff.PostingsList) error {
+		df := postingsList.Df
+		postingsList.Df, postingsList.Cf = int64(len(postingsList.Postings)), 0
+		for _, posting := range postingsList.Postings {
+			postingsList.Cf += int64(posting.Tf)
+		}
+		totalPostings += df
+		keptPostings += postingsList.Df
+		if reportWriter != nil {
+			reportWriter.WriteString(fmt.Sprintf("%s %d %d %d\n", postingsList.Term, df, postingsList.Df, df-postingsList.Df))
+		}
+		if postingsList.Df == 0 {
+			return nil
+		}
+		return ciffWriter.WritePostingsList(postingsList)
+	})
+	if err != nil {
+		return err
+	}
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			return err
+		}
+		err = ciffWriter.WriteDocRecord(docRecord)
+		if err != nil {
+			return err
+		}
+	}
+	err = ciffWriter.Close()
+	if err != nil {
+		return err
+	}
+	if reportWriter != nil {
+		err = reportWriter.Flush()
+		if err == nil {
+			err = reportFileHandle.Close()
+		}
+		if err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+	}
+
+	fmt.Printf("postings: %d\n", totalPostings)
+	fmt.Printf("postings removed: %d (%.2f%%)\n", totalPostings-keptPostings, 100*float64(totalPostings-keptPostings)/float64(max(totalPostings, 1)))
+	fmt.Printf("postings lists removed: %d\n", header.NumPostingsLists-numPostingsLists)
+	return nil
+}
+
+func pruneCommand(arguments []string) int {
+	flags := flag.NewFlagSet("prune", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of CIFF file to prune")
+	outputCiffFilePath := flags.String("outputCiffFilePath", "", "filepath of the pruned CIFF file to write. Any existing file is overwritten!")
+	reportFilePath := flags.String("report", "", "filepath to write the df of every term before and after pruning to.")
+	method := flags.String("method", "term", fmt.Sprintf("Pruning method, one of %v.", PruneMethods))
+	k := flags.Int("k", 10, "Number of postings each postings list keeps, for term pruning.")
+	epsilon := flags.Float64("epsilon", 1, "Fraction of the k-th highest score of each postings list that its postings must reach, for term pruning.")
+	fraction := flags.Float64("fraction", 0.5, "Fraction of the terms of each document it keeps, for document pruning.")
+	threshold := flags.Float64("threshold", 0, "Lowest score kept, for global pruning.")
+	impacts := flags.Bool("impacts", false, "Bool to score postings by their impact, for quantized CIFFs. Defaults to false.")
+	scorer := scorerFlags(flags)
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to decode, score and encode with. The output does not depend on it.")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+	if *outputCiffFilePath == "" {
+		fmt.Println("Please provide an output CIFF file!")
+		return 1
+	}
+	if !slices.Contains(PruneMethods, *method) {
+		fmt.Printf("Unknown method %q, expected one of %v!\n", *method, PruneMethods)
+		return 1
+	}
+	if *method == "term" && (*k < 1 || *epsilon < 0 || *epsilon > 1) {
+		fmt.Println("Please provide a k of at least 1 and an epsilon in [0, 1]!")
+		return 1
+	}
+	if *method == "document" && (*fraction <= 0 || *fraction > 1) {
+		fmt.Println("Please provide a fraction in (0, 1]!")
+		return 1
+	}
+
+	_, ciffFile := filepath.Split(*ciffFilePath)
+	pruner := CiffPruner{
+		ciffFilePath:       *ciffFilePath,
+		outputCiffFilePath: *outputCiffFilePath,
+		reportFilePath:     *reportFilePath,
+		pruneRecord:        pruneRecord{Method: *method, Impacts: *impacts, ToolVersion: toolVersion(), Source: ciffFile},
+		workers:            *workers,
+	}
+	switch *method {
+	case "term":
+		pruner.K, pruner.Epsilon = *k, *epsilon
+	case "document":
+		pruner.Fraction = *fraction
+	case "global":
+		pruner.Threshold = *threshold
+	}
+	if !*impacts {
+		scorerName, parameters := scorer()
+		pruner.Scorer, pruner.Parameters = scorerName, &parameters
+	}
+	err := pruner.Prune()
+	if err != nil {
+		slog.Error("error pruning ciff", "error", err)
+		return 1
+	}
+	slog.Info("complete")
+	return 0
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/ciffio"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"github.com/Axiomatic314/ciffTools/quantize"
+)
+
+// expectedPrune returns the postings of each list that pruner keeps, given the score of every posting,
+// worked out from the definitions of the methods in PruneMethods.
+func expectedPrune(pruner CiffPruner, postingsLists []*ciff.PostingsList, scores [][]float64, numDocs int32) [][]*ciff.Posting {
+	docScores := make([][]float64, numDocs)
+	for listIndex, postingsList := range postingsLists {
+		for postingIndex, posting := range postingsList.Postings {
+			docScores[posting.Docid] = append(docScores[posting.Docid], scores[listIndex][postingIndex])
+		}
+	}
+	docThresholds := make([]float64, numDocs)
+	for docid, scores := range docScores {
+		if len(scores) > 0 {
+			slices.Sort(scores)
+			keep := max(int(math.Ceil(pruner.Fraction*float64(len(scores)))), 1)
+			docThresholds[docid] = scores[len(scores)-keep]
+		}
+	}
+	kept := make([][]*ciff.Posting, len(postingsLists))
+	for listIndex, postingsList := range postingsLists {
+		threshold := pruner.Threshold
+		if pruner.Method == "term" && len(postingsList.Postings) > pruner.K {
+			sorted := slices.Clone(scores[listIndex])
+			slices.Sort(sorted)
+			threshold = pruner.Epsilon * sorted[len(sorted)-pruner.K]
+		}
+		for postingIndex, posting := range postingsList.Postings {
+			score := scores[listIndex][postingIndex]
+			switch {
+			case pruner.Method == "document" && float32(score) >= float32(docThresholds[posting.Docid]):
+			case pruner.Method == "term" && (len(postingsList.Postings) <= pruner.K || score >= threshold):
+			case pruner.Method == "global" && score >= threshold:
+			default:
+				continue
+			}
+			kept[listIndex] = append(kept[listIndex], posting)
+		}
+	}
+	return kept
+}
+
+func TestPrune(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 100, 200, 10)
+	inputPath := writeTestCiff(t, "input.ciff", header, postingsLists, docRecords)
+	parameters := quantize.DefaultParameters("atire-bm25")
+	scorer, err := quantize.NewScorer("atire-bm25", parameters, collectionStats(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name   string
+		record pruneRecord
+	}{
+		{"term top-k", pruneRecord{Method: "term", K: 5, Epsilon: 1}},
+		{"term top-epsilon", pruneRecord{Method: "term", K: 5, Epsilon: 0.6}},
+		{"term impacts", pruneRecord{Method: "term", K: 20, Epsilon: 0.5, Impacts: true}},
+		{"document", pruneRecord{Method: "document", Fraction: 0.3}},
+		{"document impacts", pruneRecord{Method: "document", Fraction: 0.5, Impacts: true}},
+		{"global", pruneRecord{Method: "global", Threshold: 2}},
+		{"global impacts", pruneRecord{Method: "global", Threshold: 6, Impacts: true}},
+	}
+	for _, test := range tests {
+		for _, workers := range []int{1, 3} {
+			t.Run(fmt.Sprintf("%s %d workers", test.name, workers), func(t *testing.T) {
+				directory := t.TempDir()
+				pruner := CiffPruner{
+					ciffFilePath:       inputPath,
+					outputCiffFilePath: filepath.Join(directory, "pruned.ciff"),
+					reportFilePath:     filepath.Join(directory, "report.txt"),
+					pruneRecord:        test.record,
+					workers:            workers,
+				}
+				if !pruner.Impacts {
+					pruner.Scorer, pruner.Parameters = "atire-bm25", &parameters
+				}
+				err := pruner.Prune()
+				if err != nil {
+					t.Fatal(err)
+				}
+				validateTestCiff(t, pruner.outputCiffFilePath, ciffio.ValidateOptions{})
+
+				scores := make([][]float64, len(postingsLists))
+				for listIndex, postingsList := range postingsLists {
+					scores[listIndex] = pruner.scorePostings(scorer, postingsList, quantize.DocLengths(docRecords))
+				}
+				kept := expectedPrune(pruner, postingsLists, scores, header.NumDocs)
+				var wantPostingsLists []*ciff.PostingsList
+				var wantReport strings.Builder
+				wantReport.WriteString("term df prunedDf removed\n-----------------------\n")
+				removed := 0
+				for listIndex, postingsList := range postingsLists {
+					df := int64(len(kept[listIndex]))
+					fmt.Fprintf(&wantReport, "%s %d %d %d\n", postingsList.Term, postingsList.Df, df, postingsList.Df-df)
+					removed += len(postingsList.Postings) - len(kept[listIndex])
+					if df == 0 {
+						continue
+					}
+					wantPostingsList := &ciff.PostingsList{Term: postingsList.Term, Df: df, Postings: kept[listIndex]}
+					for _, posting := range kept[listIndex] {
+						wantPostingsList.Cf += int64(posting.Tf)
+					}
+					wantPostingsLists = append(wantPostingsLists, wantPostingsList)
+				}
+				if removed == 0 || len(wantPostingsLists) == 0 {
+					t.Fatalf("the test prunes %d postings and keeps %d postings lists", removed, len(wantPostingsLists))
+				}
+
+				prunedHeader, prunedPostingsLists, prunedDocRecords := readTestCiff(t, pruner.outputCiffFilePath)
+				if !cifftest.EqualPostingsLists(prunedPostingsLists, wantPostingsLists) {
+					t.Errorf("pruned postings lists differ from the %d postings lists expected", len(wantPostingsLists))
+				}
+				if !cifftest.EqualDocRecords(prunedDocRecords, docRecords) {
+					t.Errorf("pruning changed the doc records")
+				}
+				if numPostingsLists := int32(len(wantPostingsLists)); prunedHeader.NumPostingsLists != numPostingsLists || prunedHeader.TotalPostingsLists != numPostingsLists {
+					t.Errorf("header counts %d and %d postings lists, want %d", prunedHeader.NumPostingsLists, prunedHeader.TotalPostingsLists, numPostingsLists)
+				}
+				if !strings.HasPrefix(prunedHeader.Description, header.Description+"\n"+prunePrefix) {
+					t.Errorf("description %q does not record the pruning", prunedHeader.Description)
+				}
+				if report := string(readTestFile(t, pruner.reportFilePath)); report != wantReport.String() {
+					t.Errorf("report:\n%s\nwant\n%s", report, wantReport.String())
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,136 @@
+package quantize
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// ErrLocalScheme is returned by NewDequantizer for the local scheme, whose per-list score ranges are
+// not recorded.
+var ErrLocalScheme = errors.New("impacts quantized with the local scheme cannot be dequantized")
+
+// Dequantizer maps impacts back to approximate scores using the parameters recorded in a Provenance.
+type Dequantizer struct {
+	scheme                        string
+	smallestImpact, largestImpact int64
+	scoreRange                    ScoreRange
+	points                        []float64
+}
+
+func NewDequantizer(provenance Provenance) (*Dequantizer, error) {
+	options := Options{Bits: provenance.Bits, ZeroImpact: provenance.ZeroImpact, Scheme: provenance.Scheme}
+	err := options.validate()
+	if err != nil {
+		return nil, err
+	}
+	dequantizer := &Dequantizer{
+		scheme:     provenance.Scheme,
+		scoreRange: provenance.ScoreRange,
+		points:     provenance.Points,
+	}
+	dequantizer.smallestImpact, dequantizer.largestImpact = options.ImpactRange()
+	switch dequantizer.scheme {
+	case "", "uniform", "log":
+	case "local":
+		return nil, ErrLocalScheme
+	default:
+		if int64(len(dequantizer.points)) != dequantizer.largestImpact-dequantizer.smallestImpact+1 {
+			return nil, fmt.Errorf("provenance holds %d reconstruction points for %d bit impacts", len(dequantizer.points), provenance.Bits)
+		}
+	}
+	return dequantizer, nil
+}
+
+// Score returns the approximate score of an impact: the midpoint of its level for the uniform and log
+// schemes, and its recorded reconstruction point otherwise.
+func (dequantizer *Dequantizer) Score(impact int32) float64 {
+	level := min(max(int64(impact), dequantizer.smallestImpact), dequantizer.largestImpact) - dequantizer.smallestImpact
+	levels := dequantizer.largestImpact - dequantizer.smallestImpact + 1
+	scoreRange := dequantizer.scoreRange
+	switch dequantizer.scheme {
+	case "quantile", "lloyd-max":
+		return dequantizer.points[level]
+	case "log":
+		if level == levels-1 {
+			return scoreRange.Max
+		}
+		fraction := (float64(level) + 0.5) / float64(levels-1)
+		return scoreRange.Min + math.Expm1(fraction*math.Log1p(scoreRange.Max-scoreRange.Min))
+	default:
+		if level == levels-1 {
+			return scoreRange.Max
+		}
+		return scoreRange.Min + (float64(level)+0.5)*(scoreRange.Max-scoreRange.Min)/float64(levels-1)
+	}
+}
+
+// ScoreError summarises how far reconstructed scores are from the exact scores.
+type ScoreError struct {
+	MeanAbsoluteError float64
+	MaxAbsoluteError  float64
+	// Spearman is the rank correlation between the exact and reconstructed scores, NaN if either is
+	// constant.
+	Spearman float64
+}
+
+// CompareScores compares the exact scores of a postings list with their reconstructions.
+func CompareScores(exact []float64, reconstructed []float64) ScoreError {
+	scoreError := ScoreError{Spearman: math.NaN()}
+	if len(exact) == 0 {
+		return scoreError
+	}
+	totalError := 0.0
+	for scoreIndex := range exact {
+		absoluteError := math.Abs(exact[scoreIndex] - reconstructed[scoreIndex])
+		totalError += absoluteError
+		scoreError.MaxAbsoluteError = max(scoreError.MaxAbsoluteError, absoluteError)
+	}
+	scoreError.MeanAbsoluteError = totalError / float64(len(exact))
+	scoreError.Spearman = pearson(ranks(exact), ranks(reconstructed))
+	return scoreError
+}
+
+// ranks returns the rank of each score, averaging the ranks of ties.
+func ranks(scores []float64) []float64 {
+	order := make([]int, len(scores))
+	for scoreIndex := range order {
+		order[scoreIndex] = scoreIndex
+	}
+	sort.SliceStable(order, func(i, j int) bool { return scores[order[i]] < scores[order[j]] })
+	scoreRanks := make([]float64, len(scores))
+	for start := 0; start < len(order); {
+		end := start + 1
+		for end < len(order) && scores[order[end]] == scores[order[start]] {
+			end++
+		}
+		averageRank := float64(start+end-1) / 2
+		for _, scoreIndex := range order[start:end] {
+			scoreRanks[scoreIndex] = averageRank
+		}
+		start = end
+	}
+	return scoreRanks
+}
+
+func pearson(x []float64, y []float64) float64 {
+	n := float64(len(x))
+	meanX, meanY := 0.0, 0.0
+	for i := range x {
+		meanX += x[i]
+		meanY += y[i]
+	}
+	meanX /= n
+	meanY /= n
+	covariance, varianceX, varianceY := 0.0, 0.0, 0.0
+	for i := range x {
+		covariance += (x[i] - meanX) * (y[i] - meanY)
+		varianceX += (x[i] - meanX) * (x[i] - meanX)
+		varianceY += (y[i] - meanY) * (y[i] - meanY)
+	}
+	if varianceX == 0 || varianceY == 0 {
+		return math.NaN()
+	}
+	return covariance / math.Sqrt(varianceX*varianceY)
+}
@@ -0,0 +1,137 @@
+package quantize
+
+import (
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestCompareScores(t *testing.T) {
+	tests := []struct {
+		name          string
+		exact         []float64
+		reconstructed []float64
+		expected      ScoreError
+	}{
+		{"identical", []float64{1, 2, 3, 4}, []float64{1, 2, 3, 4}, ScoreError{0, 0, 1}},
+		{"monotone", []float64{1, 2, 3, 4}, []float64{1, 2, 3, 5}, ScoreError{0.25, 1, 1}},
+		{"reversed", []float64{1, 2, 3}, []float64{3, 2, 1}, ScoreError{4.0 / 3, 2, -1}},
+		// ranks 0, 1, 2, 3 against 0.5, 0.5, 2.5, 2.5 correlate 4/sqrt(5*4)
+		{"ties", []float64{1, 2, 3, 4}, []float64{1, 1, 3, 3}, ScoreError{0.5, 1, 2 / math.Sqrt(5)}},
+		{"constant", []float64{1, 2, 3}, []float64{2, 2, 2}, ScoreError{2.0 / 3, 1, math.NaN()}},
+		{"empty", nil, nil, ScoreError{0, 0, math.NaN()}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			scoreError := CompareScores(test.exact, test.reconstructed)
+			if math.Abs(scoreError.MeanAbsoluteError-test.expected.MeanAbsoluteError) > 1e-12 {
+				t.Errorf("MeanAbsoluteError = %v, want %v", scoreError.MeanAbsoluteError, test.expected.MeanAbsoluteError)
+			}
+			if scoreError.MaxAbsoluteError != test.expected.MaxAbsoluteError {
+				t.Errorf("MaxAbsoluteError = %v, want %v", scoreError.MaxAbsoluteError, test.expected.MaxAbsoluteError)
+			}
+			if math.IsNaN(test.expected.Spearman) != math.IsNaN(scoreError.Spearman) || math.Abs(scoreError.Spearman-test.expected.Spearman) > 1e-12 {
+				t.Errorf("Spearman = %v, want %v", scoreError.Spearman, test.expected.Spearman)
+			}
+		})
+	}
+}
+
+func TestDequantizerScore(t *testing.T) {
+	tests := []struct {
+		name       string
+		provenance Provenance
+		impacts    []int32
+		expected   []float64
+	}{
+		// 3 levels over [0, 3]: midpoints of [0, 1.5) and [1.5, 3), then the largest score
+		{"uniform", Provenance{Bits: 2, Scheme: "uniform", ScoreRange: ScoreRange{Min: 0, Max: 3}}, []int32{1, 2, 3}, []float64{0.75, 2.25, 3}},
+		{"uniform zero impact", Provenance{Bits: 2, ZeroImpact: true, Scheme: "uniform", ScoreRange: ScoreRange{Min: 1, Max: 4}}, []int32{0, 1, 2, 3}, []float64{1.5, 2.5, 3.5, 4}},
+		{"unnamed scheme", Provenance{Bits: 2, ScoreRange: ScoreRange{Min: 0, Max: 3}}, []int32{1}, []float64{0.75}},
+		{"clamped", Provenance{Bits: 2, Scheme: "uniform", ScoreRange: ScoreRange{Min: 0, Max: 3}}, []int32{0, 7}, []float64{0.75, 3}},
+		// levels split log1p(e^2-1) = 2 in halves: expm1(0.5), expm1(1.5)
+		{"log", Provenance{Bits: 2, Scheme: "log", ScoreRange: ScoreRange{Min: 1, Max: math.Exp(2)}}, []int32{1, 2, 3}, []float64{1 + math.Expm1(0.5), 1 + math.Expm1(1.5), math.Exp(2)}},
+		{"quantile", Provenance{Bits: 2, Scheme: "quantile", Points: []float64{0.5, 1.25, 9}}, []int32{1, 2, 3}, []float64{0.5, 1.25, 9}},
+		{"lloyd-max", Provenance{Bits: 1, ZeroImpact: true, Scheme: "lloyd-max", Points: []float64{-1, 1}}, []int32{0, 1}, []float64{-1, 1}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dequantizer, err := NewDequantizer(test.provenance)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for impactIndex, impact := range test.impacts {
+				score := dequantizer.Score(impact)
+				if math.Abs(score-test.expected[impactIndex]) > 1e-12 {
+					t.Errorf("Score(%d) = %v, want %v", impact, score, test.expected[impactIndex])
+				}
+			}
+		})
+	}
+}
+
+func TestNewDequantizerErrors(t *testing.T) {
+	_, err := NewDequantizer(Provenance{Bits: 8, Scheme: "local"})
+	if !errors.Is(err, ErrLocalScheme) {
+		t.Errorf("local scheme: error %v, want ErrLocalScheme", err)
+	}
+	_, err = NewDequantizer(Provenance{Bits: 2, Scheme: "quantile", Points: []float64{1, 2}})
+	if err == nil {
+		t.Error("accepted 2 points for 3 levels")
+	}
+	_, err = NewDequantizer(Provenance{Bits: 40})
+	if err == nil {
+		t.Error("accepted 40 bit impacts")
+	}
+}
+
+// TestDequantizeRoundTrip checks every scheme reconstructs the scores it quantized, to within half a
+// level for the uniform scheme.
+func TestDequantizeRoundTrip(t *testing.T) {
+	postingsLists, docRecords, stats := testIndex(100, 200)
+	docLengths := DocLengths(docRecords)
+	scorer, err := NewScorer("atire-bm25", DefaultParameters("atire-bm25"), stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []string{"uniform", "log", "quantile", "lloyd-max"} {
+		t.Run(scheme, func(t *testing.T) {
+			options := Options{Bits: 8, Scheme: scheme}
+			quantizer, err := NewQuantizer(scorer, options)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, postingsList := range postingsLists {
+				quantizer.FindScoreRange(postingsList, docLengths)
+			}
+			quantizer.Fit()
+			dequantizer, err := NewDequantizer(Provenance{Bits: options.Bits, Scheme: scheme, ScoreRange: quantizer.Range(), Points: quantizer.Points()})
+			if err != nil {
+				t.Fatal(err)
+			}
+			var exact, reconstructed []float64
+			for _, postingsList := range postingsLists {
+				termWeight := scorer.TermWeight(postingsList.Df, postingsList.Cf)
+				for _, posting := range postingsList.Postings {
+					score := scorer.Score(posting.Tf, docLengths[posting.Docid], termWeight)
+					exact = append(exact, score)
+					reconstructed = append(reconstructed, dequantizer.Score(quantizer.Quantize(score)))
+				}
+			}
+			scoreError := CompareScores(exact, reconstructed)
+			scoreRange := quantizer.Range()
+			if scheme == "uniform" {
+				levelWidth := (scoreRange.Max - scoreRange.Min) / 254
+				if scoreError.MaxAbsoluteError > levelWidth/2+1e-9 {
+					t.Errorf("MaxAbsoluteError = %v, want at most half of level width %v", scoreError.MaxAbsoluteError, levelWidth)
+				}
+			}
+			if scoreError.MeanAbsoluteError > 0.01*(scoreRange.Max-scoreRange.Min) {
+				t.Errorf("MeanAbsoluteError = %v over range %v", scoreError.MeanAbsoluteError, scoreRange)
+			}
+			if scoreError.Spearman < 0.99 {
+				t.Errorf("Spearman = %v, want at least 0.99", scoreError.Spearman)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package quantize
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+)
+
+// provenancePrefix starts the line of Header.Description holding a Provenance.
+const provenancePrefix = "ciffTools-quantize: "
+
+// ErrNoProvenance is returned by ParseProvenance when a description holds no provenance.
+var ErrNoProvenance = errors.New("description holds no quantization provenance")
+
+// Provenance records how a quantized CIFF was produced. It is stored as a single line of JSON appended
+// to Header.Description.
+type Provenance struct {
+	Scorer       string     `json:"scorer"`
+	Parameters   Parameters `json:"parameters"`
+	Bits         int32      `json:"bits"`
+	ZeroImpact   bool       `json:"zeroImpact"`
+	Scheme       string     `json:"scheme"`
+	ScoreRange   ScoreRange `json:"scoreRange"`
+	Points       []float64  `json:"points,omitempty"` // reconstruction points of the quantile and lloyd-max schemes
+	ToolVersion  string     `json:"toolVersion"`
+	Source       string     `json:"source"`
+	SourceSHA256 string     `json:"sourceSha256"`
+}
+
+// AppendTo returns description with the provenance appended on its own line.
+func (provenance Provenance) AppendTo(description string) (string, error) {
+	encoded, err := json.Marshal(provenance)
+	if err != nil {
+		return "", err
+	}
+	if description != "" {
+		description += "\n"
+	}
+	return description + provenancePrefix + string(encoded), nil
+}
+
+// ParseProvenance returns the last provenance appended to description, which describes the most recent
+// quantization.
+func ParseProvenance(description string) (Provenance, error) {
+	lines := strings.Split(description, "\n")
+	for lineIndex := len(lines) - 1; lineIndex >= 0; lineIndex-- {
+		encoded, found := strings.CutPrefix(lines[lineIndex], provenancePrefix)
+		if !found {
+			continue
+		}
+		provenance := Provenance{}
+		err := json.Unmarshal([]byte(encoded), &provenance)
+		return provenance, err
+	}
+	return Provenance{}, ErrNoProvenance
+}
@@ -1,54 +1,291 @@
 package quantize
 
 import (
+	"fmt"
 	"math"
+	"sync"
+	"sync/atomic"
 
 	"github.com/Axiomatic314/ciffTools/ciff"
 )
 
-var smallestRSV float64 = math.MaxFloat64
-var largestRSV float64 = 0
+// ScoreRange is the smallest and largest score a Quantizer has seen.
+type ScoreRange struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
 
-// uniform quantization
-func quantize(x float64, bits int32) int32 {
-	scale := math.Pow(2, float64(bits)) - 2
-	return int32(((x-smallestRSV)/(largestRSV-smallestRSV))*scale) + 1
+func emptyScoreRange() ScoreRange {
+	return ScoreRange{Min: math.MaxFloat64, Max: -math.MaxFloat64}
 }
 
-func QuantizeIndex(postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord, averageDocLength float64, numDocs int32, bits int32, k1 float64, b float64) {
-	scorer := rankingFunction{
-		k1:               k1,
-		b:                b,
-		numDocs:          numDocs,
-		averageDocLength: averageDocLength,
+func (scoreRange *ScoreRange) add(score float64) {
+	if score < scoreRange.Min {
+		scoreRange.Min = score
+	}
+	if score > scoreRange.Max {
+		scoreRange.Max = score
 	}
+}
 
-	//find smallest and largest impacts
-	for postingListIndex := range len(postingsLists) {
-		idf := scorer.IDF(postingsLists[postingListIndex].Df)
-		postings := postingsLists[postingListIndex].Postings
-		for postingIndex := range len(postings) {
-			termFreq := postings[postingIndex].Tf
-			docLength := docRecords[postings[postingIndex].Docid].Doclength
-			score := scorer.ATIRE_BM25(termFreq, docLength, idf)
-			if score < smallestRSV {
-				smallestRSV = score
-			}
-			if score > largestRSV {
-				largestRSV = score
-			}
+// MaxBits is the widest impact, the largest whose impacts up to 2^bits-1 fit the int32 Posting.Tf field.
+const MaxBits = 31
+
+// Options controls the range of impacts a Quantizer produces.
+type Options struct {
+	// Bits is the width of an impact, between 1 and MaxBits.
+	Bits int32
+	// ZeroImpact makes 0 a valid impact, so the lowest score maps to 0 rather than 1.
+	ZeroImpact bool
+	// Scheme is one of SchemeNames, uniform if empty.
+	Scheme string
+	// Workers is the number of goroutines QuantizeIndex spreads the postings lists over. It does not
+	// change the impacts produced.
+	Workers int
+}
+
+// ImpactRange returns the smallest and largest impact produced with these options.
+func (options Options) ImpactRange() (int64, int64) {
+	largest := int64(1)<<options.Bits - 1
+	if options.ZeroImpact {
+		return 0, largest
+	}
+	return 1, largest
+}
+
+func (options Options) validate() error {
+	if options.Bits < 1 || options.Bits > MaxBits {
+		return fmt.Errorf("bits must be between 1 and %d for impacts to fit the int32 Posting.Tf field, got %d", MaxBits, options.Bits)
+	}
+	if options.Scheme != "" && !validScheme(options.Scheme) {
+		return fmt.Errorf("unknown quantization scheme %q", options.Scheme)
+	}
+	if sampledScheme(options.Scheme) && options.Bits > maxSampledBits {
+		return fmt.Errorf("the %s scheme supports at most %d bits", options.Scheme, maxSampledBits)
+	}
+	return nil
+}
+
+// Quantizer maps the scores of a Scorer onto integer impacts. It first has to see every postings list
+// of an index through FindScoreRange, then be fitted with Fit, after which QuantizePostingsList rewrites
+// each list's tfs. FindScoreRange is not safe for concurrent use, but Fork and Merge let each goroutine
+// observe its own share of the postings lists. Once fitted, QuantizePostingsList may be called
+// concurrently.
+type Quantizer struct {
+	scorer                        Scorer
+	scheme                        string
+	workers                       int
+	smallestImpact, largestImpact int64
+	scoreRange                    ScoreRange
+	sample                        *scoreSample
+	boundaries                    []float64 // quantile and lloyd-max: the lowest score of every level but the first
+	points                        []float64 // quantile and lloyd-max: the reconstruction point of every level
+}
+
+func NewQuantizer(scorer Scorer, options Options) (*Quantizer, error) {
+	err := options.validate()
+	if err != nil {
+		return nil, err
+	}
+	smallestImpact, largestImpact := options.ImpactRange()
+	quantizer := &Quantizer{
+		scorer:         scorer,
+		scheme:         options.Scheme,
+		workers:        max(options.Workers, 1),
+		smallestImpact: smallestImpact,
+		largestImpact:  largestImpact,
+		scoreRange:     emptyScoreRange(),
+	}
+	if quantizer.scheme == "" {
+		quantizer.scheme = "uniform"
+	}
+	if sampledScheme(quantizer.scheme) {
+		quantizer.sample = &scoreSample{}
+	}
+	return quantizer, nil
+}
+
+func (quantizer *Quantizer) levels() int64 {
+	return quantizer.largestImpact - quantizer.smallestImpact + 1
+}
+
+// Range returns the score range seen so far.
+func (quantizer *Quantizer) Range() ScoreRange {
+	return quantizer.scoreRange
+}
+
+// Fit derives the quantization levels from the scores seen by FindScoreRange.
+func (quantizer *Quantizer) Fit() {
+	switch quantizer.scheme {
+	case "quantile":
+		quantizer.boundaries, quantizer.points = quantileLevels(quantizer.sample.sortedScores(), quantizer.levels())
+	case "lloyd-max":
+		quantizer.boundaries, quantizer.points = lloydMaxLevels(quantizer.sample.sortedScores(), quantizer.levels())
+	}
+}
+
+// Points returns the reconstruction point of every level, from the smallest impact up, for the schemes
+// fitted to the score distribution. It is nil for the other schemes, whose levels follow from the range.
+func (quantizer *Quantizer) Points() []float64 {
+	return quantizer.points
+}
+
+// Quantize maps a score to its impact. The local scheme falls back to the range of the whole index, as
+// it otherwise quantizes each postings list over its own range.
+func (quantizer *Quantizer) Quantize(x float64) int32 {
+	return quantizer.impact(x, quantizer.scoreRange)
+}
+
+func (quantizer *Quantizer) impact(x float64, scoreRange ScoreRange) int32 {
+	var level int64
+	switch quantizer.scheme {
+	case "log":
+		level = logLevel(x, scoreRange, quantizer.levels())
+	case "quantile", "lloyd-max":
+		level = boundaryLevel(x, quantizer.boundaries)
+	default:
+		level = uniformLevel(x, scoreRange, quantizer.levels())
+	}
+	impact := level + quantizer.smallestImpact
+	return int32(min(max(impact, quantizer.smallestImpact), quantizer.largestImpact))
+}
+
+// FindScoreRange widens the score range with the scores of a single postings list.
+// The postings must hold absolute docids.
+func (quantizer *Quantizer) FindScoreRange(postingsList *ciff.PostingsList, docLengths []int32) {
+	termWeight := quantizer.scorer.TermWeight(postingsList.Df, postingsList.Cf)
+	termKey := termKey(postingsList.Term)
+	postings := postingsList.Postings
+	for postingIndex := range len(postings) {
+		termFreq := postings[postingIndex].Tf
+		docLength := docLengths[postings[postingIndex].Docid]
+		score := quantizer.scorer.Score(termFreq, docLength, termWeight)
+		quantizer.scoreRange.add(score)
+		if quantizer.sample != nil {
+			quantizer.sample.add(postingKey(termKey, postings[postingIndex].Docid), score)
 		}
 	}
+}
+
+// QuantizePostingsList replaces the tfs of a single postings list with quantized impacts.
+func (quantizer *Quantizer) QuantizePostingsList(postingsList *ciff.PostingsList, docLengths []int32) {
+	termWeight := quantizer.scorer.TermWeight(postingsList.Df, postingsList.Cf)
+	postings := postingsList.Postings
+	scores := make([]float64, len(postings))
+	listRange := emptyScoreRange()
+	for postingIndex := range len(postings) {
+		termFreq := postings[postingIndex].Tf
+		docLength := docLengths[postings[postingIndex].Docid]
+		scores[postingIndex] = quantizer.scorer.Score(termFreq, docLength, termWeight)
+		listRange.add(scores[postingIndex])
+	}
+	if quantizer.scheme != "local" {
+		listRange = quantizer.scoreRange
+	}
+	for postingIndex := range len(postings) {
+		postings[postingIndex].Tf = quantizer.impact(scores[postingIndex], listRange)
+	}
+}
+
+// Fork returns an empty Quantizer with the same configuration, for observing a share of the postings
+// lists on another goroutine before being merged back.
+func (quantizer *Quantizer) Fork() *Quantizer {
+	fork := &Quantizer{
+		scorer:         quantizer.scorer,
+		scheme:         quantizer.scheme,
+		workers:        quantizer.workers,
+		smallestImpact: quantizer.smallestImpact,
+		largestImpact:  quantizer.largestImpact,
+		scoreRange:     emptyScoreRange(),
+	}
+	if quantizer.sample != nil {
+		fork.sample = &scoreSample{}
+	}
+	return fork
+}
+
+// Merge adds the scores seen by a fork. The result does not depend on how the postings lists were
+// shared out or the order forks are merged in.
+func (quantizer *Quantizer) Merge(fork *Quantizer) {
+	quantizer.scoreRange.Min = min(quantizer.scoreRange.Min, fork.scoreRange.Min)
+	quantizer.scoreRange.Max = max(quantizer.scoreRange.Max, fork.scoreRange.Max)
+	if quantizer.sample != nil {
+		quantizer.sample.merge(fork.sample)
+	}
+}
+
+// ShareScores makes quantizer use the score range and sample of other, which must have the same scorer
+// and scheme, in place of its own, so several bit widths can be fitted to the scores one Quantizer has
+// seen without copying its sample. Neither may see further postings lists afterwards.
+func (quantizer *Quantizer) ShareScores(other *Quantizer) {
+	quantizer.scoreRange = other.scoreRange
+	quantizer.sample = other.sample
+}
+
+// QuantizeIndex replaces the tfs of every postings list with quantized impacts and returns the score
+// range they were scaled from.
+func (quantizer *Quantizer) QuantizeIndex(postingsLists []*ciff.PostingsList, docLengths []int32) ScoreRange {
+	//find smallest and largest impacts
+	forks := make([]*Quantizer, quantizer.workers)
+	for worker := range forks {
+		forks[worker] = quantizer.Fork()
+	}
+	quantizer.parallel(len(postingsLists), func(worker int, postingListIndex int) {
+		forks[worker].FindScoreRange(postingsLists[postingListIndex], docLengths)
+	})
+	for _, fork := range forks {
+		quantizer.Merge(fork)
+	}
+
+	quantizer.Fit()
+
+	//update tfs with the quantized impacts
+	quantizer.parallel(len(postingsLists), func(worker int, postingListIndex int) {
+		quantizer.QuantizePostingsList(postingsLists[postingListIndex], docLengths)
+	})
+	return quantizer.scoreRange
+}
 
-	//update tfs with uniform quantization
-	for postingListIndex := range len(postingsLists) {
-		idf := scorer.IDF(postingsLists[postingListIndex].Df)
-		postings := postingsLists[postingListIndex].Postings
-		for postingIndex := range len(postings) {
-			termFreq := postings[postingIndex].Tf
-			docLength := docRecords[postings[postingIndex].Docid].Doclength
-			score := scorer.ATIRE_BM25(termFreq, docLength, idf)
-			postings[postingIndex].Tf = quantize(score, bits)
+// parallel calls f for every index below n, spread over the quantizer's workers.
+func (quantizer *Quantizer) parallel(n int, f func(worker int, index int)) {
+	if quantizer.workers == 1 {
+		for index := range n {
+			f(0, index)
 		}
+		return
+	}
+	var next atomic.Int64
+	var wg sync.WaitGroup
+	for worker := range quantizer.workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				index := int(next.Add(1) - 1)
+				if index >= n {
+					return
+				}
+				f(worker, index)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// DocLengths returns the doc lengths indexed by docid.
+func DocLengths(docRecords []*ciff.DocRecord) []int32 {
+	docLengths := make([]int32, len(docRecords))
+	for docRecordIndex, docRecord := range docRecords {
+		docLengths[docRecordIndex] = docRecord.Doclength
+	}
+	return docLengths
+}
+
+// QuantizeIndex quantizes an in-memory index with a new Quantizer.
+func QuantizeIndex(postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord, scorer Scorer, options Options) (ScoreRange, error) {
+	quantizer, err := NewQuantizer(scorer, options)
+	if err != nil {
+		return ScoreRange{}, err
 	}
+	return quantizer.QuantizeIndex(postingsLists, DocLengths(docRecords)), nil
 }
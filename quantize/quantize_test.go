@@ -0,0 +1,213 @@
+package quantize
+
+import (
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"google.golang.org/protobuf/proto"
+)
+
+// testIndex returns a random index and its collection statistics.
+func testIndex(numTerms int, numDocs int32) ([]*ciff.PostingsList, []*ciff.DocRecord, CollectionStats) {
+	header, postingsLists, docRecords := cifftest.Random(1, numTerms, numDocs, 20)
+	stats := CollectionStats{NumDocs: header.NumDocs, AverageDocLength: header.AverageDoclength, TotalTerms: header.TotalTermsInCollection}
+	return postingsLists, docRecords, stats
+}
+
+func equalPostingsLists(t *testing.T, got []*ciff.PostingsList, want []*ciff.PostingsList) {
+	t.Helper()
+	for listIndex := range want {
+		if !proto.Equal(got[listIndex], want[listIndex]) {
+			t.Fatalf("postings list %q differs:\n%v\nwant\n%v", want[listIndex].Term, got[listIndex], want[listIndex])
+		}
+	}
+}
+
+// baselineQuantizeIndex is the quantizer ciffTools started from: ATIRE BM25 scores scaled uniformly
+// onto impacts from 1 to 2^bits-1.
+func baselineQuantizeIndex(postingsLists []*ciff.PostingsList, docRecords []*ciff.DocRecord, averageDocLength float64, numDocs int32, bits int32, k1 float64, b float64) {
+	idf := func(docFreq int64) float64 {
+		return math.Log((float64(numDocs)) / float64(docFreq))
+	}
+	atireBM25 := func(termFreq int32, docLength int32, idf float64) float64 {
+		top := (k1 + 1) * float64(termFreq)
+		termWeight := top / (k1*(1-b+b*(float64(docLength)/averageDocLength)) + float64(termFreq))
+		return idf * termWeight
+	}
+	smallestRSV, largestRSV := math.MaxFloat64, 0.0
+	for _, postingsList := range postingsLists {
+		idf := idf(postingsList.Df)
+		for _, posting := range postingsList.Postings {
+			score := atireBM25(posting.Tf, docRecords[posting.Docid].Doclength, idf)
+			smallestRSV = min(smallestRSV, score)
+			largestRSV = max(largestRSV, score)
+		}
+	}
+	scale := math.Pow(2, float64(bits)) - 2
+	for _, postingsList := range postingsLists {
+		idf := idf(postingsList.Df)
+		for _, posting := range postingsList.Postings {
+			score := atireBM25(posting.Tf, docRecords[posting.Docid].Doclength, idf)
+			posting.Tf = int32(((score-smallestRSV)/(largestRSV-smallestRSV))*scale) + 1
+		}
+	}
+}
+
+func TestUniformMatchesBaseline(t *testing.T) {
+	postingsLists, docRecords, stats := testIndex(200, 300)
+	for _, bits := range []int32{2, 8, 16} {
+		t.Run(fmt.Sprintf("%d bits", bits), func(t *testing.T) {
+			parameters := DefaultParameters("atire-bm25")
+			want := cifftest.ClonePostingsLists(postingsLists)
+			baselineQuantizeIndex(want, docRecords, stats.AverageDocLength, stats.NumDocs, bits, parameters.K1, parameters.B)
+
+			scorer, err := NewScorer("atire-bm25", parameters, stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := cifftest.ClonePostingsLists(postingsLists)
+			_, err = QuantizeIndex(got, docRecords, scorer, Options{Bits: bits, Scheme: "uniform", Workers: 4})
+			if err != nil {
+				t.Fatal(err)
+			}
+			equalPostingsLists(t, got, want)
+		})
+	}
+}
+
+func TestWorkersDoNotChangeImpacts(t *testing.T) {
+	postingsLists, docRecords, stats := testIndex(200, 300)
+	scorer, err := NewScorer("lucene-bm25", DefaultParameters("lucene-bm25"), stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range SchemeNames {
+		t.Run(scheme, func(t *testing.T) {
+			var want []*ciff.PostingsList
+			var wantQuantizer *Quantizer
+			for _, workers := range []int{1, 2, 3, 8} {
+				quantizer, err := NewQuantizer(scorer, Options{Bits: 8, Scheme: scheme, Workers: workers})
+				if err != nil {
+					t.Fatal(err)
+				}
+				got := cifftest.ClonePostingsLists(postingsLists)
+				quantizer.QuantizeIndex(got, DocLengths(docRecords))
+				if want == nil {
+					want, wantQuantizer = got, quantizer
+					continue
+				}
+				if quantizer.Range() != wantQuantizer.Range() {
+					t.Errorf("%d workers: range %v, want %v", workers, quantizer.Range(), wantQuantizer.Range())
+				}
+				if fmt.Sprint(quantizer.Points()) != fmt.Sprint(wantQuantizer.Points()) {
+					t.Errorf("%d workers: points differ", workers)
+				}
+				equalPostingsLists(t, got, want)
+			}
+		})
+	}
+}
+
+func TestForkMergeOrder(t *testing.T) {
+	postingsLists, docRecords, stats := testIndex(100, 200)
+	docLengths := DocLengths(docRecords)
+	scorer, err := NewScorer("atire-bm25", DefaultParameters("atire-bm25"), stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range []string{"quantile", "lloyd-max"} {
+		t.Run(scheme, func(t *testing.T) {
+			sequential, err := NewQuantizer(scorer, Options{Bits: 6, Scheme: scheme})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, postingsList := range postingsLists {
+				sequential.FindScoreRange(postingsList, docLengths)
+			}
+			sequential.Fit()
+
+			// Share the lists out unevenly and merge the forks in reverse.
+			forked, err := NewQuantizer(scorer, Options{Bits: 6, Scheme: scheme})
+			if err != nil {
+				t.Fatal(err)
+			}
+			forks := []*Quantizer{forked.Fork(), forked.Fork(), forked.Fork()}
+			for listIndex, postingsList := range postingsLists {
+				forks[listIndex%7%3].FindScoreRange(postingsList, docLengths)
+			}
+			for forkIndex := len(forks) - 1; forkIndex >= 0; forkIndex-- {
+				forked.Merge(forks[forkIndex])
+			}
+			forked.Fit()
+
+			if forked.Range() != sequential.Range() {
+				t.Errorf("range %v, want %v", forked.Range(), sequential.Range())
+			}
+			if fmt.Sprint(forked.Points()) != fmt.Sprint(sequential.Points()) {
+				t.Errorf("points %v, want %v", forked.Points(), sequential.Points())
+			}
+		})
+	}
+}
+
+func TestImpactRange(t *testing.T) {
+	postingsLists, docRecords, stats := testIndex(50, 100)
+	scorer, err := NewScorer("atire-bm25", DefaultParameters("atire-bm25"), stats)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, scheme := range SchemeNames {
+		for _, zeroImpact := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s zeroImpact=%v", scheme, zeroImpact), func(t *testing.T) {
+				options := Options{Bits: 4, ZeroImpact: zeroImpact, Scheme: scheme}
+				smallest, largest := options.ImpactRange()
+				got := cifftest.ClonePostingsLists(postingsLists)
+				_, err := QuantizeIndex(got, docRecords, scorer, options)
+				if err != nil {
+					t.Fatal(err)
+				}
+				seenSmallest, seenLargest := false, false
+				for _, postingsList := range got {
+					for _, posting := range postingsList.Postings {
+						impact := int64(posting.Tf)
+						if impact < smallest || impact > largest {
+							t.Fatalf("impact %d outside [%d, %d]", impact, smallest, largest)
+						}
+						seenSmallest = seenSmallest || impact == smallest
+						seenLargest = seenLargest || impact == largest
+					}
+				}
+				// Levels fitted to the sample may go unused where scores tie, but the other schemes map the
+				// ends of the range to the ends of the impacts.
+				if !sampledScheme(scheme) && (!seenSmallest || !seenLargest) {
+					t.Errorf("impacts do not span [%d, %d]", smallest, largest)
+				}
+			})
+		}
+	}
+}
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		options Options
+		valid   bool
+	}{
+		{Options{Bits: 8}, true},
+		{Options{Bits: 31}, true},
+		{Options{Bits: 31, ZeroImpact: true}, true},
+		{Options{Bits: 0}, false},
+		{Options{Bits: 32}, false},
+		{Options{Bits: 8, Scheme: "cubic"}, false},
+		{Options{Bits: 20, Scheme: "quantile"}, true},
+		{Options{Bits: 21, Scheme: "lloyd-max"}, false},
+	}
+	for _, test := range tests {
+		err := test.options.validate()
+		if (err == nil) != test.valid {
+			t.Errorf("%+v: validate() = %v, want valid %v", test.options, err, test.valid)
+		}
+	}
+}
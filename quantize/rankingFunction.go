@@ -1,21 +1,235 @@
 package quantize
 
 import (
+	"fmt"
 	"math"
 )
 
-type rankingFunction struct {
-	k1, b            float64
-	numDocs          int32
-	averageDocLength float64
+// CollectionStats are the collection-wide statistics available to a Scorer.
+type CollectionStats struct {
+	NumDocs          int32
+	AverageDocLength float64
+	TotalTerms       int64
 }
 
-func (ranker rankingFunction) IDF(docFreq int64) float64 {
-	return math.Log((float64(ranker.numDocs)) / float64(docFreq))
+// Scorer computes the score of each posting. TermWeight is called once per postings list and its
+// result passed to Score for every posting in that list.
+type Scorer interface {
+	TermWeight(docFreq int64, collectionFreq int64) float64
+	Score(termFreq int32, docLength int32, termWeight float64) float64
 }
 
-func (ranker rankingFunction) ATIRE_BM25(termFreq int32, docLength int32, idf float64) float64 {
-	top := (ranker.k1 + 1) * float64(termFreq)
-	termWeight := top / (ranker.k1*(1-ranker.b+ranker.b*(float64(docLength)/ranker.averageDocLength)) + float64(termFreq))
+// Parameters holds the free parameters of every scorer; each scorer only reads the ones it uses.
+type Parameters struct {
+	K1     float64 `json:"k1"`     // BM25 variants
+	B      float64 `json:"b"`      // BM25 variants
+	Delta  float64 `json:"delta"`  // BM25+ and BM25L
+	Mu     float64 `json:"mu"`     // query likelihood with Dirichlet smoothing
+	Lambda float64 `json:"lambda"` // query likelihood with Jelinek-Mercer smoothing
+	C      float64 `json:"c"`      // PL2
+}
+
+// ScorerNames lists the names accepted by NewScorer.
+var ScorerNames = []string{"atire-bm25", "lucene-bm25", "rsj-bm25", "bm25+", "bm25l", "tfidf", "ql-dirichlet", "ql-jm", "dph", "pl2"}
+
+// DefaultParameters returns the usual parameters for the named scorer.
+func DefaultParameters(name string) Parameters {
+	parameters := Parameters{K1: 0.9, B: 0.4, Mu: 1000, Lambda: 0.1, C: 1}
+	switch name {
+	case "bm25+":
+		parameters.Delta = 1
+	case "bm25l":
+		parameters.Delta = 0.5
+	}
+	return parameters
+}
+
+func NewScorer(name string, parameters Parameters, stats CollectionStats) (Scorer, error) {
+	switch name {
+	case "atire-bm25":
+		return AtireBM25{K1: parameters.K1, B: parameters.B, Stats: stats}, nil
+	case "lucene-bm25":
+		return LuceneBM25{K1: parameters.K1, B: parameters.B, Stats: stats}, nil
+	case "rsj-bm25":
+		return RobertsonBM25{K1: parameters.K1, B: parameters.B, Stats: stats}, nil
+	case "bm25+":
+		return BM25Plus{K1: parameters.K1, B: parameters.B, Delta: parameters.Delta, Stats: stats}, nil
+	case "bm25l":
+		return BM25L{K1: parameters.K1, B: parameters.B, Delta: parameters.Delta, Stats: stats}, nil
+	case "tfidf":
+		return TFIDF{Stats: stats}, nil
+	case "ql-dirichlet":
+		return Dirichlet{Mu: parameters.Mu, Stats: stats}, nil
+	case "ql-jm":
+		return JelinekMercer{Lambda: parameters.Lambda, Stats: stats}, nil
+	case "dph":
+		return DPH{Stats: stats}, nil
+	case "pl2":
+		return PL2{C: parameters.C, Stats: stats}, nil
+	}
+	return nil, fmt.Errorf("unknown scorer %q", name)
+}
+
+func (stats CollectionStats) lengthRatio(docLength int32) float64 {
+	return float64(docLength) / stats.AverageDocLength
+}
+
+// AtireBM25 is BM25 as implemented in ATIRE and JASS, with IDF log(N/df).
+type AtireBM25 struct {
+	K1, B float64
+	Stats CollectionStats
+}
+
+func (ranker AtireBM25) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return math.Log((float64(ranker.Stats.NumDocs)) / float64(docFreq))
+}
+
+func (ranker AtireBM25) Score(termFreq int32, docLength int32, idf float64) float64 {
+	top := (ranker.K1 + 1) * float64(termFreq)
+	termWeight := top / (ranker.K1*(1-ranker.B+ranker.B*ranker.Stats.lengthRatio(docLength)) + float64(termFreq))
 	return idf * termWeight
 }
+
+// LuceneBM25 is BM25 as implemented in Lucene 8 onwards, which drops the (k1+1) numerator and uses an
+// IDF that is never negative.
+type LuceneBM25 struct {
+	K1, B float64
+	Stats CollectionStats
+}
+
+func (ranker LuceneBM25) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return math.Log(1 + (float64(ranker.Stats.NumDocs)-float64(docFreq)+0.5)/(float64(docFreq)+0.5))
+}
+
+func (ranker LuceneBM25) Score(termFreq int32, docLength int32, idf float64) float64 {
+	tf := float64(termFreq)
+	return idf * tf / (tf + ranker.K1*(1-ranker.B+ranker.B*ranker.Stats.lengthRatio(docLength)))
+}
+
+// RobertsonBM25 is the original BM25 with the Robertson/Sparck-Jones IDF, which is negative for terms
+// in more than half of the documents.
+type RobertsonBM25 struct {
+	K1, B float64
+	Stats CollectionStats
+}
+
+func (ranker RobertsonBM25) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return math.Log((float64(ranker.Stats.NumDocs) - float64(docFreq) + 0.5) / (float64(docFreq) + 0.5))
+}
+
+func (ranker RobertsonBM25) Score(termFreq int32, docLength int32, idf float64) float64 {
+	tf := float64(termFreq)
+	return idf * (ranker.K1 + 1) * tf / (ranker.K1*(1-ranker.B+ranker.B*ranker.Stats.lengthRatio(docLength)) + tf)
+}
+
+// BM25Plus is BM25+ (Lv and Zhai, 2011), which lower-bounds the contribution of a matching term by delta.
+type BM25Plus struct {
+	K1, B, Delta float64
+	Stats        CollectionStats
+}
+
+func (ranker BM25Plus) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return math.Log((float64(ranker.Stats.NumDocs) + 1) / float64(docFreq))
+}
+
+func (ranker BM25Plus) Score(termFreq int32, docLength int32, idf float64) float64 {
+	tf := float64(termFreq)
+	return idf * ((ranker.K1+1)*tf/(ranker.K1*(1-ranker.B+ranker.B*ranker.Stats.lengthRatio(docLength))+tf) + ranker.Delta)
+}
+
+// BM25L is BM25L (Lv and Zhai, 2011), which shifts the length-normalised tf to avoid over-penalising
+// long documents.
+type BM25L struct {
+	K1, B, Delta float64
+	Stats        CollectionStats
+}
+
+func (ranker BM25L) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return math.Log((float64(ranker.Stats.NumDocs) + 1) / (float64(docFreq) + 0.5))
+}
+
+func (ranker BM25L) Score(termFreq int32, docLength int32, idf float64) float64 {
+	ctd := float64(termFreq)/(1-ranker.B+ranker.B*ranker.Stats.lengthRatio(docLength)) + ranker.Delta
+	return idf * (ranker.K1 + 1) * ctd / (ranker.K1 + ctd)
+}
+
+// TFIDF is log-scaled tf multiplied by IDF log(N/df).
+type TFIDF struct {
+	Stats CollectionStats
+}
+
+func (ranker TFIDF) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return math.Log(float64(ranker.Stats.NumDocs) / float64(docFreq))
+}
+
+func (ranker TFIDF) Score(termFreq int32, docLength int32, idf float64) float64 {
+	return (1 + math.Log(float64(termFreq))) * idf
+}
+
+// Dirichlet is a per-posting approximation of query likelihood with Dirichlet smoothing. It is not
+// rank-equivalent to query likelihood: the document length normalisation log(mu/(|d|+mu)) is added to
+// every posting, so a document only pays it for the query terms it contains, whereas query likelihood
+// charges every document once per query term. The term weight is the collection probability cf/|C|.
+type Dirichlet struct {
+	Mu    float64
+	Stats CollectionStats
+}
+
+func (ranker Dirichlet) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return float64(collectionFreq) / float64(ranker.Stats.TotalTerms)
+}
+
+func (ranker Dirichlet) Score(termFreq int32, docLength int32, collectionProbability float64) float64 {
+	return math.Log(1+float64(termFreq)/(ranker.Mu*collectionProbability)) + math.Log(ranker.Mu/(float64(docLength)+ranker.Mu))
+}
+
+// JelinekMercer is query likelihood with Jelinek-Mercer smoothing, in the rank-equivalent form that
+// drops the document-independent log(lambda) term. The term weight is the collection probability cf/|C|.
+type JelinekMercer struct {
+	Lambda float64
+	Stats  CollectionStats
+}
+
+func (ranker JelinekMercer) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return float64(collectionFreq) / float64(ranker.Stats.TotalTerms)
+}
+
+func (ranker JelinekMercer) Score(termFreq int32, docLength int32, collectionProbability float64) float64 {
+	return math.Log(1 + (1-ranker.Lambda)*float64(termFreq)/float64(docLength)/(ranker.Lambda*collectionProbability))
+}
+
+// DPH is the parameter-free hypergeometric DFR model (Amati, 2006) as implemented in Terrier. The term
+// weight is N/cf.
+type DPH struct {
+	Stats CollectionStats
+}
+
+func (ranker DPH) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return float64(ranker.Stats.NumDocs) / float64(collectionFreq)
+}
+
+func (ranker DPH) Score(termFreq int32, docLength int32, inverseCollectionFreq float64) float64 {
+	tf := float64(termFreq)
+	f := tf / float64(docLength)
+	if f >= 1 {
+		return 0
+	}
+	norm := (1 - f) * (1 - f) / (tf + 1)
+	return norm * (tf*math.Log2(tf*ranker.Stats.AverageDocLength/float64(docLength)*inverseCollectionFreq) + 0.5*math.Log2(2*math.Pi*tf*(1-f)))
+}
+
+// PL2 is the DFR model with Poisson randomness, Laplace after-effect and normalisation 2, as
+// implemented in Terrier. The term weight is the mean frequency cf/N.
+type PL2 struct {
+	C     float64
+	Stats CollectionStats
+}
+
+func (ranker PL2) TermWeight(docFreq int64, collectionFreq int64) float64 {
+	return float64(collectionFreq) / float64(ranker.Stats.NumDocs)
+}
+
+func (ranker PL2) Score(termFreq int32, docLength int32, meanFreq float64) float64 {
+	tfn := float64(termFreq) * math.Log2(1+ranker.C*ranker.Stats.AverageDocLength/float64(docLength))
+	return (tfn*math.Log2(1/meanFreq) + meanFreq*math.Log2E + 0.5*math.Log2(2*math.Pi*tfn) + tfn*(math.Log2(tfn)-math.Log2E)) / (tfn + 1)
+}
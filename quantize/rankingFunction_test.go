@@ -0,0 +1,92 @@
+package quantize
+
+import (
+	"math"
+	"testing"
+)
+
+func TestScorers(t *testing.T) {
+	// A posting with tf 2 in a document twice the average length, of a term in 10 of 100 documents
+	// occurring 20 times in a collection of 5000 terms. The expected scores were computed by hand from the
+	// published formulas with the default parameters.
+	stats := CollectionStats{NumDocs: 100, AverageDocLength: 50, TotalTerms: 5000}
+	const termFreq, docLength, docFreq, collectionFreq = 2, 100, 10, 20
+	tests := []struct {
+		scorer   string
+		expected float64
+	}{
+		// log(100/10) * 1.9*2 / (0.9*(0.6+0.4*2) + 2)
+		{"atire-bm25", 2.6839948936740416},
+		// log(1 + 90.5/10.5) * 2 / (2 + 0.9*(0.6+0.4*2))
+		{"lucene-bm25", 1.388800772808455},
+		// log(90.5/10.5) * 1.9*2 / (0.9*(0.6+0.4*2) + 2)
+		{"rsj-bm25", 2.510767931123046},
+		// log(101/10) * (1.9*2 / (0.9*(0.6+0.4*2) + 2) + 1)
+		{"bm25+", 5.008128862687524},
+		// log(101/10.5) * 1.9*c / (0.9 + c), c = 2/(0.6+0.4*2) + 0.5
+		{"bm25l", 2.932579086400762},
+		// (1 + log 2) * log(100/10)
+		{"tfidf", 3.8986154582022285},
+		// log(1 + 2/(1000*20/5000)) + log(1000/(100+1000))
+		{"ql-dirichlet", 0.3101549283038395},
+		// log(1 + 0.9*2/100/(0.1*20/5000))
+		{"ql-jm", 3.828641396489095},
+		// (1-f)^2/(tf+1) * (tf*log2(tf*50/100*100/20) + 0.5*log2(2*pi*tf*(1-f))), f = 2/100
+		{"dph", 2.066470616948851},
+		// tfn = 2*log2(1 + 50/100), m = 20/100:
+		// (tfn*log2(1/m) + m*log2(e) + 0.5*log2(2*pi*tfn) + tfn*(log2(tfn) - log2(e))) / (tfn+1)
+		{"pl2", 1.3922239812172323},
+	}
+	if len(tests) != len(ScorerNames) {
+		t.Errorf("%d scorers tested, but ScorerNames has %d", len(tests), len(ScorerNames))
+	}
+	for _, test := range tests {
+		t.Run(test.scorer, func(t *testing.T) {
+			scorer, err := NewScorer(test.scorer, DefaultParameters(test.scorer), stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			score := scorer.Score(termFreq, docLength, scorer.TermWeight(docFreq, collectionFreq))
+			if math.Abs(score-test.expected) > 1e-12 {
+				t.Errorf("score = %.16g, want %.16g", score, test.expected)
+			}
+		})
+	}
+}
+
+func TestScorerParameters(t *testing.T) {
+	stats := CollectionStats{NumDocs: 100, AverageDocLength: 50, TotalTerms: 5000}
+	tests := []struct {
+		scorer     string
+		parameters Parameters
+		expected   float64
+	}{
+		// b = 0 ignores the doc length: log(10) * 2.2*2 / (1.2 + 2)
+		{"atire-bm25", Parameters{K1: 1.2, B: 0}, math.Log(10) * 2.2 * 2 / 3.2},
+		// delta = 0 reduces BM25+ to BM25 with IDF log((N+1)/df)
+		{"bm25+", Parameters{K1: 0.9, B: 0.4}, math.Log(10.1) * 1.9 * 2 / (0.9*1.4 + 2)},
+		// mu = 100: log(1 + 2/(100*0.004)) + log(100/200)
+		{"ql-dirichlet", Parameters{Mu: 100}, math.Log(6) + math.Log(0.5)},
+		// lambda = 0.5: log(1 + 0.5*2/100/(0.5*0.004))
+		{"ql-jm", Parameters{Lambda: 0.5}, math.Log(6)},
+	}
+	for _, test := range tests {
+		t.Run(test.scorer, func(t *testing.T) {
+			scorer, err := NewScorer(test.scorer, test.parameters, stats)
+			if err != nil {
+				t.Fatal(err)
+			}
+			score := scorer.Score(2, 100, scorer.TermWeight(10, 20))
+			if math.Abs(score-test.expected) > 1e-12 {
+				t.Errorf("score = %.16g, want %.16g", score, test.expected)
+			}
+		})
+	}
+}
+
+func TestUnknownScorer(t *testing.T) {
+	_, err := NewScorer("bm26", DefaultParameters("bm26"), CollectionStats{})
+	if err == nil {
+		t.Error("NewScorer accepted an unknown scorer")
+	}
+}
@@ -0,0 +1,214 @@
+package quantize
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"math"
+	"slices"
+	"sort"
+)
+
+// SchemeNames lists the quantization schemes accepted in Options.Scheme.
+//   - uniform: equal width levels between the smallest and largest score of the index.
+//   - log: equal width levels over the logarithm of the score, shifted to start at zero.
+//   - quantile: levels holding equal numbers of postings (equi-depth binning).
+//   - lloyd-max: levels that minimise the mean squared error of the reconstructed scores.
+//   - local: equal width levels between the smallest and largest score of each postings list.
+var SchemeNames = []string{"uniform", "log", "quantile", "lloyd-max", "local"}
+
+// sampleSize bounds the number of scores kept to estimate the score distribution for the quantile and
+// lloyd-max schemes, which is also why those schemes are limited to maxSampledBits.
+const (
+	sampleSize     = 1 << 20
+	maxSampledBits = 20
+)
+
+// lloydMaxIterations bounds the refinement of the lloyd-max levels.
+const lloydMaxIterations = 100
+
+func validScheme(scheme string) bool {
+	return slices.Contains(SchemeNames, scheme)
+}
+
+func sampledScheme(scheme string) bool {
+	return scheme == "quantile" || scheme == "lloyd-max"
+}
+
+func uniformLevel(x float64, scoreRange ScoreRange, levels int64) int64 {
+	if scoreRange.Max <= scoreRange.Min {
+		return levels - 1
+	}
+	return int64(((x - scoreRange.Min) / (scoreRange.Max - scoreRange.Min)) * float64(levels-1))
+}
+
+func logLevel(x float64, scoreRange ScoreRange, levels int64) int64 {
+	if scoreRange.Max <= scoreRange.Min {
+		return levels - 1
+	}
+	return int64(math.Log1p(x-scoreRange.Min) / math.Log1p(scoreRange.Max-scoreRange.Min) * float64(levels-1))
+}
+
+// boundaryLevel returns the number of boundaries at or below x.
+func boundaryLevel(x float64, boundaries []float64) int64 {
+	return int64(sort.Search(len(boundaries), func(i int) bool { return boundaries[i] > x }))
+}
+
+// quantileBoundaries splits the sorted sample into levels of equal size.
+func quantileBoundaries(sortedScores []float64, levels int64) []float64 {
+	if len(sortedScores) == 0 {
+		return nil
+	}
+	boundaries := make([]float64, levels-1)
+	for level := int64(1); level < levels; level++ {
+		boundaries[level-1] = sortedScores[level*int64(len(sortedScores))/levels]
+	}
+	return boundaries
+}
+
+// scorePrefixSums returns the running totals of the sorted sample, for computing centroids.
+func scorePrefixSums(sortedScores []float64) []float64 {
+	prefixSums := make([]float64, len(sortedScores)+1)
+	for scoreIndex, score := range sortedScores {
+		prefixSums[scoreIndex+1] = prefixSums[scoreIndex] + score
+	}
+	return prefixSums
+}
+
+// cellCentroids writes the mean of the sample scores falling in each level to points. These are the
+// reconstruction points of the levels. An empty level takes the point of the level below it.
+func cellCentroids(sortedScores []float64, prefixSums []float64, boundaries []float64, points []float64) {
+	start := 0
+	for level := range points {
+		end := len(sortedScores)
+		if level < len(boundaries) {
+			end = sort.Search(len(sortedScores), func(i int) bool { return sortedScores[i] >= boundaries[level] })
+		}
+		if end > start {
+			points[level] = (prefixSums[end] - prefixSums[start]) / float64(end-start)
+		} else if level > 0 {
+			points[level] = points[level-1]
+		} else {
+			points[level] = sortedScores[0]
+		}
+		start = max(start, end)
+	}
+}
+
+// quantileLevels returns the boundaries and reconstruction points of the quantile scheme.
+func quantileLevels(sortedScores []float64, levels int64) ([]float64, []float64) {
+	boundaries := quantileBoundaries(sortedScores, levels)
+	if boundaries == nil {
+		return nil, nil
+	}
+	points := make([]float64, levels)
+	cellCentroids(sortedScores, scorePrefixSums(sortedScores), boundaries, points)
+	return boundaries, points
+}
+
+// lloydMaxLevels runs Lloyd's algorithm over the sorted sample, starting from the quantile levels: each
+// boundary is the midpoint of its neighbouring reconstruction points, and each reconstruction point is
+// the mean of the scores between its boundaries.
+func lloydMaxLevels(sortedScores []float64, levels int64) ([]float64, []float64) {
+	boundaries := quantileBoundaries(sortedScores, levels)
+	if boundaries == nil {
+		return nil, nil
+	}
+	prefixSums := scorePrefixSums(sortedScores)
+	points := make([]float64, levels)
+	tolerance := 1e-12 * (sortedScores[len(sortedScores)-1] - sortedScores[0])
+
+	for iteration := 0; iteration <= lloydMaxIterations; iteration++ {
+		//reconstruction points are the centroids of their cells
+		cellCentroids(sortedScores, prefixSums, boundaries, points)
+		if iteration == lloydMaxIterations {
+			break
+		}
+
+		//boundaries are the midpoints of the reconstruction points
+		change := 0.0
+		for level := range levels - 1 {
+			boundary := (points[level] + points[level+1]) / 2
+			change = max(change, math.Abs(boundary-boundaries[level]))
+			boundaries[level] = boundary
+		}
+		if change <= tolerance {
+			cellCentroids(sortedScores, prefixSums, boundaries, points)
+			break
+		}
+	}
+	return boundaries, points
+}
+
+// scoreSample keeps the scores of the sampleSize postings with the smallest hash of (term, docid). The
+// sample does not depend on the order in which postings are observed.
+type scoreSample struct {
+	entries sampleHeap
+}
+
+type sampleEntry struct {
+	key   uint64
+	score float64
+}
+
+// sampleHeap is a max-heap on key, so the root is the first entry to evict.
+type sampleHeap []sampleEntry
+
+func (h sampleHeap) Len() int           { return len(h) }
+func (h sampleHeap) Less(i, j int) bool { return h[i].after(h[j]) }
+func (h sampleHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *sampleHeap) Push(x any)        { *h = append(*h, x.(sampleEntry)) }
+func (h *sampleHeap) Pop() any {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+// after orders entries by key, breaking the unlikely ties by score.
+func (entry sampleEntry) after(other sampleEntry) bool {
+	if entry.key != other.key {
+		return entry.key > other.key
+	}
+	return entry.score > other.score
+}
+
+func termKey(term string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(term))
+	return hash.Sum64()
+}
+
+// postingKey mixes a term's key with a docid using the splitmix64 finaliser.
+func postingKey(termKey uint64, docid int32) uint64 {
+	key := termKey ^ (uint64(docid) * 0x9e3779b97f4a7c15)
+	key = (key ^ (key >> 30)) * 0xbf58476d1ce4e5b9
+	key = (key ^ (key >> 27)) * 0x94d049bb133111eb
+	return key ^ (key >> 31)
+}
+
+func (sample *scoreSample) add(key uint64, score float64) {
+	entry := sampleEntry{key: key, score: score}
+	if len(sample.entries) < sampleSize {
+		heap.Push(&sample.entries, entry)
+		return
+	}
+	if sample.entries[0].after(entry) {
+		sample.entries[0] = entry
+		heap.Fix(&sample.entries, 0)
+	}
+}
+
+func (sample *scoreSample) merge(other *scoreSample) {
+	for _, entry := range other.entries {
+		sample.add(entry.key, entry.score)
+	}
+}
+
+func (sample *scoreSample) sortedScores() []float64 {
+	scores := make([]float64, len(sample.entries))
+	for entryIndex, entry := range sample.entries {
+		scores[entryIndex] = entry.score
+	}
+	slices.Sort(scores)
+	return scores
+}
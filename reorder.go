@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sync"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"google.golang.org/protobuf/proto"
+)
+
+// ReorderStrategies lists the ways docids can be reassigned.
+//   - collection-docid: lexicographic order of the collection docids, e.g. URLs.
+//   - random: a random permutation drawn from a seed.
+//   - length: increasing doc length.
+//   - bp: recursive graph bisection (Dhulipala et al., 2016), which places documents sharing terms close
+//     together to shrink the gaps between docids.
+var ReorderStrategies = []string{"collection-docid", "random", "length", "bp"}
+
+// reorderPrefix starts the line of a header description recording how an index was reordered.
+const reorderPrefix = "ciffTools-reorder: "
+
+// CiffReorderer reassigns the docids of a CIFF. The doc records are held in memory, and for bp so is a
+// forward index of the terms of every document. Postings lists are remapped one at a time and sorted by
+// their new docids.
+type CiffReorderer struct {
+	ciffFilePath        string
+	outputCiffFilePath  string
+	permutationFilePath string
+	reorderRecord
+	workers int
+}
+
+// reorderRecord records how a reordered CIFF was produced, as a line of JSON appended to its header
+// description.
+type reorderRecord struct {
+	By           string `json:"by"`
+	Seed         uint64 `json:"seed,omitempty"`
+	BPIterations int    `json:"bpIterations,omitempty"`
+	BPMinSize    int    `json:"bpMinSize,omitempty"`
+	BPMinDf      int64  `json:"bpMinDf,omitempty"`
+	ToolVersion  string `json:"toolVersion"`
+	Source       string `json:"source"`
+}
+
+// logGapCost returns the sum of log2(gap + 1) over the d-gaps of the docids of postings, an estimate of
+// the bits needed to compress them.
+func logGapCost(postings []*ciff.Posting) float64 {
+	cost, previous := 0.0, int32(-1)
+	for _, posting := range postings {
+		cost += math.Log2(float64(posting.Docid - previous))
+		previous = posting.Docid
+	}
+	return cost
+}
+
+// bisection holds the forward index of a recursive graph bisection. docTerms holds the terms of each
+// document, numbered by their postings list.
+type bisection struct {
+	docTerms   [][]int32
+	numTerms   int
+	iterations int
+	minSize    int
+}
+
+// bisectionScratch holds the per-term counts of one goroutine of a bisection. Only the entries of the
+// terms in the current partition are used, and they are reset before returning.
+type bisectionScratch struct {
+	leftDegrees, rightDegrees []int32
+	leftGains, rightGains     []float64 // the gain of moving a document with the term out of each side
+	terms                     []int32   // terms with non-zero degrees
+}
+
+func (bp *bisection) newScratch() *bisectionScratch {
+	return &bisectionScratch{
+		leftDegrees:  make([]int32, bp.numTerms),
+		rightDegrees: make([]int32, bp.numTerms),
+		leftGains:    make([]float64, bp.numTerms),
+		rightGains:   make([]float64, bp.numTerms),
+	}
+}
+
+// bisectionCost is the log gap cost of a term in degree documents of a partition of size documents.
+func bisectionCost(degree int32, size int) float64 {
+	if degree <= 0 {
+		return 0
+	}
+	return float64(degree) * math.Log2(float64(size)/float64(degree+1))
+}
+
+type docGain struct {
+	docid int32
+	gain  float64
+}
+
+// sortByGain orders docs by decreasing gain, breaking ties by docid so the result is deterministic.
+func sortByGain(docs []int32, gains []docGain) {
+	slices.SortFunc(gains, func(a, b docGain) int {
+		if c := cmp.Compare(b.gain, a.gain); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.docid, b.docid)
+	})
+	for docIndex := range docs {
+		docs[docIndex] = gains[docIndex].docid
+	}
+}
+
+// bisect orders docs in place, splitting them in half and swapping documents between the halves while
+// that lowers the log gap cost, then recursing into each half. Halves are bisected concurrently while
+// parallel is above one.
+func (bp *bisection) bisect(docs []int32, parallel int, scratch *bisectionScratch) {
+	if len(docs) <= bp.minSize {
+		slices.Sort(docs)
+		return
+	}
+	left, right := docs[:len(docs)/2], docs[len(docs)/2:]
+	leftGains, rightGains := make([]docGain, len(left)), make([]docGain, len(right))
+	for range bp.iterations {
+		for _, docid := range left {
+			for _, term := range bp.docTerms[docid] {
+				if scratch.leftDegrees[term] == 0 && scratch.rightDegrees[term] == 0 {
+					scratch.terms = append(scratch.terms, term)
+				}
+				scratch.leftDegrees[term]++
+			}
+		}
+		for _, docid := range right {
+			for _, term := range bp.docTerms[docid] {
+				if scratch.leftDegrees[term] == 0 && scratch.rightDegrees[term] == 0 {
+					scratch.terms = append(scratch.terms, term)
+				}
+				scratch.rightDegrees[term]++
+			}
+		}
+		for _, term := range scratch.terms {
+			leftDegree, rightDegree := scratch.leftDegrees[term], scratch.rightDegrees[term]
+			cost := bisectionCost(leftDegree, len(left)) + bisectionCost(rightDegree, len(right))
+			scratch.leftGains[term] = cost - bisectionCost(leftDegree-1, len(left)) - bisectionCost(rightDegree+1, len(right))
+			scratch.rightGains[term] = cost - bisectionCost(leftDegree+1, len(left)) - bisectionCost(rightDegree-1, len(right))
+		}
+		for docIndex, docid := range left {
+			leftGains[docIndex] = docGain{docid: docid}
+			for _, term := range bp.docTerms[docid] {
+				leftGains[docIndex].gain += scratch.leftGains[term]
+			}
+		}
+		for docIndex, docid := range right {
+			rightGains[docIndex] = docGain{docid: docid}
+			for _, term := range bp.docTerms[docid] {
+				rightGains[docIndex].gain += scratch.rightGains[term]
+			}
+		}
+		for _, term := range scratch.terms {
+			scratch.leftDegrees[term], scratch.rightDegrees[term] = 0, 0
+		}
+		scratch.terms = scratch.terms[:0]
+
+		sortByGain(left, leftGains)
+		sortByGain(right, rightGains)
+		swaps := 0
+		for docIndex := 0; docIndex < len(left) && docIndex < len(right); docIndex++ {
+			if leftGains[docIndex].gain+rightGains[docIndex].gain <= 0 {
+				break
+			}
+			left[docIndex], right[docIndex] = right[docIndex], left[docIndex]
+			swaps++
+		}
+		if swaps == 0 {
+			break
+		}
+	}
+
+	if parallel > 1 {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			bp.bisect(right, parallel/2, bp.newScratch())
+		}()
+		bp.bisect(left, parallel-parallel/2, scratch)
+		wg.Wait()
+		return
+	}
+	bp.bisect(left, 1, scratch)
+	bp.bisect(right, 1, scratch)
+}
+
+// readForwardIndex returns the terms of each document, skipping terms in fewer than minDf documents,
+// which cannot bring documents together.
+func (reorderer CiffReorderer) readForwardIndex(numDocs int32) ([][]int32, int, error) {
+	ciffReader, err := openCiff(reorderer.ciffFilePath, reorderer.workers)
+	if err != nil {
+		return nil, 0, fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	docTerms := make([][]int32, numDocs)
+	term := int32(0)
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			return nil, 0, err
+		}
+		if int64(len(postingsList.Postings)) < reorderer.BPMinDf {
+			continue
+		}
+		for _, posting := range postingsList.Postings {
+			docTerms[posting.Docid] = append(docTerms[posting.Docid], term)
+		}
+		term++
+	}
+	return docTerms, int(term), nil
+}
+
+// order returns the docids of docRecords in their new order.
+func (reorderer CiffReorderer) order(docRecords []*ciff.DocRecord) ([]int32, error) {
+	order := make([]int32, len(docRecords))
+	for docid := range order {
+		order[docid] = int32(docid)
+	}
+	switch reorderer.By {
+	case "collection-docid":
+		slices.SortStableFunc(order, func(a, b int32) int {
+			return cmp.Compare(docRecords[a].CollectionDocid, docRecords[b].CollectionDocid)
+		})
+	case "random":
+		random := rand.New(rand.NewPCG(reorderer.Seed, 0))
+		random.Shuffle(len(order), func(i, j int) {
+			order[i], order[j] = order[j], order[i]
+		})
+	case "length":
+		slices.SortStableFunc(order, func(a, b int32) int {
+			return cmp.Compare(docRecords[a].Doclength, docRecords[b].Doclength)
+		})
+	case "bp":
+		slog.Info("reading forward index")
+		docTerms, numTerms, err := reorderer.readForwardIndex(int32(len(docRecords)))
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("bisecting", "docs", len(docRecords), "terms", numTerms)
+		bp := &bisection{docTerms: docTerms, numTerms: numTerms, iterations: reorderer.BPIterations, minSize: reorderer.BPMinSize}
+		bp.bisect(order, max(reorderer.workers, 1), bp.newScratch())
+	}
+	return order, nil
+}
+
+func (reorderer CiffReorderer) Reorder() error {
+	// --------------------------------------------------------------------------------
+	// First pass: read the doc records and find the new order
+	slog.Info("reading doc records")
+	ciffReader, err := openCiff(reorderer.ciffFilePath, 1)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	header := ciffReader.Header()
+	docRecords := make([]*ciff.DocRecord, 0, header.NumDocs)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			ciffReader.Close()
+			return err
+		}
+		docRecords = append(docRecords, docRecord)
+	}
+	ciffReader.Close()
+	order, err := reorderer.order(docRecords)
+	if err != nil {
+		return err
+	}
+	docids := make([]int32, len(order)) // the new docid of each document
+	for newDocid, docid := range order {
+		docids[docid] = int32(newDocid)
+	}
+
+	slog.Info("writing permutation")
+	permutationFileHandle, err := os.Create(reorderer.permutationFilePath)
+	if err != nil {
+		return fmt.Errorf("creating permutation: %w", err)
+	}
+	defer permutationFileHandle.Close()
+	permutationWriter := bufio.NewWriter(permutationFileHandle)
+	for docid, newDocid := range docids {
+		permutationWriter.WriteString(fmt.Sprintf("%d %d\n", docid, newDocid))
+	}
+	err = permutationWriter.Flush()
+	if err != nil {
+		return err
+	}
+
+	// --------------------------------------------------------------------------------
+	// Second pass: remap the postings lists, then write the doc records in their new order
+	slog.Info("writing reordered ciff")
+	workers := max(reorderer.workers, 1)
+	ciffReader, err = openCiff(reorderer.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	record, err := json.Marshal(reorderer.reorderRecord)
+	if err != nil {
+		return err
+	}
+	outputHeader := proto.Clone(header).(*ciff.Header)
+	if outputHeader.Description != "" {
+		outputHeader.Description += "\n"
+	}
+	outputHeader.Description += reorderPrefix + string(record)
+	outputFileHandle, ciffWriter, err := createCiff(reorderer.outputCiffFilePath, outputHeader, workers)
+	if err != nil {
+		return fmt.Errorf("creating output ciff: %w", err)
+	}
+	defer outputFileHandle.Close()
+
+	var costMutex sync.Mutex
+	costBefore, costAfter, numPostings := 0.0, 0.0, int64(0)
+	err = mapPostingsLists(ciffReader, workers, func(postingsList *ciff.PostingsList) {
+		before := logGapCost(postingsList.Postings)
+		for _, posting := range postingsList.Postings {
+			posting.Docid = docids[posting.Docid]
+		}
+		slices.SortFunc(postingsList.Postings, func(a, b *ciff.Posting) int {
+			return cmp.Compare(a.Docid, b.Docid)
+		})
+		after := logGapCost(postingsList.Postings)
+		costMutex.Lock()
+		costBefore, costAfter = costBefore+before, costAfter+after
+		numPostings += int64(len(postingsList.Postings))
+		costMutex.Unlock()
+	}, ciffWriter.WritePostingsList)
+	if err != nil {
+		return err
+	}
+	for newDocid, docid := range order {
+		docRecord := docRecords[docid]
+		docRecord.Docid = int32(newDocid)
+		err = ciffWriter.WriteDocRecord(docRecord)
+		if err != nil {
+			return err
+		}
+	}
+	err = ciffWriter.Close()
+	if err != nil {
+		return err
+	}
+
+	numPostings = max(numPostings, 1)
+	fmt.Printf("log2 gap cost before: %.4f bits per posting\n", costBefore/float64(numPostings))
+	fmt.Printf("log2 gap cost after: %.4f bits per posting\n", costAfter/float64(numPostings))
+	return nil
+}
+
+func reorderCommand(arguments []string) int {
+	flags := flag.NewFlagSet("reorder", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of CIFF file to reorder")
+	outputCiffFilePath := flags.String("outputCiffFilePath", "", "filepath of the reordered CIFF file to write. Any existing file is overwritten!")
+	permutationFilePath := flags.String("permutation", "", "filepath to write the permutation to, as \"docid newDocid\" lines. Defaults to the output CIFF file path suffixed with .permutation.")
+	by := flags.String("by", "bp", fmt.Sprintf("How docids are reassigned, one of %v.", ReorderStrategies))
+	seed := flags.Uint64("seed", 1, "Seed of the random permutation.")
+	bpIterations := flags.Int("bpIterations", 20, "Maximum number of swapping iterations at each level of graph bisection.")
+	bpMinSize := flags.Int("bpMinSize", 16, "Partitions of at most this many documents are not bisected further.")
+	bpMinDf := flags.Int64("bpMinDf", 2, "Terms in fewer documents are ignored by graph bisection.")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to decode, bisect and encode with. The output does not depend on it.")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+	if *outputCiffFilePath == "" {
+		fmt.Println("Please provide an output CIFF file!")
+		return 1
+	}
+	if !slices.Contains(ReorderStrategies, *by) {
+		fmt.Printf("Unknown strategy %q, expected one of %v!\n", *by, ReorderStrategies)
+		return 1
+	}
+	if *permutationFilePath == "" {
+		*permutationFilePath = *outputCiffFilePath + ".permutation"
+	}
+
+	_, ciffFile := filepath.Split(*ciffFilePath)
+	reorderer := CiffReorderer{
+		ciffFilePath:        *ciffFilePath,
+		outputCiffFilePath:  *outputCiffFilePath,
+		permutationFilePath: *permutationFilePath,
+		reorderRecord:       reorderRecord{By: *by, ToolVersion: toolVersion(), Source: ciffFile},
+		workers:             *workers,
+	}
+	switch *by {
+	case "random":
+		reorderer.Seed = *seed
+	case "bp":
+		reorderer.BPIterations, reorderer.BPMinSize, reorderer.BPMinDf = *bpIterations, max(*bpMinSize, 1), *bpMinDf
+	}
+	err := reorderer.Reorder()
+	if err != nil {
+		slog.Error("error reordering ciff", "error", err)
+		return 1
+	}
+	slog.Info("complete")
+	return 0
+}
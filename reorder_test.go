@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/ciffio"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"google.golang.org/protobuf/proto"
+)
+
+// readTestPermutation reads a permutation file of "docid newDocid" lines, failing the test unless it
+// maps the docids 0 to numDocs-1, in order, onto every one of them.
+func readTestPermutation(t *testing.T, path string, numDocs int32) []int32 {
+	t.Helper()
+	docids := make([]int32, 0, numDocs)
+	seen := make([]bool, numDocs)
+	for lineNumber, line := range strings.Split(strings.TrimSuffix(string(readTestFile(t, path)), "\n"), "\n") {
+		var docid, newDocid int32
+		_, err := fmt.Sscanf(line, "%d %d", &docid, &newDocid)
+		if err != nil {
+			t.Fatalf("%s:%d: %v", path, lineNumber+1, err)
+		}
+		if docid != int32(lineNumber) || newDocid < 0 || newDocid >= numDocs || seen[newDocid] {
+			t.Fatalf("%s:%d: %q is not the next docid of a permutation of %d documents", path, lineNumber+1, line, numDocs)
+		}
+		seen[newDocid] = true
+		docids = append(docids, newDocid)
+	}
+	if len(docids) != int(numDocs) {
+		t.Fatalf("%s: %d docids, want %d", path, len(docids), numDocs)
+	}
+	return docids
+}
+
+func TestReorder(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 100, 300, 10)
+	inputPath := writeTestCiff(t, "input.ciff", header, postingsLists, docRecords)
+	records := []reorderRecord{
+		{By: "collection-docid"},
+		{By: "random", Seed: 7},
+		{By: "length"},
+		{By: "bp", BPIterations: 20, BPMinSize: 16, BPMinDf: 2},
+	}
+	for _, record := range records {
+		t.Run(record.By, func(t *testing.T) {
+			var firstOutput []byte
+			for _, workers := range []int{1, 4} {
+				directory := t.TempDir()
+				reorderer := CiffReorderer{
+					ciffFilePath:        inputPath,
+					outputCiffFilePath:  filepath.Join(directory, "reordered.ciff"),
+					permutationFilePath: filepath.Join(directory, "reordered.ciff.permutation"),
+					reorderRecord:       record,
+					workers:             workers,
+				}
+				err := reorderer.Reorder()
+				if err != nil {
+					t.Fatal(err)
+				}
+				validateTestCiff(t, reorderer.outputCiffFilePath, ciffio.ValidateOptions{})
+				output := readTestFile(t, reorderer.outputCiffFilePath)
+				if firstOutput == nil {
+					firstOutput = output
+				} else if !bytes.Equal(output, firstOutput) {
+					t.Errorf("%d workers reorder differently from 1", workers)
+				}
+
+				docids := readTestPermutation(t, reorderer.permutationFilePath, header.NumDocs)
+				if slices.IsSorted(docids) {
+					t.Fatalf("%s left the docids in place", record.By)
+				}
+				reorderedHeader, reorderedPostingsLists, reorderedDocRecords := readTestCiff(t, reorderer.outputCiffFilePath)
+				for _, postingsList := range reorderedPostingsLists {
+					if !slices.IsSortedFunc(postingsList.Postings, func(a, b *ciff.Posting) int {
+						return cmp.Compare(a.Docid, b.Docid)
+					}) {
+						t.Fatalf("%q is not sorted by docid", postingsList.Term)
+					}
+				}
+				for newDocid, docRecord := range reorderedDocRecords {
+					if docRecord.Docid != int32(newDocid) || newDocid > 0 && !inReorderOrder(record.By, reorderedDocRecords[newDocid-1], docRecord) {
+						t.Fatalf("doc record %d %v is out of %s order", newDocid, docRecord, record.By)
+					}
+				}
+				if reorderedHeader.Description == header.Description {
+					t.Errorf("description %q does not record the reordering", reorderedHeader.Description)
+				}
+				reorderedHeader.Description = header.Description
+				if !proto.Equal(reorderedHeader, header) {
+					t.Errorf("header %v, want %v", reorderedHeader, header)
+				}
+
+				// Mapping the new docids back through the inverse permutation gives back the input.
+				inverse := make([]int32, len(docids))
+				for docid, newDocid := range docids {
+					inverse[newDocid] = int32(docid)
+				}
+				for _, postingsList := range reorderedPostingsLists {
+					for _, posting := range postingsList.Postings {
+						posting.Docid = inverse[posting.Docid]
+					}
+					slices.SortFunc(postingsList.Postings, func(a, b *ciff.Posting) int {
+						return cmp.Compare(a.Docid, b.Docid)
+					})
+				}
+				restoredDocRecords := make([]*ciff.DocRecord, len(reorderedDocRecords))
+				for _, docRecord := range reorderedDocRecords {
+					docRecord.Docid = inverse[docRecord.Docid]
+					restoredDocRecords[docRecord.Docid] = docRecord
+				}
+				if !cifftest.EqualPostingsLists(reorderedPostingsLists, postingsLists) {
+					t.Errorf("%d workers: postings lists differ from the input after the inverse permutation", workers)
+				}
+				if !cifftest.EqualDocRecords(restoredDocRecords, docRecords) {
+					t.Errorf("%d workers: doc records differ from the input after the inverse permutation", workers)
+				}
+			}
+		})
+	}
+}
+
+// inReorderOrder reports whether a may precede b in the order of strategy by.
+func inReorderOrder(by string, a *ciff.DocRecord, b *ciff.DocRecord) bool {
+	switch by {
+	case "collection-docid":
+		return a.CollectionDocid <= b.CollectionDocid
+	case "length":
+		return a.Doclength <= b.Doclength
+	}
+	return true
+}
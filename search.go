@@ -0,0 +1,302 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Axiomatic314/ciffTools/analysis"
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/quantize"
+	"github.com/Axiomatic314/ciffTools/search"
+	"github.com/Axiomatic314/ciffTools/trec"
+)
+
+// searchIndexOptions describes how a CIFF is loaded for searching.
+type searchIndexOptions struct {
+	impacts    bool // score postings by their impacts; implied by a quantization provenance in the header
+	scorerName string
+	parameters quantize.Parameters
+	blockSize  int
+	workers    int
+}
+
+// loadSearchIndex reads a CIFF into a search.Index. The doc records are read first, skipping over the
+// postings lists, so the postings can be scored as they are added.
+func loadSearchIndex(ciffFilePath string, options searchIndexOptions) (*search.Index, error) {
+	slog.Info("reading doc records")
+	ciffReader, err := openCiff(ciffFilePath, 1)
+	if err != nil {
+		return nil, fmt.Errorf("opening ciff: %w", err)
+	}
+	header := ciffReader.Header()
+	docRecords := make([]*ciff.DocRecord, 0, header.NumDocs)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			ciffReader.Close()
+			return nil, err
+		}
+		docRecords = append(docRecords, docRecord)
+	}
+	ciffReader.Close()
+
+	var scorer quantize.Scorer
+	_, err = quantize.ParseProvenance(header.Description)
+	if errors.Is(err, quantize.ErrNoProvenance) && !options.impacts {
+		scorer, err = quantize.NewScorer(options.scorerName, options.parameters, collectionStats(header))
+		if err != nil {
+			return nil, err
+		}
+		slog.Info("scoring postings", "scorer", options.scorerName)
+	} else {
+		slog.Info("scoring postings by their impacts")
+	}
+	index, err := search.NewIndex(header, docRecords, scorer, options.blockSize)
+	if err != nil {
+		return nil, err
+	}
+
+	slog.Info("reading postings lists")
+	ciffReader, err = openCiff(ciffFilePath, options.workers)
+	if err != nil {
+		return nil, fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			return nil, err
+		}
+		err = index.Add(postingsList)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return index, nil
+}
+
+// queryAnalyzer returns the analyzer of spec, or if spec is empty the analyzer recorded in the header
+// description, falling back to tokenizing only.
+func queryAnalyzer(spec string, header *ciff.Header) (*analysis.Analyzer, error) {
+	if spec != "" {
+		return analysis.New(spec)
+	}
+	analyzer, err := analysis.FromDescription(header.Description)
+	if errors.Is(err, analysis.ErrNoAnalyzer) {
+		slog.Warn("no analyzer recorded in the ciff, queries are only tokenized; pass -analyzer to match how the ciff was built")
+		return analysis.New("")
+	}
+	return analyzer, err
+}
+
+// algorithmTiming accumulates the time an algorithm takes over every query, and the queries whose
+// results differ from those of the reference, the first algorithm to succeed on the query.
+type algorithmTiming struct {
+	algorithm  string
+	elapsed    time.Duration
+	queries    int
+	reference  string // algorithm the results were last compared with, empty if never compared
+	mismatches int
+	err        error
+}
+
+// readSearchTopics reads the topics of topicsFilePath, or else makes a topic of query, or else of each
+// line of standard input, numbering them from 1.
+func readSearchTopics(query string, topicsFilePath string, topicFormat string) ([]trec.Topic, error) {
+	if topicsFilePath != "" {
+		fileHandle, err := os.Open(topicsFilePath)
+		if err != nil {
+			return nil, err
+		}
+		defer fileHandle.Close()
+		return trec.ReadTopics(fileHandle, topicFormat)
+	}
+	var input io.Reader = os.Stdin
+	if query != "" {
+		input = strings.NewReader(query)
+	}
+	topics := make([]trec.Topic, 0)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), maxDumpLineLength)
+	for scanner.Scan() {
+		topics = append(topics, trec.Topic{ID: strconv.Itoa(len(topics) + 1), Title: scanner.Text()})
+	}
+	return topics, scanner.Err()
+}
+
+// runResults identifies results by their collection docids.
+func runResults(index *search.Index, results []search.Result) []trec.RunResult {
+	runResults := make([]trec.RunResult, len(results))
+	for rank, result := range results {
+		runResults[rank] = trec.RunResult{Docno: index.CollectionDocids[result.Docid], Score: result.Score}
+	}
+	return runResults
+}
+
+// searchRun searches index for the query of each topic, made of its fields, returning the results as a
+// run.
+func searchRun(index *search.Index, analyzer *analysis.Analyzer, topics []trec.Topic, fields []string, options search.Options) (trec.Run, error) {
+	run := make(trec.Run)
+	for _, topic := range topics {
+		text, err := topic.Query(fields)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", topic.ID, err)
+		}
+		results, err := index.Search(analyzer.Analyze(text), options)
+		if err != nil {
+			return nil, err
+		}
+		run[topic.ID] = runResults(index, results)
+	}
+	return run, nil
+}
+
+func searchCommand(arguments []string) int {
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of CIFF file to search")
+	query := flags.String("query", "", "Query to run. If neither it nor -topics is given, each line of standard input is a query.")
+	topicsFilePath := flags.String("topics", "", "filepath of the topics to run.")
+	topicFormat := flags.String("topicFormat", "trec", fmt.Sprintf("Format of the topics, one of %v.", trec.TopicFormats))
+	topicFields := flags.String("topicFields", "title", fmt.Sprintf("Comma separated fields of each topic that make its query, from %v.", trec.TopicFields))
+	runFilePath := flags.String("run", "", "filepath to write the TREC run to. Defaults to standard output.")
+	runTag := flags.String("runTag", "ciffTools", "Tag identifying the run in each line of the TREC run.")
+	algorithm := flags.String("algorithm", "daat", fmt.Sprintf("Query evaluation algorithm, one of %v, or all to run every applicable algorithm, check they agree and time them.", search.Algorithms))
+	k := flags.Int("k", 10, "Number of results per query.")
+	rho := flags.Int64("rho", 0, "Number of postings score-at-a-time evaluation processes before stopping early. Defaults to 0, processing every posting.")
+	analyzerSpec := flags.String("analyzer", "", fmt.Sprintf("Comma separated filters applied to each query token, from %v, or a preset from %v. Defaults to the analyzer recorded in the ciff.", analysis.FilterNames, slices.Sorted(maps.Keys(analysis.Presets))))
+	impacts := flags.Bool("impacts", false, "Bool to score postings by their impacts. Implied for CIFFs with a quantization provenance. Defaults to false.")
+	scorer := scorerFlags(flags)
+	blockSize := flags.Int("blockSize", search.DefaultBlockSize, "Number of postings per block of the block-max scores.")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to decode with.")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+	if *algorithm != "all" && !slices.Contains(search.Algorithms, *algorithm) {
+		fmt.Printf("Unknown algorithm %q, expected one of %v or all!\n", *algorithm, search.Algorithms)
+		return 1
+	}
+
+	scorerName, parameters := scorer()
+	index, err := loadSearchIndex(*ciffFilePath, searchIndexOptions{
+		impacts:    *impacts,
+		scorerName: scorerName,
+		parameters: parameters,
+		blockSize:  *blockSize,
+		workers:    *workers,
+	})
+	if err != nil {
+		slog.Error("error loading ciff", "error", err)
+		return 1
+	}
+	analyzer, err := queryAnalyzer(*analyzerSpec, index.Header)
+	if err != nil {
+		slog.Error("error creating analyzer", "error", err)
+		return 1
+	}
+
+	timings := make([]*algorithmTiming, 0)
+	if *algorithm == "all" {
+		for _, algorithm := range search.Algorithms {
+			timings = append(timings, &algorithmTiming{algorithm: algorithm})
+		}
+	} else {
+		timings = append(timings, &algorithmTiming{algorithm: *algorithm})
+	}
+
+	topics, err := readSearchTopics(*query, *topicsFilePath, *topicFormat)
+	if err != nil {
+		slog.Error("error reading topics", "error", err)
+		return 1
+	}
+	fields := strings.Split(*topicFields, ",")
+	var output io.Writer = os.Stdout
+	if *runFilePath != "" {
+		runFileHandle, err := os.Create(*runFilePath)
+		if err != nil {
+			slog.Error("error creating run", "error", err)
+			return 1
+		}
+		defer runFileHandle.Close()
+		output = runFileHandle
+	}
+	runWriter := trec.NewRunWriter(output, *runTag)
+	defer runWriter.Flush()
+	numTerms, missingTerms := 0, 0
+	for _, topic := range topics {
+		text, err := topic.Query(fields)
+		if err != nil {
+			slog.Error("error reading topic", "topic", topic.ID, "error", err)
+			return 1
+		}
+		terms := analyzer.Analyze(text)
+		for _, term := range terms {
+			numTerms++
+			if index.PostingsList(term) == nil {
+				missingTerms++
+			}
+		}
+		var results []search.Result
+		reference, haveReference := "", false
+		for _, timing := range timings {
+			if timing.err != nil {
+				continue
+			}
+			start := time.Now()
+			algorithmResults, err := index.Search(terms, search.Options{Algorithm: timing.algorithm, K: *k, Rho: *rho})
+			if err != nil {
+				if len(timings) == 1 {
+					slog.Error("error searching", "error", err)
+					return 1
+				}
+				slog.Warn("skipping algorithm", "algorithm", timing.algorithm, "error", err)
+				timing.err = err
+				continue
+			}
+			timing.elapsed += time.Since(start)
+			timing.queries++
+			// The reference may have no results, which the others must then match
+			if !haveReference {
+				results, reference, haveReference = algorithmResults, timing.algorithm, true
+				continue
+			}
+			timing.reference = reference
+			if !slices.Equal(results, algorithmResults) {
+				timing.mismatches++
+			}
+		}
+		err = runWriter.Write(topic.ID, runResults(index, results))
+		if err != nil {
+			slog.Error("error writing run", "error", err)
+			return 1
+		}
+	}
+
+	// Terms missing from the index usually mean the queries were analysed differently from the documents
+	if numTerms > 0 && missingTerms*2 > numTerms {
+		slog.Warn("most query terms are not in the index, check -analyzer", "terms", numTerms, "missing", missingTerms)
+	}
+
+	for _, timing := range timings {
+		if timing.err != nil || timing.queries == 0 {
+			continue
+		}
+		attributes := []any{"algorithm", timing.algorithm, "queries", timing.queries, "meanLatency", timing.elapsed / time.Duration(timing.queries)}
+		if timing.reference != "" {
+			attributes = append(attributes, "reference", timing.reference, "mismatches", timing.mismatches)
+		}
+		slog.Info("timing", attributes...)
+	}
+	return 0
+}
@@ -0,0 +1,205 @@
+package search
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+)
+
+// endDocid is the docid of a cursor past the end of its postings list.
+const endDocid = math.MaxInt32
+
+// cursor iterates over the postings of a query term in docid order.
+type cursor struct {
+	list     *PostingsList
+	weight   float64
+	position int
+	block    int // block of the last shallow move, for block-max scores
+	maxScore float64
+}
+
+func newCursors(queryTerms []queryTerm) []*cursor {
+	cursors := make([]*cursor, len(queryTerms))
+	for term, queryTerm := range queryTerms {
+		cursors[term] = &cursor{list: queryTerm.list, weight: queryTerm.weight, maxScore: float64(queryTerm.list.MaxScore) * queryTerm.weight}
+	}
+	return cursors
+}
+
+func (c *cursor) docid() int32 {
+	if c.position >= len(c.list.Docids) {
+		return endDocid
+	}
+	return c.list.Docids[c.position]
+}
+
+func (c *cursor) score() float64 {
+	return float64(c.list.Scores[c.position]) * c.weight
+}
+
+func (c *cursor) next() {
+	c.position++
+}
+
+// nextGEQ moves to the first posting with a docid of at least target.
+func (c *cursor) nextGEQ(target int32) {
+	if c.docid() >= target {
+		return
+	}
+	remaining := c.list.Docids[c.position:]
+	c.position += sort.Search(len(remaining), func(i int) bool {
+		return remaining[i] >= target
+	})
+}
+
+// blockMax moves the block pointer, but not the postings, to the block that would hold target and
+// returns the largest score of that block and its last docid.
+func (c *cursor) blockMax(target int32) (float64, int32) {
+	for c.block < len(c.list.BlockLastDocids) && c.list.BlockLastDocids[c.block] < target {
+		c.block++
+	}
+	if c.block >= len(c.list.BlockLastDocids) {
+		return 0, endDocid
+	}
+	return float64(c.list.BlockMaxScores[c.block]) * c.weight, c.list.BlockLastDocids[c.block]
+}
+
+func minDocid(cursors []*cursor) int32 {
+	docid := int32(endDocid)
+	for _, c := range cursors {
+		docid = min(docid, c.docid())
+	}
+	return docid
+}
+
+// daat scores every document matching a query term in docid order.
+func daat(cursors []*cursor, results *topK) {
+	for docid := minDocid(cursors); docid != endDocid; docid = minDocid(cursors) {
+		score := 0.0
+		for _, c := range cursors {
+			if c.docid() == docid {
+				score += c.score()
+				c.next()
+			}
+		}
+		results.insert(docid, score)
+	}
+}
+
+// maxScore splits the cursors, ordered by their largest score, into non-essential lists whose scores
+// together cannot lift a document into the results and essential lists that are traversed. Non-essential
+// lists are only probed for the documents of the essential lists, and only while they could still lift
+// that document in.
+func maxScore(cursors []*cursor, results *topK) {
+	slices.SortStableFunc(cursors, func(a, b *cursor) int {
+		return cmp.Compare(a.maxScore, b.maxScore)
+	})
+	upperBounds := make([]float64, len(cursors)) // sum of the largest scores of cursors[:i+1]
+	for term, c := range cursors {
+		upperBounds[term] = c.maxScore
+		if term > 0 {
+			upperBounds[term] += upperBounds[term-1]
+		}
+	}
+	firstEssential := 0
+	for docid := minDocid(cursors); firstEssential < len(cursors) && docid != endDocid; {
+		score, nextDocid := 0.0, int32(endDocid)
+		for _, c := range cursors[firstEssential:] {
+			if c.docid() == docid {
+				score += c.score()
+				c.next()
+			}
+			nextDocid = min(nextDocid, c.docid())
+		}
+		for term := firstEssential - 1; term >= 0; term-- {
+			if score+upperBounds[term] <= results.threshold() {
+				break
+			}
+			c := cursors[term]
+			c.nextGEQ(docid)
+			if c.docid() == docid {
+				score += c.score()
+			}
+		}
+		if results.insert(docid, score) {
+			for firstEssential < len(cursors) && upperBounds[firstEssential] <= results.threshold() {
+				firstEssential++
+			}
+		}
+		docid = nextDocid
+	}
+}
+
+// sortByDocid orders cursors by their current docid. The cursors are nearly sorted after each step, so
+// insertion sort is used.
+func sortByDocid(cursors []*cursor) {
+	for i := 1; i < len(cursors); i++ {
+		for j := i; j > 0 && cursors[j].docid() < cursors[j-1].docid(); j-- {
+			cursors[j], cursors[j-1] = cursors[j-1], cursors[j]
+		}
+	}
+}
+
+// wand orders the cursors by docid and finds the pivot, the first cursor at which the sum of the largest
+// scores of the cursors so far could lift a document into the results. No document before the pivot's
+// docid can enter, so the cursors before the pivot skip to it. With blockMax, the pivot's document is
+// first checked against the largest scores of the blocks holding it, and if it cannot enter, the cursors
+// skip past the end of the first of those blocks.
+func wand(cursors []*cursor, results *topK, blockMax bool) {
+	for {
+		sortByDocid(cursors)
+		upperBound, pivot := 0.0, -1
+		for term, c := range cursors {
+			if c.docid() == endDocid {
+				break
+			}
+			upperBound += c.maxScore
+			if upperBound > results.threshold() {
+				pivot = term
+				break
+			}
+		}
+		if pivot < 0 {
+			return
+		}
+		pivotDocid := cursors[pivot].docid()
+		for pivot+1 < len(cursors) && cursors[pivot+1].docid() == pivotDocid {
+			pivot++
+		}
+
+		if blockMax {
+			blockUpperBound, nextDocid := 0.0, int32(endDocid)
+			for _, c := range cursors[:pivot+1] {
+				blockScore, lastDocid := c.blockMax(pivotDocid)
+				blockUpperBound += blockScore
+				if lastDocid < endDocid {
+					nextDocid = min(nextDocid, lastDocid+1)
+				}
+			}
+			if blockUpperBound <= results.threshold() {
+				if pivot+1 < len(cursors) {
+					nextDocid = min(nextDocid, cursors[pivot+1].docid())
+				}
+				nextDocid = max(nextDocid, pivotDocid+1)
+				for _, c := range cursors[:pivot+1] {
+					c.nextGEQ(nextDocid)
+				}
+				continue
+			}
+		}
+
+		if cursors[0].docid() == pivotDocid {
+			score := 0.0
+			for _, c := range cursors[:pivot+1] {
+				score += c.score()
+				c.next()
+			}
+			results.insert(pivotDocid, score)
+		} else {
+			for _, c := range cursors[:pivot] {
+				c.nextGEQ(pivotDocid)
+			}
+		}
+	}
+}
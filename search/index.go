@@ -0,0 +1,171 @@
+// Package search evaluates bag-of-words queries over a CIFF held in memory.
+//
+// An Index stores the score of every posting, computed when the postings list is added with a
+// quantize.Scorer or, for quantized CIFFs, taken from the impacts. A query scores each document by the
+// sum of the scores of its postings for the query terms, counting repeated terms once per repeat.
+// Every algorithm returns the same documents for the same query, apart from score-at-a-time evaluation
+// stopped early, so they can be compared for efficiency.
+package search
+
+import (
+	"cmp"
+	"fmt"
+	"slices"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/quantize"
+)
+
+// DefaultBlockSize is the number of postings per block of the block-max scores used by Block-Max WAND.
+const DefaultBlockSize = 64
+
+// PostingsList holds the postings of a term in docid order with their scores, the largest score of the
+// list and of each block of postings, and for impact indexes the postings in impact order.
+type PostingsList struct {
+	Term            string
+	Docids          []int32
+	Scores          []float32
+	MaxScore        float32
+	BlockLastDocids []int32 // last docid of each block
+	BlockMaxScores  []float32
+
+	impactDocids []int32   // docids in decreasing impact order, then in docid order
+	segments     []segment // runs of impactDocids with the same impact
+}
+
+// segment is a run of the postings of a list with the same impact.
+type segment struct {
+	impact     float32
+	start, end int
+}
+
+// Index holds the postings lists and doc records of a CIFF for query evaluation.
+type Index struct {
+	Header           *ciff.Header
+	CollectionDocids []string
+	docLengths       []int32
+	scorer           quantize.Scorer // nil when the impacts are the scores
+	blockSize        int
+	lists            map[string]*PostingsList
+	negativeScores   bool
+}
+
+// NewIndex returns an empty index over the documents of docRecords, whose postings lists are added with
+// Add. Postings are scored with scorer, or by their impacts if scorer is nil. blockSize is the number of
+// postings per block, DefaultBlockSize if it is not positive. Every docid must lie in
+// [0, len(docRecords)).
+func NewIndex(header *ciff.Header, docRecords []*ciff.DocRecord, scorer quantize.Scorer, blockSize int) (*Index, error) {
+	if blockSize <= 0 {
+		blockSize = DefaultBlockSize
+	}
+	index := &Index{
+		Header:           header,
+		CollectionDocids: make([]string, len(docRecords)),
+		docLengths:       make([]int32, len(docRecords)),
+		scorer:           scorer,
+		blockSize:        blockSize,
+		lists:            make(map[string]*PostingsList, header.NumPostingsLists),
+	}
+	for _, docRecord := range docRecords {
+		if docRecord.Docid < 0 || int(docRecord.Docid) >= len(docRecords) {
+			return nil, fmt.Errorf("doc record %q: docid %d is not in [0, %d)", docRecord.CollectionDocid, docRecord.Docid, len(docRecords))
+		}
+		index.CollectionDocids[docRecord.Docid] = docRecord.CollectionDocid
+		index.docLengths[docRecord.Docid] = docRecord.Doclength
+	}
+	return index, nil
+}
+
+// Impacts reports whether the scores of the index are the impacts of a quantized CIFF, which score-at-a-
+// time evaluation requires.
+func (index *Index) Impacts() bool {
+	return index.scorer == nil
+}
+
+// NumDocs returns the number of documents in the index.
+func (index *Index) NumDocs() int {
+	return len(index.CollectionDocids)
+}
+
+// Add scores the postings of postingsList and adds them to the index. It is not safe for concurrent use.
+func (index *Index) Add(postingsList *ciff.PostingsList) error {
+	list := &PostingsList{
+		Term:   postingsList.Term,
+		Docids: make([]int32, len(postingsList.Postings)),
+		Scores: make([]float32, len(postingsList.Postings)),
+	}
+	var termWeight float64
+	if index.scorer != nil {
+		termWeight = index.scorer.TermWeight(postingsList.Df, postingsList.Cf)
+	}
+	for postingIndex, posting := range postingsList.Postings {
+		if posting.Docid < 0 || int(posting.Docid) >= index.NumDocs() {
+			return fmt.Errorf("term %q: docid %d is not in [0, %d)", postingsList.Term, posting.Docid, index.NumDocs())
+		}
+		list.Docids[postingIndex] = posting.Docid
+		if index.scorer != nil {
+			list.Scores[postingIndex] = float32(index.scorer.Score(posting.Tf, index.docLengths[posting.Docid], termWeight))
+		} else {
+			list.Scores[postingIndex] = float32(posting.Tf)
+		}
+		if postingIndex == 0 || list.Scores[postingIndex] > list.MaxScore {
+			list.MaxScore = list.Scores[postingIndex]
+		}
+		index.negativeScores = index.negativeScores || list.Scores[postingIndex] < 0
+	}
+	for start := 0; start < len(list.Docids); start += index.blockSize {
+		end := min(start+index.blockSize, len(list.Docids))
+		list.BlockLastDocids = append(list.BlockLastDocids, list.Docids[end-1])
+		list.BlockMaxScores = append(list.BlockMaxScores, slices.Max(list.Scores[start:end]))
+	}
+	if index.Impacts() {
+		order := make([]int, len(list.Docids))
+		for postingIndex := range order {
+			order[postingIndex] = postingIndex
+		}
+		slices.SortStableFunc(order, func(a, b int) int {
+			return cmp.Compare(list.Scores[b], list.Scores[a])
+		})
+		list.impactDocids = make([]int32, len(order))
+		for position, postingIndex := range order {
+			list.impactDocids[position] = list.Docids[postingIndex]
+			if position == 0 || list.Scores[postingIndex] != list.segments[len(list.segments)-1].impact {
+				list.segments = append(list.segments, segment{impact: list.Scores[postingIndex], start: position})
+			}
+			list.segments[len(list.segments)-1].end = position + 1
+		}
+	}
+	index.lists[list.Term] = list
+	return nil
+}
+
+// PostingsList returns the postings list of term, or nil if the term is not in the index.
+func (index *Index) PostingsList(term string) *PostingsList {
+	return index.lists[term]
+}
+
+// queryTerm is a term of a query with the number of times it is repeated.
+type queryTerm struct {
+	list   *PostingsList
+	weight float64
+}
+
+// queryTerms returns the terms of a query that are in the index, in the order they first appear.
+func (index *Index) queryTerms(terms []string) []queryTerm {
+	queryTerms := make([]queryTerm, 0, len(terms))
+	for _, term := range terms {
+		list := index.lists[term]
+		if list == nil {
+			continue
+		}
+		termIndex := slices.IndexFunc(queryTerms, func(queryTerm queryTerm) bool {
+			return queryTerm.list == list
+		})
+		if termIndex >= 0 {
+			queryTerms[termIndex].weight++
+		} else {
+			queryTerms = append(queryTerms, queryTerm{list: list, weight: 1})
+		}
+	}
+	return queryTerms
+}
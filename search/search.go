@@ -0,0 +1,65 @@
+package search
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+)
+
+// Algorithms lists the query evaluation algorithms.
+//   - taat: exhaustive term-at-a-time, accumulating the scores of every document.
+//   - daat: exhaustive document-at-a-time, scoring each matching document in docid order.
+//   - maxscore: document-at-a-time with MaxScore dynamic pruning (Turtle and Flood, 1995).
+//   - wand: document-at-a-time with WAND dynamic pruning (Broder et al., 2003).
+//   - bmw: document-at-a-time with Block-Max WAND dynamic pruning (Ding and Suel, 2011).
+//   - saat: score-at-a-time over the impact ordered postings of a quantized index, as in JASS, stopping
+//     early after Options.Rho postings if it is positive.
+var Algorithms = []string{"taat", "daat", "maxscore", "wand", "bmw", "saat"}
+
+// ErrNotImpacts is returned by score-at-a-time evaluation of an index scored with a ranking function.
+var ErrNotImpacts = errors.New("score-at-a-time evaluation needs an index scored by its impacts")
+
+// ErrNegativeScores is returned by dynamic pruning over an index with negative scores, for which the
+// score upper bounds of partially matching documents do not hold.
+var ErrNegativeScores = errors.New("dynamic pruning needs non-negative scores")
+
+// Options controls the evaluation of a query.
+type Options struct {
+	Algorithm string // one of Algorithms
+	K         int    // number of results
+	Rho       int64  // postings processed by saat before it stops early, or 0 to process every posting
+}
+
+// Search returns the K best documents for the terms of a query, from best to worst. Ties are broken by
+// increasing docid. Terms not in the index are ignored.
+func (index *Index) Search(terms []string, options Options) ([]Result, error) {
+	if !slices.Contains(Algorithms, options.Algorithm) {
+		return nil, fmt.Errorf("unknown algorithm %q, expected one of %v", options.Algorithm, Algorithms)
+	}
+	queryTerms := index.queryTerms(terms)
+	results := &topK{k: max(options.K, 0)}
+	switch options.Algorithm {
+	case "taat":
+		index.taat(queryTerms, results)
+	case "daat":
+		daat(newCursors(queryTerms), results)
+	case "maxscore", "wand", "bmw":
+		if index.negativeScores {
+			return nil, ErrNegativeScores
+		}
+		switch options.Algorithm {
+		case "maxscore":
+			maxScore(newCursors(queryTerms), results)
+		case "wand":
+			wand(newCursors(queryTerms), results, false)
+		case "bmw":
+			wand(newCursors(queryTerms), results, true)
+		}
+	case "saat":
+		if !index.Impacts() {
+			return nil, ErrNotImpacts
+		}
+		index.saat(queryTerms, results, options.Rho)
+	}
+	return results.sorted(), nil
+}
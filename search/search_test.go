@@ -0,0 +1,120 @@
+package search
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"github.com/Axiomatic314/ciffTools/quantize"
+)
+
+// testIndex returns an index over random postings lists with tfs up to maxTf, scored with scorer or, if
+// it is empty, by the tfs as impacts. Blocks of 8 postings split the longer lists into many blocks for
+// bmw.
+func testIndex(t *testing.T, scorer string, maxTf int32) *Index {
+	t.Helper()
+	header, postingsLists, docRecords := cifftest.Random(1, 20, 500, maxTf)
+	var rankingFunction quantize.Scorer
+	if scorer != "" {
+		var err error
+		stats := quantize.CollectionStats{NumDocs: header.NumDocs, AverageDocLength: header.AverageDoclength, TotalTerms: header.TotalTermsInCollection}
+		rankingFunction, err = quantize.NewScorer(scorer, quantize.DefaultParameters(scorer), stats)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	index, err := NewIndex(header, docRecords, rankingFunction, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, postingsList := range postingsLists {
+		err = index.Add(postingsList)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	return index
+}
+
+func TestAlgorithmsMatchTaat(t *testing.T) {
+	queries := [][]string{
+		{"term000"},
+		{"term001", "term005"},
+		{"term003", "term007", "term012", "term019"},
+		{"term000", "term001", "term002", "term003", "term004", "term005"},
+		{"term002", "term002", "term009"}, // a repeated term
+		{"term004", "missing", "term011"}, // a term not in the index
+		{"missing"},
+		{},
+	}
+	indexes := []struct {
+		name   string
+		scorer string
+		maxTf  int32
+	}{
+		{"atire-bm25", "atire-bm25", 10},
+		{"lucene-bm25", "lucene-bm25", 10},
+		{"ql-jm", "ql-jm", 10},
+		{"4 bit impacts", "", 15},
+		{"8 bit impacts", "", 255},
+	}
+	for _, test := range indexes {
+		index := testIndex(t, test.scorer, test.maxTf)
+		for _, k := range []int{1, 10, 100, 1000} {
+			for _, query := range queries {
+				want, err := index.Search(query, Options{Algorithm: "taat", K: k})
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, algorithm := range Algorithms[1:] {
+					got, err := index.Search(query, Options{Algorithm: algorithm, K: k})
+					if errors.Is(err, ErrNotImpacts) && !index.Impacts() {
+						continue
+					}
+					if err != nil {
+						t.Fatalf("%s, %s, k=%d, %v: %v", test.name, algorithm, k, query, err)
+					}
+					if !slices.Equal(got, want) {
+						t.Errorf("%s, %s, k=%d, %v:\n%v\nwant\n%v", test.name, algorithm, k, query, got, want)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestTaatOrder(t *testing.T) {
+	index := testIndex(t, "", 3)
+	results, err := index.Search([]string{"term000", "term001"}, Options{Algorithm: "taat", K: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 50 {
+		t.Fatalf("%d results, want 50", len(results))
+	}
+	for resultIndex := 1; resultIndex < len(results); resultIndex++ {
+		if !worse(results[resultIndex], results[resultIndex-1]) {
+			t.Errorf("result %d %v does not rank below %v", resultIndex, results[resultIndex], results[resultIndex-1])
+		}
+	}
+}
+
+func TestSearchErrors(t *testing.T) {
+	// rsj-bm25 scores terms in most of the documents negatively
+	index := testIndex(t, "rsj-bm25", 10)
+	for _, algorithm := range []string{"maxscore", "wand", "bmw"} {
+		_, err := index.Search([]string{"term000"}, Options{Algorithm: algorithm, K: 10})
+		if !errors.Is(err, ErrNegativeScores) {
+			t.Errorf("%s: error %v, want ErrNegativeScores", algorithm, err)
+		}
+	}
+	_, err := index.Search([]string{"term000"}, Options{Algorithm: "saat", K: 10})
+	if !errors.Is(err, ErrNotImpacts) {
+		t.Errorf("saat: error %v, want ErrNotImpacts", err)
+	}
+	_, err = index.Search([]string{"term000"}, Options{Algorithm: "bm25", K: 10})
+	if err == nil {
+		t.Error("accepted an unknown algorithm")
+	}
+}
@@ -0,0 +1,80 @@
+package search
+
+import (
+	"cmp"
+	"slices"
+)
+
+// accumulators holds the score of every document for term-at-a-time and score-at-a-time evaluation,
+// with whether any posting of the query matched it.
+type accumulators struct {
+	scores  []float64
+	matched []bool
+}
+
+func (index *Index) newAccumulators() accumulators {
+	return accumulators{scores: make([]float64, index.NumDocs()), matched: make([]bool, index.NumDocs())}
+}
+
+// collect adds every matched document to results in docid order, so ties are broken as in
+// document-at-a-time evaluation.
+func (accumulators accumulators) collect(results *topK) {
+	for docid, matched := range accumulators.matched {
+		if matched {
+			results.insert(int32(docid), accumulators.scores[docid])
+		}
+	}
+}
+
+// taat adds the scores of each postings list in turn to the accumulators.
+func (index *Index) taat(queryTerms []queryTerm, results *topK) {
+	accumulators := index.newAccumulators()
+	for _, queryTerm := range queryTerms {
+		for postingIndex, docid := range queryTerm.list.Docids {
+			accumulators.scores[docid] += float64(queryTerm.list.Scores[postingIndex]) * queryTerm.weight
+			accumulators.matched[docid] = true
+		}
+	}
+	accumulators.collect(results)
+}
+
+// querySegment is a run of postings with the same impact from a postings list of the query.
+type querySegment struct {
+	docids []int32
+	score  float64
+	term   int
+}
+
+// saat processes the postings of the query in decreasing order of their scores, stopping after rho
+// postings if rho is positive. The remaining postings of a segment are finished before stopping.
+func (index *Index) saat(queryTerms []queryTerm, results *topK, rho int64) {
+	segments := make([]querySegment, 0)
+	for term, queryTerm := range queryTerms {
+		for _, segment := range queryTerm.list.segments {
+			segments = append(segments, querySegment{
+				docids: queryTerm.list.impactDocids[segment.start:segment.end],
+				score:  float64(segment.impact) * queryTerm.weight,
+				term:   term,
+			})
+		}
+	}
+	slices.SortFunc(segments, func(a, b querySegment) int {
+		if c := cmp.Compare(b.score, a.score); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.term, b.term)
+	})
+	accumulators := index.newAccumulators()
+	processed := int64(0)
+	for _, segment := range segments {
+		if rho > 0 && processed >= rho {
+			break
+		}
+		for _, docid := range segment.docids {
+			accumulators.scores[docid] += segment.score
+			accumulators.matched[docid] = true
+		}
+		processed += int64(len(segment.docids))
+	}
+	accumulators.collect(results)
+}
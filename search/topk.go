@@ -0,0 +1,87 @@
+package search
+
+import (
+	"container/heap"
+	"math"
+	"slices"
+)
+
+// Result is a document retrieved by a query.
+type Result struct {
+	Docid int32
+	Score float64
+}
+
+// worse orders results by increasing score, then by decreasing docid, so ties rank the smaller docid
+// first.
+func worse(a, b Result) bool {
+	return a.Score < b.Score || a.Score == b.Score && a.Docid > b.Docid
+}
+
+// topK keeps the k best results seen, in a heap with the worst at its root.
+type topK struct {
+	k       int
+	results []Result
+}
+
+func (t *topK) Len() int {
+	return len(t.results)
+}
+
+func (t *topK) Less(i, j int) bool {
+	return worse(t.results[i], t.results[j])
+}
+
+func (t *topK) Swap(i, j int) {
+	t.results[i], t.results[j] = t.results[j], t.results[i]
+}
+
+func (t *topK) Push(x any) {
+	t.results = append(t.results, x.(Result))
+}
+
+func (t *topK) Pop() any {
+	result := t.results[len(t.results)-1]
+	t.results = t.results[:len(t.results)-1]
+	return result
+}
+
+// threshold returns the score a document must exceed to enter the results once they are full. Documents
+// are visited in increasing docid order by the document-at-a-time algorithms, so a document scoring
+// exactly the threshold cannot displace the result it ties with.
+func (t *topK) threshold() float64 {
+	if len(t.results) < t.k {
+		return math.Inf(-1)
+	}
+	return t.results[0].Score
+}
+
+// insert adds the result if it is among the k best, reporting whether it was.
+func (t *topK) insert(docid int32, score float64) bool {
+	result := Result{Docid: docid, Score: score}
+	if len(t.results) < t.k {
+		heap.Push(t, result)
+		return true
+	}
+	if t.k == 0 || !worse(t.results[0], result) {
+		return false
+	}
+	t.results[0] = result
+	heap.Fix(t, 0)
+	return true
+}
+
+// sorted returns the results from best to worst.
+func (t *topK) sorted() []Result {
+	results := slices.Clone(t.results)
+	slices.SortFunc(results, func(a, b Result) int {
+		if worse(a, b) {
+			return 1
+		}
+		if worse(b, a) {
+			return -1
+		}
+		return 0
+	})
+	return results
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/ciffio"
+	"google.golang.org/protobuf/proto"
+)
+
+// DocumentShardStrategies lists the ways documents can be assigned to shards.
+//   - range: contiguous, equally sized docid ranges.
+//   - round-robin: docid modulo the number of shards.
+//   - hash: a hash of the collection docid modulo the number of shards.
+//   - mapping: a file of "docid shard" lines.
+var DocumentShardStrategies = []string{"range", "round-robin", "hash", "mapping"}
+
+// TermShardStrategies lists the ways terms can be assigned to shards.
+//   - term-range: contiguous ranges of the sorted terms, with equal numbers of terms.
+//   - term-hash: a hash of the term modulo the number of shards.
+//   - term-balanced: contiguous ranges of the sorted terms, with roughly equal numbers of postings.
+var TermShardStrategies = []string{"term-range", "term-hash", "term-balanced"}
+
+// CiffSharder splits a CIFF into document-partitioned or term-partitioned shards, depending on whether
+// its strategy is one of DocumentShardStrategies or TermShardStrategies.
+type CiffSharder struct {
+	ciffFilePath        string
+	outputCiffFilePaths []string // one per shard
+	strategy            string
+	mappingFilePath     string
+	globalStats         bool // keep the collection statistics of the input in every shard header
+	workers             int
+}
+
+// readShardMapping reads the shard of every docid from a file of "docid shard" lines.
+func readShardMapping(mappingFilePath string, numDocs int32, shards int) ([]int32, error) {
+	fileHandle, err := os.Open(mappingFilePath)
+	if err != nil {
+		return nil, err
+	}
+	defer fileHandle.Close()
+	mapping := make([]int32, numDocs)
+	for docid := range mapping {
+		mapping[docid] = -1
+	}
+	scanner := bufio.NewScanner(fileHandle)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected \"docid shard\"", mappingFilePath, lineNumber)
+		}
+		docid, err := strconv.ParseInt(fields[0], 10, 32)
+		if err != nil || docid < 0 || docid >= int64(numDocs) {
+			return nil, fmt.Errorf("%s:%d: docid %q is not in [0, %d)", mappingFilePath, lineNumber, fields[0], numDocs)
+		}
+		shard, err := strconv.ParseInt(fields[1], 10, 32)
+		if err != nil || shard < 0 || shard >= int64(shards) {
+			return nil, fmt.Errorf("%s:%d: shard %q is not in [0, %d)", mappingFilePath, lineNumber, fields[1], shards)
+		}
+		mapping[docid] = int32(shard)
+	}
+	if scanner.Err() != nil {
+		return nil, scanner.Err()
+	}
+	if docid := slices.Index(mapping, -1); docid >= 0 {
+		return nil, fmt.Errorf("%s: docid %d is not mapped to a shard", mappingFilePath, docid)
+	}
+	return mapping, nil
+}
+
+func (sharder CiffSharder) Shard() error {
+	if slices.Contains(TermShardStrategies, sharder.strategy) {
+		return sharder.shardTerms()
+	}
+	return sharder.shardDocuments()
+}
+
+// shardDocuments writes shards that each hold the postings and doc records of their documents,
+// renumbered densely in their original order, and the postings lists of the terms that occur in them.
+// The input is read three times: for the doc records, to count the postings lists of each shard for its
+// header, and to write the shards.
+func (sharder CiffSharder) shardDocuments() error {
+	shards := len(sharder.outputCiffFilePaths)
+
+	// --------------------------------------------------------------------------------
+	// First pass: assign each document to a shard
+	slog.Info("assigning documents to shards")
+	ciffReader, err := openCiff(sharder.ciffFilePath, 1)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	header := ciffReader.Header()
+	docShards := make([]int32, header.NumDocs)
+	if sharder.strategy == "mapping" {
+		docShards, err = readShardMapping(sharder.mappingFilePath, header.NumDocs, shards)
+		if err != nil {
+			ciffReader.Close()
+			return err
+		}
+	}
+	docids := make([]int32, header.NumDocs) // the docid of each document within its shard
+	numDocs := make([]int32, shards)
+	totalTerms := make([]int64, shards)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			ciffReader.Close()
+			return err
+		}
+		docid := docRecord.Docid
+		switch sharder.strategy {
+		case "range":
+			docShards[docid] = int32(int64(docid) * int64(shards) / int64(header.NumDocs))
+		case "round-robin":
+			docShards[docid] = docid % int32(shards)
+		case "hash":
+			hash := fnv.New64a()
+			hash.Write([]byte(docRecord.CollectionDocid))
+			docShards[docid] = int32(hash.Sum64() % uint64(shards))
+		}
+		shard := docShards[docid]
+		docids[docid] = numDocs[shard]
+		numDocs[shard]++
+		totalTerms[shard] += int64(docRecord.Doclength)
+	}
+	ciffReader.Close()
+
+	// --------------------------------------------------------------------------------
+	// Second pass: count the postings lists of each shard
+	slog.Info("counting postings lists")
+	workers := max(sharder.workers, 1)
+	ciffReader, err = openCiff(sharder.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	workerCounts := make([][]int32, workers)
+	workerSeen := make([][]bool, workers)
+	for worker := range workers {
+		workerCounts[worker] = make([]int32, shards)
+		workerSeen[worker] = make([]bool, shards)
+	}
+	err = scanPostingsLists(ciffReader, workers, func(worker int, postingsList *ciff.PostingsList) {
+		seen := workerSeen[worker]
+		clear(seen)
+		for _, posting := range postingsList.Postings {
+			shard := docShards[posting.Docid]
+			if !seen[shard] {
+				seen[shard] = true
+				workerCounts[worker][shard]++
+			}
+		}
+	})
+	ciffReader.Close()
+	if err != nil {
+		return err
+	}
+	numPostingsLists := make([]int32, shards)
+	for _, counts := range workerCounts {
+		for shard, count := range counts {
+			numPostingsLists[shard] += count
+		}
+	}
+
+	// --------------------------------------------------------------------------------
+	// Third pass: write the shards
+	slog.Info("writing shards")
+	ciffReader, err = openCiff(sharder.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	ciffWriters := make([]*ciffio.Writer, shards)
+	for shard := range shards {
+		shardHeader := &ciff.Header{
+			Version:                header.Version,
+			NumPostingsLists:       numPostingsLists[shard],
+			NumDocs:                numDocs[shard],
+			TotalPostingsLists:     numPostingsLists[shard],
+			TotalDocs:              numDocs[shard],
+			TotalTermsInCollection: totalTerms[shard],
+			Description:            header.Description,
+		}
+		if numDocs[shard] > 0 {
+			shardHeader.AverageDoclength = float64(totalTerms[shard]) / float64(numDocs[shard])
+		}
+		if sharder.globalStats {
+			shardHeader.TotalPostingsLists = header.TotalPostingsLists
+			shardHeader.TotalDocs = header.TotalDocs
+			shardHeader.TotalTermsInCollection = header.TotalTermsInCollection
+			shardHeader.AverageDoclength = header.AverageDoclength
+		}
+		slog.Info("shard", "shard", shard, "postingsLists", shardHeader.NumPostingsLists, "docs", shardHeader.NumDocs)
+		outputFileHandle, ciffWriter, err := createCiff(sharder.outputCiffFilePaths[shard], shardHeader, max(workers/shards, 1))
+		if err != nil {
+			return fmt.Errorf("creating shard: %w", err)
+		}
+		defer outputFileHandle.Close()
+		ciffWriters[shard] = ciffWriter
+	}
+
+	shardPostings := make([][]*ciff.Posting, shards)
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			return err
+		}
+		for _, posting := range postingsList.Postings {
+			shard := docShards[posting.Docid]
+			posting.Docid = docids[posting.Docid]
+			shardPostings[shard] = append(shardPostings[shard], posting)
+		}
+		for shard, postings := range shardPostings {
+			if len(postings) == 0 {
+				continue
+			}
+			shardPostingsList := &ciff.PostingsList{Term: postingsList.Term, Df: int64(len(postings)), Postings: postings}
+			for _, posting := range postings {
+				shardPostingsList.Cf += int64(posting.Tf)
+			}
+			err = ciffWriters[shard].WritePostingsList(shardPostingsList)
+			if err != nil {
+				return err
+			}
+			// The writer may still hold the postings, so the next list starts a new slice.
+			shardPostings[shard] = nil
+		}
+	}
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			return err
+		}
+		shard := docShards[docRecord.Docid]
+		docRecord.Docid = docids[docRecord.Docid]
+		err = ciffWriters[shard].WriteDocRecord(docRecord)
+		if err != nil {
+			return err
+		}
+	}
+	for _, ciffWriter := range ciffWriters {
+		err = ciffWriter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardTerms writes shards that each hold the postings lists of their terms, unchanged, and every doc
+// record, so docids and document statistics are the same in every shard. The input is read twice: to
+// assign the terms to shards, and to write the shards.
+func (sharder CiffSharder) shardTerms() error {
+	shards := len(sharder.outputCiffFilePaths)
+	workers := max(sharder.workers, 1)
+
+	// --------------------------------------------------------------------------------
+	// First pass: assign each term to a shard
+	slog.Info("assigning terms to shards")
+	ciffReader, err := openCiff(sharder.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	header := ciffReader.Header()
+	termShards := make([]int32, header.NumPostingsLists)
+	volumes := make([]int64, header.NumPostingsLists) // postings in each list, for term-balanced
+	totalVolume := int64(0)
+	postingsListIndex := 0
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			ciffReader.Close()
+			return err
+		}
+		switch sharder.strategy {
+		case "term-range":
+			termShards[postingsListIndex] = int32(int64(postingsListIndex) * int64(shards) / int64(header.NumPostingsLists))
+		case "term-hash":
+			hash := fnv.New64a()
+			hash.Write([]byte(postingsList.Term))
+			termShards[postingsListIndex] = int32(hash.Sum64() % uint64(shards))
+		case "term-balanced":
+			volumes[postingsListIndex] = int64(len(postingsList.Postings))
+			totalVolume += volumes[postingsListIndex]
+		}
+		postingsListIndex++
+	}
+	ciffReader.Close()
+	if sharder.strategy == "term-balanced" {
+		// Each list goes to the shard its midpoint falls in, so no shard is far over its share.
+		cumulativeVolume := int64(0)
+		for postingsListIndex, volume := range volumes {
+			midpoint := cumulativeVolume + volume/2
+			if totalVolume > 0 {
+				termShards[postingsListIndex] = int32(min(midpoint*int64(shards)/totalVolume, int64(shards-1)))
+			}
+			cumulativeVolume += volume
+		}
+	}
+	numPostingsLists := make([]int32, shards)
+	for _, shard := range termShards {
+		numPostingsLists[shard]++
+	}
+
+	// --------------------------------------------------------------------------------
+	// Second pass: write the shards
+	slog.Info("writing shards")
+	ciffReader, err = openCiff(sharder.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	ciffWriters := make([]*ciffio.Writer, shards)
+	for shard := range shards {
+		shardHeader := proto.Clone(header).(*ciff.Header)
+		shardHeader.NumPostingsLists = numPostingsLists[shard]
+		slog.Info("shard", "shard", shard, "postingsLists", shardHeader.NumPostingsLists, "docs", shardHeader.NumDocs)
+		outputFileHandle, ciffWriter, err := createCiff(sharder.outputCiffFilePaths[shard], shardHeader, max(workers/shards, 1))
+		if err != nil {
+			return fmt.Errorf("creating shard: %w", err)
+		}
+		defer outputFileHandle.Close()
+		ciffWriters[shard] = ciffWriter
+	}
+	postingsListIndex = 0
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			return err
+		}
+		err = ciffWriters[termShards[postingsListIndex]].WritePostingsList(postingsList)
+		if err != nil {
+			return err
+		}
+		postingsListIndex++
+	}
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			return err
+		}
+		for _, ciffWriter := range ciffWriters {
+			err = ciffWriter.WriteDocRecord(docRecord)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	for _, ciffWriter := range ciffWriters {
+		err = ciffWriter.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func shardCommand(arguments []string) int {
+	flags := flag.NewFlagSet("shard", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of CIFF file to shard")
+	shards := flags.Int("shards", 2, "Number of shards.")
+	strategy := flags.String("by", "range", fmt.Sprintf("How documents are assigned to shards, one of %v, or terms, one of %v.", DocumentShardStrategies, TermShardStrategies))
+	mappingFilePath := flags.String("mappingFile", "", "filepath of a file of \"docid shard\" lines, for -by mapping.")
+	globalStats := flags.Bool("globalStats", false, "Bool to keep the total docs, total postings lists, total terms and average doc length of the whole collection in every shard header. Scorers then use the collection's doc count, average doc length and total terms, but df and cf stay those of the shard, so scores only match the unsharded index for terms whose postings are all in the shard. Defaults to false. Term shards always keep them.")
+	outputDirectory := flags.String("outputDirectory", "output", "The target output directory. If not already present, it is created relative to the current working directory. Any existing files are overwritten!")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to decode and encode with. The output does not depend on it.")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+	if *shards < 1 {
+		fmt.Println("Please provide at least one shard!")
+		return 1
+	}
+	if !slices.Contains(DocumentShardStrategies, *strategy) && !slices.Contains(TermShardStrategies, *strategy) {
+		fmt.Printf("Unknown strategy %q, expected one of %v or %v!\n", *strategy, DocumentShardStrategies, TermShardStrategies)
+		return 1
+	}
+	if *strategy == "mapping" && *mappingFilePath == "" {
+		fmt.Println("-by mapping requires -mappingFile!")
+		return 1
+	}
+
+	err := os.Mkdir(*outputDirectory, 0777)
+	if err != nil && !os.IsExist(err) {
+		slog.Error("cannot create output directory", "error", err)
+		return 1
+	}
+	_, ciffFile := filepath.Split(*ciffFilePath)
+	sharder := CiffSharder{
+		ciffFilePath:    *ciffFilePath,
+		strategy:        *strategy,
+		mappingFilePath: *mappingFilePath,
+		globalStats:     *globalStats,
+		workers:         *workers,
+	}
+	for shard := range *shards {
+		sharder.outputCiffFilePaths = append(sharder.outputCiffFilePaths, filepath.Join(*outputDirectory, fmt.Sprintf("shard%d-%s", shard, ciffFile)))
+	}
+	err = sharder.Shard()
+	if err != nil {
+		slog.Error("error sharding ciff", "error", err)
+		return 1
+	}
+	slog.Info("complete")
+	return 0
+}
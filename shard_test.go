@@ -0,0 +1,207 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/fnv"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/ciffio"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"github.com/Axiomatic314/ciffTools/quantize"
+	"google.golang.org/protobuf/proto"
+)
+
+// shardTestIndex writes an index to shard and returns its path, with the index itself.
+func shardTestIndex(t *testing.T) (string, *ciff.Header, []*ciff.PostingsList, []*ciff.DocRecord) {
+	t.Helper()
+	header, postingsLists, docRecords := cifftest.Random(1, 100, 200, 10)
+	return writeTestCiff(t, "input.ciff", header, postingsLists, docRecords), header, postingsLists, docRecords
+}
+
+// shardTestCiff shards the CIFF at path into shards CIFFs and returns their paths. The mapping strategy
+// sends docid d to shard 7d mod shards.
+func shardTestCiff(t *testing.T, path string, strategy string, shards int, globalStats bool) []string {
+	t.Helper()
+	directory := t.TempDir()
+	sharder := CiffSharder{ciffFilePath: path, strategy: strategy, globalStats: globalStats, workers: 4}
+	if strategy == "mapping" {
+		header, _, _ := readTestCiff(t, path)
+		var mapping strings.Builder
+		for docid := range header.NumDocs {
+			fmt.Fprintf(&mapping, "%d %d\n", docid, docid*7%int32(shards))
+		}
+		sharder.mappingFilePath = filepath.Join(directory, "mapping.txt")
+		err := os.WriteFile(sharder.mappingFilePath, []byte(mapping.String()), 0666)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for shard := range shards {
+		sharder.outputCiffFilePaths = append(sharder.outputCiffFilePaths, filepath.Join(directory, fmt.Sprintf("shard%d.ciff", shard)))
+	}
+	err := sharder.Shard()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sharder.outputCiffFilePaths
+}
+
+// expectedShard returns the shard strategy assigns a document to, out of shards.
+func expectedShard(strategy string, docRecord *ciff.DocRecord, numDocs int32, shards int) int {
+	switch strategy {
+	case "range":
+		return int(docRecord.Docid) * shards / int(numDocs)
+	case "round-robin":
+		return int(docRecord.Docid) % shards
+	case "hash":
+		hash := fnv.New64a()
+		hash.Write([]byte(docRecord.CollectionDocid))
+		return int(hash.Sum64() % uint64(shards))
+	default:
+		return int(docRecord.Docid) * 7 % shards
+	}
+}
+
+func TestShardDocuments(t *testing.T) {
+	path, header, postingsLists, docRecords := shardTestIndex(t)
+	for _, strategy := range DocumentShardStrategies {
+		t.Run(strategy, func(t *testing.T) {
+			shardPaths := shardTestCiff(t, path, strategy, 3, false)
+			for shard, shardPath := range shardPaths {
+				validateTestCiff(t, shardPath, ciffio.ValidateOptions{})
+				shardHeader, shardPostingsLists, shardDocRecords := readTestCiff(t, shardPath)
+
+				// The shard holds its documents in their original order, with dense docids.
+				var wantDocRecords []*ciff.DocRecord
+				for _, docRecord := range docRecords {
+					if expectedShard(strategy, docRecord, header.NumDocs, 3) == shard {
+						wantDocRecords = append(wantDocRecords, &ciff.DocRecord{Docid: int32(len(wantDocRecords)), CollectionDocid: docRecord.CollectionDocid, Doclength: docRecord.Doclength})
+					}
+				}
+				if !cifftest.EqualDocRecords(shardDocRecords, wantDocRecords) {
+					t.Fatalf("shard %d doc records %v, want %v", shard, shardDocRecords, wantDocRecords)
+				}
+				for _, postingsList := range shardPostingsLists {
+					if len(postingsList.Postings) == 0 {
+						t.Errorf("shard %d holds %q without postings", shard, postingsList.Term)
+					}
+					for _, posting := range postingsList.Postings {
+						if posting.Docid >= shardHeader.NumDocs {
+							t.Fatalf("shard %d: %q has docid %d of %d documents", shard, postingsList.Term, posting.Docid, shardHeader.NumDocs)
+						}
+					}
+				}
+
+				totalTerms := int64(0)
+				for _, docRecord := range shardDocRecords {
+					totalTerms += int64(docRecord.Doclength)
+				}
+				numDocs, numPostingsLists := int32(len(shardDocRecords)), int32(len(shardPostingsLists))
+				if shardHeader.NumDocs != numDocs || shardHeader.TotalDocs != numDocs ||
+					shardHeader.NumPostingsLists != numPostingsLists || shardHeader.TotalPostingsLists != numPostingsLists ||
+					shardHeader.TotalTermsInCollection != totalTerms || shardHeader.AverageDoclength != float64(totalTerms)/float64(numDocs) ||
+					shardHeader.Description != header.Description {
+					t.Errorf("shard %d header %v for %d docs, %d terms and %d total terms", shard, shardHeader, numDocs, numPostingsLists, totalTerms)
+				}
+			}
+
+			// Merging the shards concatenates their docids, so the original docids are found again from the
+			// collection docids.
+			mergedPath := filepath.Join(t.TempDir(), "merged.ciff")
+			err := CiffMerger{ciffFilePaths: shardPaths, outputCiffFilePath: mergedPath, workers: 1}.Merge()
+			if err != nil {
+				t.Fatal(err)
+			}
+			mergedHeader, mergedPostingsLists, mergedDocRecords := readTestCiff(t, mergedPath)
+			originalDocids := make(map[string]int32)
+			for _, docRecord := range docRecords {
+				originalDocids[docRecord.CollectionDocid] = docRecord.Docid
+			}
+			for _, postingsList := range mergedPostingsLists {
+				for _, posting := range postingsList.Postings {
+					posting.Docid = originalDocids[mergedDocRecords[posting.Docid].CollectionDocid]
+				}
+				slices.SortFunc(postingsList.Postings, func(a, b *ciff.Posting) int {
+					return int(a.Docid - b.Docid)
+				})
+			}
+			for _, docRecord := range mergedDocRecords {
+				docRecord.Docid = originalDocids[docRecord.CollectionDocid]
+			}
+			slices.SortFunc(mergedDocRecords, func(a, b *ciff.DocRecord) int {
+				return int(a.Docid - b.Docid)
+			})
+			if !proto.Equal(mergedHeader, header) {
+				t.Errorf("merged header %v, want %v", mergedHeader, header)
+			}
+			if !cifftest.EqualPostingsLists(mergedPostingsLists, postingsLists) {
+				t.Errorf("merged postings lists differ from the input")
+			}
+			if !cifftest.EqualDocRecords(mergedDocRecords, docRecords) {
+				t.Errorf("merged doc records differ from the input")
+			}
+		})
+	}
+}
+
+func TestShardRangeMergesToInput(t *testing.T) {
+	path, _, _, _ := shardTestIndex(t)
+	for _, globalStats := range []bool{false, true} {
+		t.Run(fmt.Sprintf("globalStats=%v", globalStats), func(t *testing.T) {
+			shardPaths := shardTestCiff(t, path, "range", 4, globalStats)
+			mergedPath := filepath.Join(t.TempDir(), "merged.ciff")
+			err := CiffMerger{ciffFilePaths: shardPaths, outputCiffFilePath: mergedPath, workers: 4}.Merge()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(readTestFile(t, mergedPath), readTestFile(t, path)) {
+				t.Errorf("merged shards differ from the input")
+			}
+		})
+	}
+}
+
+// TestShardGlobalStats checks that the scorers of a shard written with -globalStats see the statistics
+// of the whole collection, so its scores only differ from the unsharded index by df and cf.
+func TestShardGlobalStats(t *testing.T) {
+	path, header, postingsLists, docRecords := shardTestIndex(t)
+	parameters := quantize.DefaultParameters("atire-bm25")
+	scorer, err := quantize.NewScorer("atire-bm25", parameters, collectionStats(header))
+	if err != nil {
+		t.Fatal(err)
+	}
+	shardPaths := shardTestCiff(t, path, "round-robin", 2, true)
+	for shard, shardPath := range shardPaths {
+		shardHeader, shardPostingsLists, shardDocRecords := readTestCiff(t, shardPath)
+		if collectionStats(shardHeader) != collectionStats(header) {
+			t.Fatalf("shard %d statistics %v, want %v", shard, collectionStats(shardHeader), collectionStats(header))
+		}
+		shardScorer, err := quantize.NewScorer("atire-bm25", parameters, collectionStats(shardHeader))
+		if err != nil {
+			t.Fatal(err)
+		}
+		originalPostingsLists := make(map[string]*ciff.PostingsList)
+		for _, postingsList := range postingsLists {
+			originalPostingsLists[postingsList.Term] = postingsList
+		}
+		for _, shardPostingsList := range shardPostingsLists {
+			postingsList := originalPostingsLists[shardPostingsList.Term]
+			termWeight := scorer.TermWeight(postingsList.Df, postingsList.Cf)
+			for _, posting := range shardPostingsList.Postings {
+				// round-robin over 2 shards puts shard docid d at docid 2d + shard
+				docid := 2*posting.Docid + int32(shard)
+				want := scorer.Score(posting.Tf, docRecords[docid].Doclength, termWeight)
+				got := shardScorer.Score(posting.Tf, shardDocRecords[posting.Docid].Doclength, shardScorer.TermWeight(postingsList.Df, postingsList.Cf))
+				if got != want {
+					t.Fatalf("shard %d: %q in doc %d scores %v with the collection df, want %v", shard, postingsList.Term, docid, got, want)
+				}
+			}
+		}
+	}
+}
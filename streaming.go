@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/ciffio"
+	"github.com/Axiomatic314/ciffTools/quantize"
+	"google.golang.org/protobuf/proto"
+)
+
+// ciffFile is a Reader over an open CIFF file.
+type ciffFile struct {
+	*ciffio.Reader
+	fileHandle *os.File
+}
+
+func (file ciffFile) Close() error {
+	file.Reader.Close()
+	return file.fileHandle.Close()
+}
+
+// openCiff opens the CIFF at ciffFilePath and reads its header, leaving the reader at the first postings
+// list. With more than one worker, messages are decoded ahead of time by a pipelined reader.
+func openCiff(ciffFilePath string, workers int) (ciffFile, error) {
+	ciffFileHandle, err := os.Open(ciffFilePath)
+	if err != nil {
+		return ciffFile{}, err
+	}
+	var ciffReader *ciffio.Reader
+	if workers > 1 {
+		ciffReader, err = ciffio.NewPipelinedReader(ciffFileHandle, workers)
+	} else {
+		ciffReader, err = ciffio.NewReader(ciffFileHandle)
+	}
+	if err != nil {
+		ciffFileHandle.Close()
+		return ciffFile{}, err
+	}
+	return ciffFile{Reader: ciffReader, fileHandle: ciffFileHandle}, nil
+}
+
+// createCiff creates the CIFF at ciffFilePath and writes its header. With more than one worker, messages
+// are encoded by a pipelined writer.
+func createCiff(ciffFilePath string, header *ciff.Header, workers int) (*os.File, *ciffio.Writer, error) {
+	ciffFileHandle, err := os.Create(ciffFilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	var ciffWriter *ciffio.Writer
+	if workers > 1 {
+		ciffWriter, err = ciffio.NewPipelinedWriter(ciffFileHandle, header, workers)
+	} else {
+		ciffWriter, err = ciffio.NewWriter(ciffFileHandle, header)
+	}
+	if err != nil {
+		ciffFileHandle.Close()
+		return nil, nil, err
+	}
+	return ciffFileHandle, ciffWriter, nil
+}
+
+// scanPostingsLists hands every remaining postings list of ciffReader to f on one of workers goroutines.
+func scanPostingsLists(ciffReader ciffFile, workers int, f func(worker int, postingsList *ciff.PostingsList)) error {
+	postingsListChannel := make(chan *ciff.PostingsList, workers)
+	var wg sync.WaitGroup
+	for worker := range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for postingsList := range postingsListChannel {
+				f(worker, postingsList)
+			}
+		}()
+	}
+	var readErr error
+	for postingsList, err := range ciffReader.PostingsLists() {
+		if err != nil {
+			readErr = err
+			break
+		}
+		postingsListChannel <- postingsList
+	}
+	close(postingsListChannel)
+	wg.Wait()
+	return readErr
+}
+
+type pendingPostingsList struct {
+	postingsList *ciff.PostingsList
+	err          error
+	done         chan struct{}
+}
+
+// mapPostingsLists applies f to every remaining postings list of ciffReader on one of workers goroutines,
+// then hands the results to emit on the calling goroutine in their original order. It returns only once
+// its goroutines have stopped, so ciffReader may be closed straight after, even on an early error.
+func mapPostingsLists(ciffReader ciffFile, workers int, f func(postingsList *ciff.PostingsList), emit func(postingsList *ciff.PostingsList) error) error {
+	jobs := make(chan *pendingPostingsList, workers)
+	ordered := make(chan *pendingPostingsList, workers)
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer func() {
+		close(stop)
+		wg.Wait()
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(ordered)
+		defer close(jobs)
+		for postingsList, err := range ciffReader.PostingsLists() {
+			pending := &pendingPostingsList{postingsList: postingsList, err: err, done: make(chan struct{})}
+			if err != nil {
+				close(pending.done)
+			} else {
+				select {
+				case jobs <- pending:
+				case <-stop:
+					return
+				}
+			}
+			select {
+			case ordered <- pending:
+			case <-stop:
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for pending := range jobs {
+				f(pending.postingsList)
+				close(pending.done)
+			}
+		}()
+	}
+
+	for pending := range ordered {
+		<-pending.done
+		if pending.err != nil {
+			return pending.err
+		}
+		err := emit(pending.postingsList)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// StreamingQuantizer quantizes a CIFF without holding it in memory. Only the doc length table and a
+// few postings lists per worker are resident at any time, at the cost of reading the input three
+// times: the doc lengths come after the postings lists, so they take a pass of their own.
+type StreamingQuantizer struct {
+	ciffFilePath       string
+	outputCiffFilePath string
+	scorerName         string
+	parameters         quantize.Parameters
+	options            quantize.Options
+	provenance         quantize.Provenance // completed with the score range and appended to the header description
+}
+
+func (quantizer StreamingQuantizer) Quantize() error {
+	// --------------------------------------------------------------------------------
+	// First pass: skip over the postings lists to collect the doc lengths
+	slog.Info("collecting doc lengths")
+	ciffReader, err := openCiff(quantizer.ciffFilePath, 1)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	header := ciffReader.Header()
+	docLengths := make([]int32, 0, header.NumDocs)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			ciffReader.Close()
+			return err
+		}
+		docLengths = append(docLengths, docRecord.Doclength)
+	}
+	ciffReader.Close()
+	scorer, err := quantize.NewScorer(quantizer.scorerName, quantizer.parameters, collectionStats(header))
+	if err != nil {
+		return err
+	}
+	indexQuantizer, err := quantize.NewQuantizer(scorer, quantizer.options)
+	if err != nil {
+		return err
+	}
+
+	// --------------------------------------------------------------------------------
+	// Second pass: score every posting to find the smallest and largest impacts
+	slog.Info("finding score range")
+	workers := max(quantizer.options.Workers, 1)
+	ciffReader, err = openCiff(quantizer.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	forks := make([]*quantize.Quantizer, workers)
+	for worker := range forks {
+		forks[worker] = indexQuantizer.Fork()
+	}
+	err = scanPostingsLists(ciffReader, workers, func(worker int, postingsList *ciff.PostingsList) {
+		forks[worker].FindScoreRange(postingsList, docLengths)
+	})
+	ciffReader.Close()
+	if err != nil {
+		return err
+	}
+	for _, fork := range forks {
+		indexQuantizer.Merge(fork)
+	}
+	slog.Info("score range", "min", indexQuantizer.Range().Min, "max", indexQuantizer.Range().Max)
+	indexQuantizer.Fit()
+
+	// --------------------------------------------------------------------------------
+	// Third pass: rescale each postings list and write it out immediately
+	slog.Info("writing quantized ciff")
+	ciffReader, err = openCiff(quantizer.ciffFilePath, workers)
+	if err != nil {
+		return fmt.Errorf("opening ciff: %w", err)
+	}
+	defer ciffReader.Close()
+	provenance := quantizer.provenance
+	provenance.ScoreRange = indexQuantizer.Range()
+	provenance.Points = indexQuantizer.Points()
+	outputHeader := proto.Clone(header).(*ciff.Header)
+	outputHeader.Description, err = provenance.AppendTo(header.Description)
+	if err != nil {
+		return err
+	}
+	outputFileHandle, ciffWriter, err := createCiff(quantizer.outputCiffFilePath, outputHeader, workers)
+	if err != nil {
+		return fmt.Errorf("creating output ciff: %w", err)
+	}
+	defer outputFileHandle.Close()
+
+	n := max(header.NumPostingsLists/10, 1)
+	postingsListIndex := int32(0)
+	err = mapPostingsLists(ciffReader, workers, func(postingsList *ciff.PostingsList) {
+		indexQuantizer.QuantizePostingsList(postingsList, docLengths)
+	}, func(postingsList *ciff.PostingsList) error {
+		if postingsListIndex%n == 0 {
+			slog.Info(fmt.Sprintf("postings list %d/%d", postingsListIndex, header.NumPostingsLists))
+		}
+		postingsListIndex++
+		return ciffWriter.WritePostingsList(postingsList)
+	})
+	if err != nil {
+		return err
+	}
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			return err
+		}
+		err = ciffWriter.WriteDocRecord(docRecord)
+		if err != nil {
+			return err
+		}
+	}
+	return ciffWriter.Close()
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"github.com/Axiomatic314/ciffTools/quantize"
+)
+
+func TestStreamingMatchesInMemory(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 200, 300, 20)
+	inputPath := writeTestCiff(t, "input.ciff", header, postingsLists, docRecords)
+	sourceSHA256, err := hashFile(inputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parameters := quantize.DefaultParameters("atire-bm25")
+	for _, scheme := range []string{"uniform", "log", "quantile", "local"} {
+		for _, workers := range []int{1, 2, 4} {
+			t.Run(fmt.Sprintf("%s %d workers", scheme, workers), func(t *testing.T) {
+				options := quantize.Options{Bits: 8, Scheme: scheme, Workers: workers}
+				provenance := quantize.Provenance{
+					Scorer:       "atire-bm25",
+					Parameters:   parameters,
+					Bits:         options.Bits,
+					Scheme:       options.Scheme,
+					ToolVersion:  toolVersion(),
+					Source:       "input.ciff",
+					SourceSHA256: sourceSHA256,
+				}
+				directory := t.TempDir()
+
+				inMemoryPath := filepath.Join(directory, "in-memory.ciff")
+				header, postingsLists, docRecords := readTestCiff(t, inputPath)
+				inMemoryProvenance := provenance
+				err := quantizeIndex(header, postingsLists, docRecords, "atire-bm25", parameters, options, &inMemoryProvenance)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = CiffWriter{writeCiff: true, ciffFilePath: inMemoryPath, workers: workers, provenance: &inMemoryProvenance}.WriteCiff(header, postingsLists, docRecords)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				streamingPath := filepath.Join(directory, "streaming.ciff")
+				streamingQuantizer := StreamingQuantizer{
+					ciffFilePath:       inputPath,
+					outputCiffFilePath: streamingPath,
+					scorerName:         "atire-bm25",
+					parameters:         parameters,
+					options:            options,
+					provenance:         provenance,
+				}
+				err = streamingQuantizer.Quantize()
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if !bytes.Equal(readTestFile(t, streamingPath), readTestFile(t, inMemoryPath)) {
+					streamingHeader, _, _ := readTestCiff(t, streamingPath)
+					inMemoryHeader, _, _ := readTestCiff(t, inMemoryPath)
+					t.Errorf("streaming CIFF differs from the in-memory one, descriptions:\n%s\nand\n%s", streamingHeader.Description, inMemoryHeader.Description)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"maps"
+	"os"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Axiomatic314/ciffTools/analysis"
+	"github.com/Axiomatic314/ciffTools/ciff"
+	"github.com/Axiomatic314/ciffTools/quantize"
+	"github.com/Axiomatic314/ciffTools/search"
+	"github.com/Axiomatic314/ciffTools/trec"
+)
+
+// sweepScorers lists the scorers that take the k1 and b parameters a sweep varies.
+var sweepScorers = []string{"atire-bm25", "lucene-bm25", "rsj-bm25", "bm25+", "bm25l"}
+
+// CiffSweeper grid searches the k1 and b parameters of a BM25 variant and the bit width of the impacts
+// for the most effective quantization of a CIFF, without writing any quantized index. A single pass over
+// the postings lists finds the score range of every (k1, b) pair and keeps the postings lists of the
+// query terms, which are all that is quantized and searched for each configuration. Only the doc
+// records and those postings lists are held in memory, along with, for the quantile and lloyd-max
+// schemes, one sample of up to 2^20 scores per (k1, b) pair that every bit width is fitted to.
+type CiffSweeper struct {
+	ciffFilePath  string
+	qrels         trec.Qrels
+	topics        []trec.Topic
+	fields        []string
+	analyzerSpec  string
+	scorerName    string
+	k1s, bs       []float64
+	bits          []int32 // 0 searches the exact scores, unquantized
+	options       quantize.Options
+	searchOptions search.Options
+	blockSize     int
+	cutoffs       []int
+}
+
+// sweepResult is the effectiveness of one configuration of a sweep.
+type sweepResult struct {
+	k1, b      float64
+	bits       int32
+	evaluation trec.Evaluation
+}
+
+// sweepParameters is a (k1, b) pair of a sweep with its scorer and a quantizer for every bit width.
+type sweepParameters struct {
+	k1, b      float64
+	scorer     quantize.Scorer
+	quantizers []*quantize.Quantizer // by bit width, nil for exact scores
+	observer   *quantize.Quantizer   // the first of quantizers, which sees the scores the others share
+	mutex      sync.Mutex            // guards observer
+}
+
+func (sweeper CiffSweeper) Sweep() ([]sweepResult, error) {
+	// --------------------------------------------------------------------------------
+	// First pass: skip over the postings lists to collect the doc records
+	slog.Info("reading doc records")
+	ciffReader, err := openCiff(sweeper.ciffFilePath, 1)
+	if err != nil {
+		return nil, fmt.Errorf("opening ciff: %w", err)
+	}
+	header := ciffReader.Header()
+	docRecords := make([]*ciff.DocRecord, 0, header.NumDocs)
+	for docRecord, err := range ciffReader.DocRecords() {
+		if err != nil {
+			ciffReader.Close()
+			return nil, err
+		}
+		docRecords = append(docRecords, docRecord)
+	}
+	ciffReader.Close()
+	if _, err := quantize.ParseProvenance(header.Description); err == nil {
+		return nil, fmt.Errorf("the ciff is already quantized, sweep the ciff it was quantized from")
+	}
+	docLengths := quantize.DocLengths(docRecords)
+
+	analyzer, err := queryAnalyzer(sweeper.analyzerSpec, header)
+	if err != nil {
+		return nil, err
+	}
+	queries := make(map[string][]string, len(sweeper.topics))
+	queryTerms := make(map[string]bool)
+	for _, topic := range sweeper.topics {
+		text, err := topic.Query(sweeper.fields)
+		if err != nil {
+			return nil, fmt.Errorf("topic %s: %w", topic.ID, err)
+		}
+		queries[topic.ID] = analyzer.Analyze(text)
+		for _, term := range queries[topic.ID] {
+			queryTerms[term] = true
+		}
+	}
+
+	grid, err := sweeper.parameters(header)
+	if err != nil {
+		return nil, err
+	}
+
+	// --------------------------------------------------------------------------------
+	// Second pass: score every posting with every (k1, b) pair to find their score ranges, keeping the
+	// postings lists of the query terms
+	slog.Info("finding score ranges", "parameters", len(grid))
+	workers := max(sweeper.options.Workers, 1)
+	ciffReader, err = openCiff(sweeper.ciffFilePath, workers)
+	if err != nil {
+		return nil, fmt.Errorf("opening ciff: %w", err)
+	}
+	// Each postings list is observed by a fork that is merged straight back, so that no worker holds a
+	// sample of its own
+	queryLists := make([][]*ciff.PostingsList, workers)
+	err = scanPostingsLists(ciffReader, workers, func(worker int, postingsList *ciff.PostingsList) {
+		for _, parameters := range grid {
+			if parameters.observer == nil {
+				continue
+			}
+			fork := parameters.observer.Fork()
+			fork.FindScoreRange(postingsList, docLengths)
+			parameters.mutex.Lock()
+			parameters.observer.Merge(fork)
+			parameters.mutex.Unlock()
+		}
+		if queryTerms[postingsList.Term] {
+			queryLists[worker] = append(queryLists[worker], postingsList)
+		}
+	})
+	ciffReader.Close()
+	if err != nil {
+		return nil, err
+	}
+	postingsLists := slices.Concat(queryLists...)
+	slices.SortFunc(postingsLists, func(a, b *ciff.PostingsList) int {
+		return strings.Compare(a.Term, b.Term)
+	})
+	for _, parameters := range grid {
+		for _, quantizer := range parameters.quantizers {
+			if quantizer == nil {
+				continue
+			}
+			if quantizer != parameters.observer {
+				quantizer.ShareScores(parameters.observer)
+			}
+			quantizer.Fit()
+		}
+	}
+
+	// --------------------------------------------------------------------------------
+	// Quantize the postings lists of the query terms for every configuration, then search and evaluate
+	results := make([]sweepResult, 0, len(grid)*len(sweeper.bits))
+	for _, parameters := range grid {
+		for bitsIndex, bits := range sweeper.bits {
+			quantizer := parameters.quantizers[bitsIndex]
+			var scorer quantize.Scorer
+			if quantizer == nil {
+				scorer = parameters.scorer
+			}
+			index, err := search.NewIndex(header, docRecords, scorer, sweeper.blockSize)
+			if err != nil {
+				return nil, err
+			}
+			for _, postingsList := range postingsLists {
+				if quantizer != nil {
+					postingsList = quantizedCopy(quantizer, postingsList, docLengths)
+				}
+				err := index.Add(postingsList)
+				if err != nil {
+					return nil, err
+				}
+			}
+			run := make(trec.Run, len(queries))
+			for _, topic := range sweeper.topics {
+				topicResults, err := index.Search(queries[topic.ID], sweeper.searchOptions)
+				if err != nil {
+					return nil, err
+				}
+				run[topic.ID] = runResults(index, topicResults)
+			}
+			results = append(results, sweepResult{
+				k1:         parameters.k1,
+				b:          parameters.b,
+				bits:       bits,
+				evaluation: trec.Evaluate(run, sweeper.qrels, sweeper.cutoffs, false),
+			})
+			slog.Info("configuration evaluated", "k1", parameters.k1, "b", parameters.b, "bits", bits)
+		}
+	}
+	return results, nil
+}
+
+// parameters returns a scorer for every (k1, b) pair of the sweep, with a quantizer for every bit width.
+func (sweeper CiffSweeper) parameters(header *ciff.Header) ([]*sweepParameters, error) {
+	grid := make([]*sweepParameters, 0, len(sweeper.k1s)*len(sweeper.bs))
+	for _, k1 := range sweeper.k1s {
+		for _, b := range sweeper.bs {
+			parameters := quantize.DefaultParameters(sweeper.scorerName)
+			parameters.K1, parameters.B = k1, b
+			scorer, err := quantize.NewScorer(sweeper.scorerName, parameters, collectionStats(header))
+			if err != nil {
+				return nil, err
+			}
+			pair := &sweepParameters{k1: k1, b: b, scorer: scorer, quantizers: make([]*quantize.Quantizer, len(sweeper.bits))}
+			for bitsIndex, bits := range sweeper.bits {
+				if bits == 0 {
+					continue
+				}
+				options := sweeper.options
+				options.Bits = bits
+				pair.quantizers[bitsIndex], err = quantize.NewQuantizer(scorer, options)
+				if err != nil {
+					return nil, err
+				}
+				if pair.observer == nil {
+					pair.observer = pair.quantizers[bitsIndex]
+				}
+			}
+			grid = append(grid, pair)
+		}
+	}
+	return grid, nil
+}
+
+// quantizedCopy returns a copy of postingsList with its tfs replaced by the impacts of quantizer.
+func quantizedCopy(quantizer *quantize.Quantizer, postingsList *ciff.PostingsList, docLengths []int32) *ciff.PostingsList {
+	postings := make([]*ciff.Posting, len(postingsList.Postings))
+	for postingIndex, posting := range postingsList.Postings {
+		postings[postingIndex] = &ciff.Posting{Docid: posting.Docid, Tf: posting.Tf}
+	}
+	quantizedList := &ciff.PostingsList{Term: postingsList.Term, Df: postingsList.Df, Cf: postingsList.Cf, Postings: postings}
+	quantizer.QuantizePostingsList(quantizedList, docLengths)
+	return quantizedList
+}
+
+// parseFloats parses a comma separated list of numbers.
+func parseFloats(list string) ([]float64, error) {
+	values := make([]float64, 0)
+	for _, field := range strings.Split(list, ",") {
+		value, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", field)
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// parseBits parses a comma separated list of bit widths, where 0 stands for the exact scores.
+func parseBits(list string) ([]int32, error) {
+	bits := make([]int32, 0)
+	for _, field := range strings.Split(list, ",") {
+		width, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil || width < 0 || width > quantize.MaxBits {
+			return nil, fmt.Errorf("invalid bit width %q, expected 0 to %d", field, quantize.MaxBits)
+		}
+		bits = append(bits, int32(width))
+	}
+	return bits, nil
+}
+
+func sweepCommand(arguments []string) int {
+	flags := flag.NewFlagSet("sweep", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of CIFF file to sweep the quantization of")
+	qrelsFilePath := flags.String("qrels", "", "filepath of the TREC qrels to evaluate against.")
+	topicsFilePath := flags.String("topics", "", "filepath of the topics to search for.")
+	topicFormat := flags.String("topicFormat", "trec", fmt.Sprintf("Format of the topics, one of %v.", trec.TopicFormats))
+	topicFields := flags.String("topicFields", "title", fmt.Sprintf("Comma separated fields of each topic that make its query, from %v.", trec.TopicFields))
+	analyzerSpec := flags.String("analyzer", "", fmt.Sprintf("Comma separated filters applied to each query token, from %v, or a preset from %v. Defaults to the analyzer recorded in the ciff.", analysis.FilterNames, slices.Sorted(maps.Keys(analysis.Presets))))
+	scorerName := flags.String("scorer", "atire-bm25", fmt.Sprintf("Ranking function used to quantize, one of %v.", sweepScorers))
+	k1List := flags.String("k1", "0.5,0.9,1.2,1.5,2", "Comma separated k1 values for BM25.")
+	bList := flags.String("b", "0.3,0.4,0.5,0.75,0.9", "Comma separated b values for BM25.")
+	bitsList := flags.String("bits", "8", fmt.Sprintf("Comma separated widths of the quantized impacts, from 1 to %d bits, or 0 for the exact scores.", quantize.MaxBits))
+	scheme := flags.String("scheme", "uniform", fmt.Sprintf("Quantization scheme, one of %v.", quantize.SchemeNames))
+	zeroImpact := flags.Bool("zeroImpact", false, "Bool to allow an impact of zero, so the lowest score maps to 0 instead of 1. Defaults to false.")
+	algorithm := flags.String("algorithm", "daat", fmt.Sprintf("Query evaluation algorithm, one of %v.", search.Algorithms))
+	k := flags.Int("k", 1000, "Number of results per query.")
+	blockSize := flags.Int("blockSize", search.DefaultBlockSize, "Number of postings per block of the block-max scores.")
+	cutoffList := flags.String("cutoffs", "10,100,1000", "Comma separated ranks to compute nDCG, precision, recall and judged at.")
+	measure := flags.String("measure", "map", "Measure that chooses the best configuration.")
+	workers := flags.Int("workers", runtime.NumCPU(), "Number of goroutines to decode and score with. The results do not depend on it.")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+	if *qrelsFilePath == "" || *topicsFilePath == "" {
+		fmt.Println("Please provide qrels and topics!")
+		return 1
+	}
+	if !slices.Contains(search.Algorithms, *algorithm) {
+		fmt.Printf("Unknown algorithm %q, expected one of %v!\n", *algorithm, search.Algorithms)
+		return 1
+	}
+	if !slices.Contains(sweepScorers, *scorerName) {
+		fmt.Printf("The %s scorer takes no k1 or b to sweep, expected one of %v!\n", *scorerName, sweepScorers)
+		return 1
+	}
+	k1s, err := parseFloats(*k1List)
+	if err != nil {
+		slog.Error("error parsing k1", "error", err)
+		return 1
+	}
+	bs, err := parseFloats(*bList)
+	if err != nil {
+		slog.Error("error parsing b", "error", err)
+		return 1
+	}
+	bits, err := parseBits(*bitsList)
+	if err != nil {
+		slog.Error("error parsing bits", "error", err)
+		return 1
+	}
+	cutoffs, err := parseCutoffs(*cutoffList)
+	if err != nil {
+		slog.Error("error parsing cutoffs", "error", err)
+		return 1
+	}
+	measures := trec.MeasureNames(cutoffs)
+	if !slices.Contains(measures, *measure) {
+		fmt.Printf("Unknown measure %q, expected one of %v!\n", *measure, measures)
+		return 1
+	}
+
+	qrelsFileHandle, err := os.Open(*qrelsFilePath)
+	if err != nil {
+		slog.Error("error opening qrels", "error", err)
+		return 1
+	}
+	qrels, err := trec.ReadQrels(qrelsFileHandle)
+	qrelsFileHandle.Close()
+	if err != nil {
+		slog.Error("error reading qrels", "error", err)
+		return 1
+	}
+	topics, err := readSearchTopics("", *topicsFilePath, *topicFormat)
+	if err != nil {
+		slog.Error("error reading topics", "error", err)
+		return 1
+	}
+
+	sweeper := CiffSweeper{
+		ciffFilePath:  *ciffFilePath,
+		qrels:         qrels,
+		topics:        topics,
+		fields:        strings.Split(*topicFields, ","),
+		analyzerSpec:  *analyzerSpec,
+		scorerName:    *scorerName,
+		k1s:           k1s,
+		bs:            bs,
+		bits:          bits,
+		options:       quantize.Options{ZeroImpact: *zeroImpact, Scheme: *scheme, Workers: *workers},
+		searchOptions: search.Options{Algorithm: *algorithm, K: *k},
+		blockSize:     *blockSize,
+		cutoffs:       cutoffs,
+	}
+	results, err := sweeper.Sweep()
+	if err != nil {
+		slog.Error("error sweeping ciff", "error", err)
+		return 1
+	}
+
+	fmt.Printf("k1\tb\tbits\t%s\n", strings.Join(measures, "\t"))
+	best := 0
+	for resultIndex, result := range results {
+		bitsLabel := strconv.Itoa(int(result.bits))
+		if result.bits == 0 {
+			bitsLabel = "exact"
+		}
+		fmt.Printf("%g\t%g\t%s", result.k1, result.b, bitsLabel)
+		for _, measure := range measures {
+			fmt.Printf("\t%.4f", result.evaluation.Mean(measure))
+		}
+		fmt.Println()
+		if result.evaluation.Mean(*measure) > results[best].evaluation.Mean(*measure) {
+			best = resultIndex
+		}
+	}
+	slog.Info("best configuration", "measure", *measure, "value", fmt.Sprintf("%.4f", results[best].evaluation.Mean(*measure)), "k1", results[best].k1, "b", results[best].b, "bits", results[best].bits, "queries", len(results[best].evaluation.Queries))
+	return 0
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/Axiomatic314/ciffTools/analysis"
+	"github.com/Axiomatic314/ciffTools/internal/cifftest"
+	"github.com/Axiomatic314/ciffTools/quantize"
+	"github.com/Axiomatic314/ciffTools/search"
+	"github.com/Axiomatic314/ciffTools/trec"
+)
+
+func TestParseBits(t *testing.T) {
+	tests := []struct {
+		list  string
+		bits  []int32
+		valid bool
+	}{
+		{"8", []int32{8}, true},
+		{"0, 4,8", []int32{0, 4, 8}, true},
+		{"1,31", []int32{1, 31}, true},
+		{"32", nil, false},
+		{"8,-1", nil, false},
+		{"8,", nil, false},
+		{"eight", nil, false},
+	}
+	for _, test := range tests {
+		bits, err := parseBits(test.list)
+		if (err == nil) != test.valid {
+			t.Errorf("parseBits(%q) error = %v, want valid %v", test.list, err, test.valid)
+			continue
+		}
+		if test.valid && !slices.Equal(bits, test.bits) {
+			t.Errorf("parseBits(%q) = %v, want %v", test.list, bits, test.bits)
+		}
+	}
+}
+
+// sweepReference evaluates the search command's run over the CIFF at path, loaded with options, for the
+// topics of sweeper.
+func sweepReference(t *testing.T, sweeper CiffSweeper, path string, options searchIndexOptions) trec.Evaluation {
+	t.Helper()
+	index, err := loadSearchIndex(path, options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	analyzer, err := analysis.New(sweeper.analyzerSpec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := searchRun(index, analyzer, sweeper.topics, sweeper.fields, sweeper.searchOptions)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return trec.Evaluate(run, sweeper.qrels, sweeper.cutoffs, false)
+}
+
+// TestSweepMatchesSearch checks every configuration of a sweep evaluates as searching the CIFF does,
+// quantized by the quantize command at the same k1, b and bit width, or unquantized for the exact scores.
+func TestSweepMatchesSearch(t *testing.T) {
+	header, postingsLists, docRecords := cifftest.Random(1, 40, 300, 10)
+	inputPath := writeTestCiff(t, "input.ciff", header, postingsLists, docRecords)
+	topics := []trec.Topic{
+		{ID: "1", Title: "term000 term003"},
+		{ID: "2", Title: "term005 term011 term019"},
+		{ID: "3", Title: "term007"},
+		{ID: "4", Title: "term002 term013 term024 term035"},
+	}
+	qrels := make(trec.Qrels)
+	for topicIndex, topic := range topics {
+		qrels[topic.ID] = make(map[string]int)
+		for docid := topicIndex; docid < int(header.NumDocs); docid += 7 {
+			qrels[topic.ID][fmt.Sprintf("doc-%d", docid)] = 1 + docid%2
+		}
+	}
+	for _, scheme := range []string{"uniform", "quantile"} {
+		t.Run(scheme, func(t *testing.T) {
+			sweeper := CiffSweeper{
+				ciffFilePath:  inputPath,
+				qrels:         qrels,
+				topics:        topics,
+				fields:        []string{"title"},
+				analyzerSpec:  "lowercase",
+				scorerName:    "atire-bm25",
+				k1s:           []float64{0.9, 1.5},
+				bs:            []float64{0.4, 0.75},
+				bits:          []int32{0, 4, 8},
+				options:       quantize.Options{Scheme: scheme, Workers: 3},
+				searchOptions: search.Options{Algorithm: "daat", K: 100},
+				blockSize:     16,
+				cutoffs:       []int{10, 100},
+			}
+			results, err := sweeper.Sweep()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(results) != len(sweeper.k1s)*len(sweeper.bs)*len(sweeper.bits) {
+				t.Fatalf("%d results for %d configurations", len(results), len(sweeper.k1s)*len(sweeper.bs)*len(sweeper.bits))
+			}
+			for _, result := range results {
+				parameters := quantize.DefaultParameters(sweeper.scorerName)
+				parameters.K1, parameters.B = result.k1, result.b
+				searchOptions := searchIndexOptions{scorerName: sweeper.scorerName, parameters: parameters, blockSize: sweeper.blockSize, workers: 1}
+				path := inputPath
+				if result.bits > 0 {
+					header, postingsLists, docRecords := readTestCiff(t, inputPath)
+					options := sweeper.options
+					options.Bits = result.bits
+					provenance := &quantize.Provenance{Scorer: sweeper.scorerName, Parameters: parameters, Bits: options.Bits, Scheme: options.Scheme, Source: "input.ciff"}
+					err = quantizeIndex(header, postingsLists, docRecords, sweeper.scorerName, parameters, options, provenance)
+					if err != nil {
+						t.Fatal(err)
+					}
+					path = filepath.Join(t.TempDir(), "quantized.ciff")
+					err = CiffWriter{writeCiff: true, ciffFilePath: path, workers: 1, provenance: provenance}.WriteCiff(header, postingsLists, docRecords)
+					if err != nil {
+						t.Fatal(err)
+					}
+				}
+				want := sweepReference(t, sweeper, path, searchOptions)
+				if want.Mean("map") == 0 {
+					t.Fatalf("k1=%g b=%g bits=%d: the reference run finds nothing relevant", result.k1, result.b, result.bits)
+				}
+				if !reflect.DeepEqual(result.evaluation, want) {
+					t.Errorf("k1=%g b=%g bits=%d: sweep evaluates to %v, search to %v", result.k1, result.b, result.bits, result.evaluation.Values, want.Values)
+				}
+			}
+		})
+	}
+}
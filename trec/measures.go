@@ -0,0 +1,118 @@
+package trec
+
+import (
+	"cmp"
+	"fmt"
+	"maps"
+	"math"
+	"slices"
+)
+
+// MeasureNames returns the names of the measures computed by Evaluate for cutoffs, in the order they are
+// reported: MAP and MRR@10, then nDCG, precision, recall and the fraction of judged documents at each
+// cutoff.
+func MeasureNames(cutoffs []int) []string {
+	names := []string{"map", "mrr@10"}
+	for _, prefix := range []string{"ndcg", "p", "recall", "judged"} {
+		for _, cutoff := range cutoffs {
+			names = append(names, fmt.Sprintf("%s@%d", prefix, cutoff))
+		}
+	}
+	return names
+}
+
+// Evaluation holds the value of every measure for every evaluated query.
+type Evaluation struct {
+	Measures []string
+	Queries  []string // sorted query ids
+	Values   map[string]map[string]float64
+}
+
+// Mean returns the mean of measure over the evaluated queries.
+func (evaluation Evaluation) Mean(measure string) float64 {
+	if len(evaluation.Queries) == 0 {
+		return 0
+	}
+	sum := 0.0
+	for _, query := range evaluation.Queries {
+		sum += evaluation.Values[query][measure]
+	}
+	return sum / float64(len(evaluation.Queries))
+}
+
+// rankRun orders the results of a query as trec_eval does, by decreasing score and then by decreasing
+// docno, ignoring the order of the run.
+func rankRun(results []RunResult) []RunResult {
+	ranked := slices.Clone(results)
+	slices.SortStableFunc(ranked, func(a, b RunResult) int {
+		if c := cmp.Compare(b.Score, a.Score); c != 0 {
+			return c
+		}
+		return cmp.Compare(b.Docno, a.Docno)
+	})
+	return ranked
+}
+
+// Evaluate computes the measures of MeasureNames(cutoffs) for each query of qrels with a relevant
+// document, counting documents with a relevance above zero as relevant. Queries the run has no results
+// for are skipped, as by trec_eval, unless complete is set, when they score zero. Gains for nDCG are the
+// relevance labels.
+func Evaluate(run Run, qrels Qrels, cutoffs []int, complete bool) Evaluation {
+	evaluation := Evaluation{Measures: MeasureNames(cutoffs), Values: make(map[string]map[string]float64)}
+	for _, query := range slices.Sorted(maps.Keys(qrels)) {
+		judgments := qrels[query]
+		gains := make([]int, 0)
+		for _, relevance := range judgments {
+			if relevance > 0 {
+				gains = append(gains, relevance)
+			}
+		}
+		results, retrieved := run[query]
+		if len(gains) == 0 || !retrieved && !complete {
+			continue
+		}
+		slices.SortFunc(gains, func(a, b int) int {
+			return cmp.Compare(b, a)
+		})
+		ranked := rankRun(results)
+
+		values := make(map[string]float64)
+		relevantRetrieved, precisionSum := 0, 0.0
+		for rank, result := range ranked {
+			if judgments[result.Docno] > 0 {
+				relevantRetrieved++
+				precisionSum += float64(relevantRetrieved) / float64(rank+1)
+				if values["mrr@10"] == 0 && rank < 10 {
+					values["mrr@10"] = 1 / float64(rank+1)
+				}
+			}
+		}
+		values["map"] = precisionSum / float64(len(gains))
+		for _, cutoff := range cutoffs {
+			top := ranked[:min(cutoff, len(ranked))]
+			dcg, idealDCG, relevant, judged := 0.0, 0.0, 0, 0
+			for rank, result := range top {
+				relevance, isJudged := judgments[result.Docno]
+				if relevance > 0 {
+					dcg += float64(relevance) / math.Log2(float64(rank+2))
+					relevant++
+				}
+				if isJudged {
+					judged++
+				}
+			}
+			for rank, gain := range gains[:min(cutoff, len(gains))] {
+				idealDCG += float64(gain) / math.Log2(float64(rank+2))
+			}
+			values[fmt.Sprintf("ndcg@%d", cutoff)] = dcg / idealDCG
+			values[fmt.Sprintf("p@%d", cutoff)] = float64(relevant) / float64(cutoff)
+			values[fmt.Sprintf("recall@%d", cutoff)] = float64(relevant) / float64(len(gains))
+			if len(top) > 0 {
+				values[fmt.Sprintf("judged@%d", cutoff)] = float64(judged) / float64(len(top))
+			}
+		}
+		evaluation.Queries = append(evaluation.Queries, query)
+		evaluation.Values[query] = values
+	}
+	return evaluation
+}
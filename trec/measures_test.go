@@ -0,0 +1,107 @@
+package trec
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+const testQrels = `q1 0 d1 2
+q1 0 d2 1
+q1 0 d3 0
+q1 0 d4 1
+q1 0 d9 3
+q2 0 d1 1
+q2 0 d2 0
+q3 0 d1 0
+q4 0 d1 1
+`
+
+// testRun lists the results of q1 out of order, with a tie between d2 and d5 that trec_eval breaks by
+// decreasing docno, ranking them d3, d1, d5, d2, d4.
+const testRun = `q1 Q0 d1 1 9 run
+q1 Q0 d4 2 5 run
+q1 Q0 d2 3 8 run
+q1 Q0 d3 4 10 run
+q1 Q0 d5 5 8 run
+q2 Q0 d1 1 1 run
+q3 Q0 d1 1 1 run
+`
+
+func TestEvaluate(t *testing.T) {
+	qrels, err := ReadQrels(strings.NewReader(testQrels))
+	if err != nil {
+		t.Fatal(err)
+	}
+	run, err := ReadRun(strings.NewReader(testRun))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// q1 retrieves 3 of its 4 relevant documents, at ranks 2, 4 and 5, with gains 2, 1 and 1 against
+	// ideal gains 3, 2, 1 and 1, for an nDCG of 0.4005.
+	dcg := 2/math.Log2(3) + 1/math.Log2(5) + 1/math.Log2(6)
+	idealDCG := 3 + 2/math.Log2(3) + 1/math.Log2(4) + 1/math.Log2(5)
+	expected := map[string]map[string]float64{
+		"q1": {
+			"map":       (1.0/2 + 2.0/4 + 3.0/5) / 4,
+			"mrr@10":    0.5,
+			"ndcg@5":    dcg / idealDCG,
+			"ndcg@10":   dcg / idealDCG,
+			"p@5":       0.6,
+			"p@10":      0.3,
+			"recall@5":  0.75,
+			"recall@10": 0.75,
+			"judged@5":  0.8,
+			"judged@10": 0.8,
+		},
+		"q2": {
+			"map": 1, "mrr@10": 1, "ndcg@5": 1, "ndcg@10": 1, "p@5": 0.2, "p@10": 0.1,
+			"recall@5": 1, "recall@10": 1, "judged@5": 1, "judged@10": 1,
+		},
+		"q4": {
+			"map": 0, "mrr@10": 0, "ndcg@5": 0, "ndcg@10": 0, "p@5": 0, "p@10": 0,
+			"recall@5": 0, "recall@10": 0, "judged@5": 0, "judged@10": 0,
+		},
+	}
+	tests := []struct {
+		name     string
+		complete bool
+		queries  []string
+	}{
+		// q3 has no relevant documents, and q4 no results
+		{"trec_eval", false, []string{"q1", "q2"}},
+		{"complete", true, []string{"q1", "q2", "q4"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			evaluation := Evaluate(run, qrels, []int{5, 10}, test.complete)
+			if strings.Join(evaluation.Queries, " ") != strings.Join(test.queries, " ") {
+				t.Fatalf("queries %v, want %v", evaluation.Queries, test.queries)
+			}
+			for _, query := range test.queries {
+				for _, measure := range evaluation.Measures {
+					value, want := evaluation.Values[query][measure], expected[query][measure]
+					if math.Abs(value-want) > 1e-12 {
+						t.Errorf("%s %s = %v, want %v", query, measure, value, want)
+					}
+				}
+			}
+			mean := 0.0
+			for _, query := range test.queries {
+				mean += expected[query]["map"]
+			}
+			mean /= float64(len(test.queries))
+			if math.Abs(evaluation.Mean("map")-mean) > 1e-12 {
+				t.Errorf("mean map = %v, want %v", evaluation.Mean("map"), mean)
+			}
+		})
+	}
+}
+
+func TestMeasureNames(t *testing.T) {
+	names := strings.Join(MeasureNames([]int{5, 10}), " ")
+	expected := "map mrr@10 ndcg@5 ndcg@10 p@5 p@10 recall@5 recall@10 judged@5 judged@10"
+	if names != expected {
+		t.Errorf("MeasureNames = %q, want %q", names, expected)
+	}
+}
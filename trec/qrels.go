@@ -0,0 +1,77 @@
+package trec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Qrels holds the relevance judgments of each query, by query id and docno.
+type Qrels map[string]map[string]int
+
+// Run holds the results of each query, by query id.
+type Run map[string][]RunResult
+
+// ReadQrels reads relevance judgments in the TREC format: lines of query id, iteration, docno and
+// relevance, separated by whitespace. The iteration is ignored.
+func ReadQrels(reader io.Reader) (Qrels, error) {
+	qrels := make(Qrels)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 4 {
+			return nil, fmt.Errorf("qrels line %d: expected query id, iteration, docno and relevance", lineNumber)
+		}
+		relevance, err := strconv.Atoi(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("qrels line %d: relevance: %w", lineNumber, err)
+		}
+		if qrels[fields[0]] == nil {
+			qrels[fields[0]] = make(map[string]int)
+		}
+		qrels[fields[0]][fields[2]] = relevance
+	}
+	return qrels, scanner.Err()
+}
+
+// ReadRun reads results in the TREC run format: lines of query id, "Q0", docno, rank, score and run tag,
+// separated by whitespace. Results are kept in the order they appear; the ranks are ignored.
+func ReadRun(reader io.Reader) (Run, error) {
+	run := make(Run)
+	seen := make(map[string]map[string]bool)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 6 {
+			return nil, fmt.Errorf("run line %d: expected query id, Q0, docno, rank, score and tag", lineNumber)
+		}
+		score, err := strconv.ParseFloat(fields[4], 64)
+		if err != nil {
+			return nil, fmt.Errorf("run line %d: score: %w", lineNumber, err)
+		}
+		queryID, docno := fields[0], fields[2]
+		if seen[queryID] == nil {
+			seen[queryID] = make(map[string]bool)
+		}
+		if seen[queryID][docno] {
+			return nil, fmt.Errorf("run line %d: docno %q is retrieved twice for query %q", lineNumber, docno, queryID)
+		}
+		seen[queryID][docno] = true
+		run[queryID] = append(run[queryID], RunResult{Docno: docno, Score: score})
+	}
+	return run, scanner.Err()
+}
@@ -0,0 +1,41 @@
+package trec
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+)
+
+// RunResult is a document retrieved for a query, identified by its collection docid.
+type RunResult struct {
+	Docno string
+	Score float64
+}
+
+// RunWriter writes results in the TREC run format read by trec_eval: lines of query id, "Q0", docno,
+// rank, score and run tag.
+type RunWriter struct {
+	writer *bufio.Writer
+	tag    string
+}
+
+// NewRunWriter returns a RunWriter that labels its results with tag.
+func NewRunWriter(writer io.Writer, tag string) *RunWriter {
+	return &RunWriter{writer: bufio.NewWriter(writer), tag: tag}
+}
+
+// Write writes the results of a query, which must be ordered from best to worst, ranked from 1.
+func (writer *RunWriter) Write(queryID string, results []RunResult) error {
+	for rank, result := range results {
+		_, err := fmt.Fprintf(writer.writer, "%s Q0 %s %d %g %s\n", queryID, result.Docno, rank+1, result.Score, writer.tag)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush writes any buffered results to the underlying writer.
+func (writer *RunWriter) Flush() error {
+	return writer.writer.Flush()
+}
@@ -0,0 +1,129 @@
+package trec
+
+import (
+	"math"
+	"math/rand/v2"
+)
+
+// meanDifference returns the mean of b[i] - a[i].
+func meanDifference(a, b []float64) float64 {
+	sum := 0.0
+	for i := range a {
+		sum += b[i] - a[i]
+	}
+	return sum / float64(len(a))
+}
+
+// PairedTTest returns the t statistic of the paired differences b[i] - a[i] and the two-sided p-value of
+// Student's t-test that their mean is zero.
+func PairedTTest(a, b []float64) (float64, float64) {
+	n := float64(len(a))
+	if len(a) < 2 {
+		return 0, 1
+	}
+	mean := meanDifference(a, b)
+	variance := 0.0
+	for i := range a {
+		deviation := b[i] - a[i] - mean
+		variance += deviation * deviation
+	}
+	variance /= n - 1
+	if variance == 0 {
+		if mean == 0 {
+			return 0, 1
+		}
+		return math.Copysign(math.Inf(1), mean), 0
+	}
+	t := mean / math.Sqrt(variance/n)
+	degrees := n - 1
+	return t, regularizedIncompleteBeta(degrees/(degrees+t*t), degrees/2, 0.5)
+}
+
+// RandomizationTest returns the two-sided p-value of a paired randomization test that the mean of
+// b[i] - a[i] is zero: the fraction of permutations, each swapping a random subset of the pairs, whose
+// mean difference is at least as far from zero as the observed one. The permutations are drawn from seed.
+func RandomizationTest(a, b []float64, permutations int, seed uint64) float64 {
+	if len(a) == 0 || permutations <= 0 {
+		return 1
+	}
+	differences := make([]float64, len(a))
+	for i := range a {
+		differences[i] = b[i] - a[i]
+	}
+	observed := math.Abs(meanDifference(a, b))
+	random := rand.New(rand.NewPCG(seed, 0))
+	extreme := 0
+	for range permutations {
+		sum := 0.0
+		for _, difference := range differences {
+			if random.IntN(2) == 0 {
+				sum += difference
+			} else {
+				sum -= difference
+			}
+		}
+		// Allow for rounding, so the identity permutation always counts
+		if math.Abs(sum/float64(len(differences))) >= observed-1e-12 {
+			extreme++
+		}
+	}
+	return float64(extreme) / float64(permutations)
+}
+
+// regularizedIncompleteBeta returns I_x(a, b), evaluated with the continued fraction of Numerical
+// Recipes (section 6.4).
+func regularizedIncompleteBeta(x, a, b float64) float64 {
+	if x <= 0 {
+		return 0
+	}
+	if x >= 1 {
+		return 1
+	}
+	lgammaA, _ := math.Lgamma(a)
+	lgammaB, _ := math.Lgamma(b)
+	lgammaAB, _ := math.Lgamma(a + b)
+	front := math.Exp(lgammaAB - lgammaA - lgammaB + a*math.Log(x) + b*math.Log(1-x))
+	if x < (a+1)/(a+b+2) {
+		return front * betaContinuedFraction(x, a, b) / a
+	}
+	return 1 - front*betaContinuedFraction(1-x, b, a)/b
+}
+
+func betaContinuedFraction(x, a, b float64) float64 {
+	const epsilon, tiny = 1e-15, 1e-300
+	c, d := 1.0, 1-(a+b)*x/(a+1)
+	if math.Abs(d) < tiny {
+		d = tiny
+	}
+	d = 1 / d
+	result := d
+	for m := 1.0; m <= 300; m++ {
+		numerator := m * (b - m) * x / ((a + 2*m - 1) * (a + 2*m))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		result *= d * c
+		numerator = -(a + m) * (a + b + m) * x / ((a + 2*m) * (a + 2*m + 1))
+		d = 1 + numerator*d
+		if math.Abs(d) < tiny {
+			d = tiny
+		}
+		c = 1 + numerator/c
+		if math.Abs(c) < tiny {
+			c = tiny
+		}
+		d = 1 / d
+		delta := d * c
+		result *= delta
+		if math.Abs(delta-1) < epsilon {
+			break
+		}
+	}
+	return result
+}
@@ -0,0 +1,70 @@
+package trec
+
+import (
+	"math"
+	"testing"
+)
+
+func TestPairedTTest(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b []float64
+		t, p float64
+	}{
+		// one degree of freedom: the Cauchy distribution, p = 1 - 2 atan(t)/pi
+		{"1 degree", []float64{0, 0}, []float64{1, 3}, 2, 1 - 2*math.Atan(2)/math.Pi},
+		// two degrees of freedom: p = 1 - t/sqrt(t^2 + 2)
+		{"2 degrees", []float64{1, 1, 1}, []float64{2, 3, 7}, 3 / math.Sqrt(7.0/3), 0.18849732879931091},
+		{"negative", []float64{2, 3, 7}, []float64{1, 1, 1}, -3 / math.Sqrt(7.0/3), 0.18849732879931091},
+		{"identical", []float64{0.1, 0.5, 0.3}, []float64{0.1, 0.5, 0.3}, 0, 1},
+		{"constant difference", []float64{0.25, 0.5, 0.75}, []float64{0.5, 0.75, 1}, math.Inf(1), 0},
+		{"single pair", []float64{0.1}, []float64{0.9}, 0, 1},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tStatistic, p := PairedTTest(test.a, test.b)
+			if math.IsInf(test.t, 0) && tStatistic != test.t || !math.IsInf(test.t, 0) && math.Abs(tStatistic-test.t) > 1e-9 {
+				t.Errorf("t = %v, want %v", tStatistic, test.t)
+			}
+			if math.Abs(p-test.p) > 1e-9 {
+				t.Errorf("p = %v, want %v", p, test.p)
+			}
+		})
+	}
+}
+
+// TestStudentT checks the two-sided p-values of critical values from tables of Student's t
+// distribution.
+func TestStudentT(t *testing.T) {
+	tests := []struct {
+		t, degrees, p float64
+	}{
+		{12.706204736174698, 1, 0.05},
+		{2.7764451051977934, 4, 0.05},
+		{2.2281388519862744, 10, 0.05},
+		{3.1692726726169518, 10, 0.01},
+		{2.0422724563012373, 30, 0.05},
+	}
+	for _, test := range tests {
+		p := regularizedIncompleteBeta(test.degrees/(test.degrees+test.t*test.t), test.degrees/2, 0.5)
+		if math.Abs(p-test.p) > 1e-9 {
+			t.Errorf("t = %v with %v degrees of freedom: p = %v, want %v", test.t, test.degrees, p, test.p)
+		}
+	}
+}
+
+func TestRandomizationTest(t *testing.T) {
+	a := []float64{0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	b := []float64{1, 1, 1, 1, 1, 1, 1, 1, 1, 1}
+	// only the 2 of 2^10 sign flips that keep every sign the same are as extreme
+	p := RandomizationTest(a, b, 200000, 1)
+	if math.Abs(p-2.0/1024) > 0.0005 {
+		t.Errorf("p = %v, want about %v", p, 2.0/1024)
+	}
+	if p != RandomizationTest(a, b, 200000, 1) {
+		t.Error("p differs for the same seed")
+	}
+	if p := RandomizationTest(a, a, 1000, 1); p != 1 {
+		t.Errorf("identical systems: p = %v, want 1", p)
+	}
+}
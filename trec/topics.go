@@ -0,0 +1,210 @@
+// Package trec reads TREC topics and reads and writes TREC run files.
+package trec
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// Topic is an information need, identified by its query id. Topics read from TSV only have a title.
+type Topic struct {
+	ID          string
+	Title       string
+	Description string
+	Narrative   string
+}
+
+// TopicFormats lists the topic formats accepted by ReadTopics.
+//   - trec: the SGML <top> elements of the classic TREC tracks, holding <num>, <title>, <desc> and <narr>.
+//   - tsv: lines of query id and query separated by a tab, as for MS MARCO.
+//   - jsonl: one JSON object per line with an "id" or "qid" field and "title", "description" and
+//     "narrative" fields, or a "query" or "text" field taken as the title.
+var TopicFormats = []string{"trec", "tsv", "jsonl"}
+
+// TopicFields lists the fields of a topic that a query can be made of.
+var TopicFields = []string{"title", "description", "narrative"}
+
+// maxLineLength bounds a single line of a topics, qrels or run file.
+const maxLineLength = 1 << 30
+
+// ReadTopics reads the topics of reader, which holds topics in format, in the order they appear.
+func ReadTopics(reader io.Reader, format string) ([]Topic, error) {
+	switch format {
+	case "trec":
+		return ReadTrecTopics(reader)
+	case "tsv":
+		return ReadTSVTopics(reader)
+	case "jsonl":
+		return ReadJSONLTopics(reader)
+	default:
+		return nil, fmt.Errorf("unknown topic format %q, expected one of %v", format, TopicFormats)
+	}
+}
+
+// trecTopicTag matches the tags of a TREC topic. Only <top> is reliably closed, so a field runs until
+// the next tag.
+var trecTopicTag = regexp.MustCompile(`(?i)<(/?)(top|num|title|desc|narr)>`)
+
+// trecFieldLabels are the labels that start the fields of TREC topics.
+var trecFieldLabels = []string{"Number:", "Topic:", "Description:", "Narrative:"}
+
+// ReadTrecTopics reads topics in the SGML format of the classic TREC tracks.
+func ReadTrecTopics(reader io.Reader) ([]Topic, error) {
+	contents, err := io.ReadAll(reader)
+	if err != nil {
+		return nil, err
+	}
+	text := string(contents)
+	topics := make([]Topic, 0)
+	var topic *Topic
+	tags := trecTopicTag.FindAllStringSubmatchIndex(text, -1)
+	for tagIndex, tag := range tags {
+		closing, name := text[tag[2]:tag[3]] == "/", strings.ToLower(text[tag[4]:tag[5]])
+		if name == "top" {
+			if closing && topic != nil {
+				topics = append(topics, *topic)
+				topic = nil
+			} else if !closing {
+				topic = &Topic{}
+			}
+			continue
+		}
+		if closing || topic == nil {
+			continue
+		}
+		end := len(text)
+		if tagIndex+1 < len(tags) {
+			end = tags[tagIndex+1][0]
+		}
+		field := strings.Join(strings.Fields(text[tag[1]:end]), " ")
+		for _, label := range trecFieldLabels {
+			if cut, found := strings.CutPrefix(field, label); found {
+				field = strings.TrimSpace(cut)
+				break
+			}
+		}
+		switch name {
+		case "num":
+			topic.ID = field
+		case "title":
+			topic.Title = field
+		case "desc":
+			topic.Description = field
+		case "narr":
+			topic.Narrative = field
+		}
+	}
+	if topic != nil {
+		return nil, fmt.Errorf("topic %q is not closed with </top>", topic.ID)
+	}
+	for _, topic := range topics {
+		if topic.ID == "" {
+			return nil, fmt.Errorf("topic %q has no <num>", topic.Title)
+		}
+	}
+	return topics, nil
+}
+
+// ReadTSVTopics reads lines of query id and query separated by a tab.
+func ReadTSVTopics(reader io.Reader) ([]Topic, error) {
+	topics := make([]Topic, 0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		id, query, found := strings.Cut(scanner.Text(), "\t")
+		if !found {
+			return nil, fmt.Errorf("line %d: expected a query id and query separated by a tab", lineNumber)
+		}
+		topics = append(topics, Topic{ID: strings.TrimSpace(id), Title: strings.TrimSpace(query)})
+	}
+	return topics, scanner.Err()
+}
+
+// jsonlTopic holds the fields a JSON Lines topic may have. Query ids may be strings or numbers.
+type jsonlTopic struct {
+	ID          json.RawMessage `json:"id"`
+	QID         json.RawMessage `json:"qid"`
+	Title       string          `json:"title"`
+	Query       string          `json:"query"`
+	Text        string          `json:"text"`
+	Description string          `json:"description"`
+	Narrative   string          `json:"narrative"`
+}
+
+// ReadJSONLTopics reads one JSON object per line.
+func ReadJSONLTopics(reader io.Reader) ([]Topic, error) {
+	topics := make([]Topic, 0)
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), maxLineLength)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+		var object jsonlTopic
+		err := json.Unmarshal(scanner.Bytes(), &object)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+		}
+		id := object.ID
+		if id == nil {
+			id = object.QID
+		}
+		if id == nil {
+			return nil, fmt.Errorf("line %d: no \"id\" or \"qid\" field", lineNumber)
+		}
+		topicID, err := jsonID(id)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: query id: %w", lineNumber, err)
+		}
+		topic := Topic{
+			ID:          topicID,
+			Title:       cmp.Or(object.Title, object.Query, object.Text),
+			Description: object.Description,
+			Narrative:   object.Narrative,
+		}
+		topics = append(topics, topic)
+	}
+	return topics, scanner.Err()
+}
+
+// jsonID returns a query id given as a JSON string or number.
+func jsonID(id json.RawMessage) (string, error) {
+	if strings.HasPrefix(string(id), `"`) {
+		var text string
+		err := json.Unmarshal(id, &text)
+		return text, err
+	}
+	var number json.Number
+	err := json.Unmarshal(id, &number)
+	return number.String(), err
+}
+
+// Query returns the text of the named fields of the topic, one of TopicFields each, joined by spaces.
+func (topic Topic) Query(fields []string) (string, error) {
+	parts := make([]string, 0, len(fields))
+	for _, field := range fields {
+		switch field {
+		case "title":
+			parts = append(parts, topic.Title)
+		case "description":
+			parts = append(parts, topic.Description)
+		case "narrative":
+			parts = append(parts, topic.Narrative)
+		default:
+			return "", fmt.Errorf("unknown topic field %q, expected one of %v", field, TopicFields)
+		}
+	}
+	return strings.Join(parts, " "), nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/Axiomatic314/ciffTools/ciffio"
+)
+
+func validateCommand(arguments []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	ciffFilePath := flags.String("ciffFilePath", "", "filepath of CIFF file to validate")
+	impacts := flags.Bool("impacts", false, "Bool to skip the checks that assume postings hold term frequencies, for quantized ciffs. Defaults to false.")
+	flags.Parse(arguments)
+
+	if *ciffFilePath == "" {
+		fmt.Println("Please provide a CIFF file!")
+		return 1
+	}
+
+	ciffFileHandle, err := os.Open(*ciffFilePath)
+	if err != nil {
+		slog.Error("error opening ciff", "error", err)
+		return 1
+	}
+	defer ciffFileHandle.Close()
+
+	violations, err := ciffio.Validate(ciffFileHandle, ciffio.ValidateOptions{Impacts: *impacts})
+	for _, violation := range violations {
+		fmt.Println(violation)
+	}
+	if err != nil {
+		slog.Error("error reading ciff", "error", err)
+		return 1
+	}
+	if len(violations) > 0 {
+		fmt.Printf("%s: %d violations\n", *ciffFilePath, len(violations))
+		return 1
+	}
+	fmt.Printf("%s: valid\n", *ciffFilePath)
+	return 0
+}